@@ -0,0 +1,472 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Names used for command files must be safe to use as file names
+var validFileName = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// AdminServer is an HTTP API for managing the bot's commands and interval messages while it is running
+type AdminServer struct {
+	token         string
+	chatClient    ChatClient
+	triggerTokens []TriggerToken
+}
+
+type intervalResponse struct {
+	Name string `json:"name"`
+	IntervalMessage
+}
+
+type statusResponse struct {
+	Channels          []string `json:"channels"`
+	MessageCount      uint32   `json:"message_count"`
+	InvokableCommands int      `json:"invokable_commands"`
+	IntervalMessages  int      `json:"interval_messages"`
+	QueueDepth        int      `json:"queue_depth"`
+	MessagesSent      uint64   `json:"messages_sent"`
+	MessagesDropped   uint64   `json:"messages_dropped"`
+}
+
+type sayRequest struct {
+	Channel string `json:"channel"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewAdminServer creates an AdminServer that requires the given token as a bearer token and sends messages using the
+// given ChatClient
+func NewAdminServer(token string, chatClient ChatClient) *AdminServer {
+	return &AdminServer{token: token, chatClient: chatClient}
+}
+
+// Starts the admin API in the background if ADMIN_ADDRESS is set
+func startAdminServer(address string, token string, chatClient ChatClient) {
+	if address == "" {
+		return
+	}
+	if token == "" && len(triggerTokens) == 0 {
+		panic(errors.New("ADMIN_TOKEN or TRIGGER_TOKENS_FILE must be set to use the admin API"))
+	}
+	server := NewAdminServer(token, chatClient)
+	server.triggerTokens = triggerTokens
+
+	go func() {
+		logger.Info("Admin API listening", "address", address)
+		err := http.ListenAndServe(address, server)
+		if err != nil {
+			logger.Error("Admin API stopped", "error", err)
+		}
+	}()
+}
+
+func (s *AdminServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	path := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	if !s.isAuthorized(request) {
+		if triggerToken, ok := s.findTriggerToken(request); ok && len(path) == 1 && path[0] == "trigger" {
+			s.handleTrigger(writer, request, &triggerToken)
+			return
+		}
+		writeJSON(writer, http.StatusUnauthorized, errorResponse{Error: "missing or invalid token"})
+		return
+	}
+
+	switch path[0] {
+	case "commands":
+		s.handleCommands(writer, request, path[1:])
+	case "intervals":
+		s.handleIntervals(writer, request, path[1:])
+	case "status":
+		s.handleStatus(writer, request)
+	case "say":
+		s.handleSay(writer, request)
+	case "songs":
+		s.handleSongs(writer, request, path[1:])
+	case "trigger":
+		s.handleTrigger(writer, request, nil)
+	default:
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "not found"})
+	}
+}
+
+// Checks the request has the admin token as a bearer token
+func (s *AdminServer) isAuthorized(request *http.Request) bool {
+	token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// Handles /commands, /commands/{invocation}, /commands/{invocation}/enable and /commands/{invocation}/disable
+func (s *AdminServer) handleCommands(writer http.ResponseWriter, request *http.Request, path []string) {
+	if len(path) == 0 {
+		switch request.Method {
+		case http.MethodGet:
+			writeJSON(writer, http.StatusOK, invokableCommands())
+		case http.MethodPost:
+			command, ok := decodeCommand(writer, request)
+			if !ok {
+				return
+			}
+			if _, exists := findCommand(command.Invocation); exists || commandFileExists(command.Invocation+".command.json") {
+				writeJSON(writer, http.StatusConflict, errorResponse{Error: "command already exists"})
+				return
+			}
+			s.saveCommand(writer, http.StatusCreated, filepath.Join(commandsDirectory, command.Invocation+".command.json"), command)
+		default:
+			writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		}
+		return
+	}
+
+	existing, exists := findCommand(path[0])
+	if !exists {
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "command not found"})
+		return
+	}
+	if existing.script != nil && request.Method != http.MethodGet && request.Method != http.MethodDelete {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "script commands can only be changed by editing their file"})
+		return
+	}
+
+	if len(path) == 2 && request.Method == http.MethodPost && (path[1] == "enable" || path[1] == "disable") {
+		existing.Disabled = path[1] == "disable"
+		s.saveCommand(writer, http.StatusOK, existing.filePath, existing)
+		return
+	}
+	if len(path) != 1 {
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		writeJSON(writer, http.StatusOK, existing)
+	case http.MethodPut:
+		command, ok := decodeCommand(writer, request)
+		if !ok {
+			return
+		}
+		if other, exists := findCommand(command.Invocation); exists && other.filePath != existing.filePath {
+			writeJSON(writer, http.StatusConflict, errorResponse{Error: "command already exists"})
+			return
+		}
+		s.saveCommand(writer, http.StatusOK, existing.filePath, command)
+	case http.MethodDelete:
+		err := deleteCommandFile(existing.filePath)
+		if err != nil {
+			writeJSON(writer, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	}
+}
+
+// Handles /intervals, /intervals/{name}, /intervals/{name}/enable and /intervals/{name}/disable
+func (s *AdminServer) handleIntervals(writer http.ResponseWriter, request *http.Request, path []string) {
+	if len(path) == 0 {
+		switch request.Method {
+		case http.MethodGet:
+			var intervals []intervalResponse
+			for _, interval := range intervalMessages() {
+				intervals = append(intervals, intervalResponse{Name: intervalName(interval), IntervalMessage: interval})
+			}
+			writeJSON(writer, http.StatusOK, intervals)
+		case http.MethodPost:
+			var interval intervalResponse
+			if !decodeJSON(writer, request, &interval) {
+				return
+			}
+			if !validFileName.MatchString(interval.Name) {
+				writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "name must only contain lowercase letters, numbers, - and _"})
+				return
+			}
+			if _, exists := findInterval(interval.Name); exists || commandFileExists(interval.Name+".interval.json") {
+				writeJSON(writer, http.StatusConflict, errorResponse{Error: "interval message already exists"})
+				return
+			}
+			s.saveInterval(writer, http.StatusCreated, filepath.Join(commandsDirectory, interval.Name+".interval.json"), interval.IntervalMessage)
+		default:
+			writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		}
+		return
+	}
+
+	existing, exists := findInterval(path[0])
+	if !exists {
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "interval message not found"})
+		return
+	}
+
+	if len(path) == 2 && request.Method == http.MethodPost && (path[1] == "enable" || path[1] == "disable") {
+		existing.Disabled = path[1] == "disable"
+		s.saveInterval(writer, http.StatusOK, existing.filePath, existing)
+		return
+	}
+	if len(path) != 1 {
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		writeJSON(writer, http.StatusOK, intervalResponse{Name: path[0], IntervalMessage: existing})
+	case http.MethodPut:
+		var interval IntervalMessage
+		if !decodeJSON(writer, request, &interval) {
+			return
+		}
+		s.saveInterval(writer, http.StatusOK, existing.filePath, interval)
+	case http.MethodDelete:
+		err := deleteCommandFile(existing.filePath)
+		if err != nil {
+			writeJSON(writer, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+	}
+}
+
+func (s *AdminServer) handleStatus(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+
+	status := statusResponse{
+		Channels:          []string{channel},
+		MessageCount:      atomic.LoadUint32(&messageCount),
+		InvokableCommands: len(invokableCommands()),
+		IntervalMessages:  len(intervalMessages()),
+	}
+	if rateLimitedClient, ok := s.chatClient.(*RateLimitedChatClient); ok {
+		status.QueueDepth = rateLimitedClient.QueueDepth()
+		status.MessagesSent = rateLimitedClient.Sent()
+		status.MessagesDropped = rateLimitedClient.Dropped()
+	}
+	writeJSON(writer, http.StatusOK, status)
+}
+
+func (s *AdminServer) handleSay(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+
+	var say sayRequest
+	if !decodeJSON(writer, request, &say) {
+		return
+	}
+	if say.Message == "" {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "message must not be empty"})
+		return
+	}
+	if say.Channel == "" {
+		say.Channel = channel
+	}
+	if !strings.EqualFold(say.Channel, channel) {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "the bot has not joined " + say.Channel})
+		return
+	}
+
+	s.chatClient.Say(say.Channel, say.Message)
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// Handles /songs, /songs/skip and /songs/events, using the channel query parameter or the bot's channel
+func (s *AdminServer) handleSongs(writer http.ResponseWriter, request *http.Request, path []string) {
+	if songQueue == nil {
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "song requests are not enabled"})
+		return
+	}
+	songChannel := request.URL.Query().Get("channel")
+	if songChannel == "" {
+		songChannel = channel
+	}
+
+	if len(path) == 0 {
+		switch request.Method {
+		case http.MethodGet:
+			writeJSON(writer, http.StatusOK, songQueue.Songs(songChannel))
+		case http.MethodDelete:
+			songQueue.Clear(songChannel)
+			writer.WriteHeader(http.StatusNoContent)
+		default:
+			writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		}
+		return
+	}
+
+	switch {
+	case len(path) == 1 && path[0] == "skip" && request.Method == http.MethodPost:
+		song, skipped := songQueue.Skip(songChannel)
+		if !skipped {
+			writeJSON(writer, http.StatusNotFound, errorResponse{Error: "the song queue is empty"})
+			return
+		}
+		writeJSON(writer, http.StatusOK, song)
+	case len(path) == 1 && path[0] == "events" && request.Method == http.MethodGet:
+		s.streamSongs(writer, request, songChannel)
+	default:
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "not found"})
+	}
+}
+
+// Sends the song queue as a server-sent event now and whenever it changes, until the client disconnects
+func (s *AdminServer) streamSongs(writer http.ResponseWriter, request *http.Request, songChannel string) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writeJSON(writer, http.StatusInternalServerError, errorResponse{Error: "streaming is not supported"})
+		return
+	}
+
+	updates, unsubscribe := songQueue.Subscribe(songChannel)
+	defer unsubscribe()
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case songs := <-updates:
+			if songs == nil {
+				songs = []Song{}
+			}
+			data, err := json.Marshal(songs)
+			if err != nil {
+				logger.Warn("Error encoding song queue", "error", err)
+				continue
+			}
+			_, err = fmt.Fprintf(writer, "event: queue\ndata: %s\n\n", data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Writes the command to the given file and loads it, responding with the loaded command
+func (s *AdminServer) saveCommand(writer http.ResponseWriter, status int, filePath string, command InvokableCommand) {
+	fileData, err := json.MarshalIndent(command, "", "\t")
+	if err != nil {
+		writeJSON(writer, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+
+	err = saveCommandFile(filePath, fileData)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	saved, _ := findCommand(command.Invocation)
+	writeJSON(writer, status, saved)
+}
+
+// Writes the interval message to the given file and loads it, responding with the loaded interval message
+func (s *AdminServer) saveInterval(writer http.ResponseWriter, status int, filePath string, interval IntervalMessage) {
+	fileData, err := json.MarshalIndent(interval, "", "\t")
+	if err != nil {
+		writeJSON(writer, http.StatusInternalServerError, errorResponse{Error: err.Error()})
+		return
+	}
+
+	err = saveCommandFile(filePath, fileData)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	name := strings.TrimSuffix(filepath.Base(filePath), ".interval.json")
+	saved, _ := findInterval(name)
+	writeJSON(writer, status, intervalResponse{Name: name, IntervalMessage: saved})
+}
+
+// Decodes a command from the request body, responding with an error if it is not valid
+func decodeCommand(writer http.ResponseWriter, request *http.Request) (InvokableCommand, bool) {
+	var command InvokableCommand
+	if !decodeJSON(writer, request, &command) {
+		return command, false
+	}
+
+	if !command.CaseSensitive {
+		command.Invocation = strings.ToLower(command.Invocation)
+	}
+	if !validFileName.MatchString(strings.ToLower(command.Invocation)) {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "invocation must only contain letters, numbers, - and _"})
+		return command, false
+	}
+	if command.Message == "" {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "message must not be empty"})
+		return command, false
+	}
+	return command, true
+}
+
+// Decodes the request body into value, responding with an error if it is not valid JSON
+func decodeJSON(writer http.ResponseWriter, request *http.Request, value interface{}) bool {
+	err := json.NewDecoder(request.Body).Decode(value)
+	if err != nil {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "invalid JSON: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+func writeJSON(writer http.ResponseWriter, status int, value interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	err := json.NewEncoder(writer).Encode(value)
+	if err != nil {
+		logger.Warn("Error writing admin API response", "error", err)
+	}
+}
+
+// Checks whether a file with the given name is already in the commands folder
+func commandFileExists(fileName string) bool {
+	_, err := os.Stat(filepath.Join(commandsDirectory, fileName))
+	return err == nil
+}
+
+// Returns the loaded command with the given invocation
+func findCommand(invocation string) (InvokableCommand, bool) {
+	for _, command := range invokableCommands() {
+		if command.Invocation == invocation {
+			return command, true
+		}
+	}
+	return InvokableCommand{}, false
+}
+
+// Returns the loaded interval message with the given name
+func findInterval(name string) (IntervalMessage, bool) {
+	for _, interval := range intervalMessages() {
+		if intervalName(interval) == name {
+			return interval, true
+		}
+	}
+	return IntervalMessage{}, false
+}
+
+// Interval messages are named after the file they were loaded from
+func intervalName(interval IntervalMessage) string {
+	return strings.TrimSuffix(filepath.Base(interval.filePath), ".interval.json")
+}
@@ -0,0 +1,299 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Sets up an empty commands folder and an admin server that sends messages to the returned recorder
+func setUpAdminServer(t *testing.T) (*AdminServer, *RecordingChatClient, func()) {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commandsDirectory = directory
+	channel = "testchannel"
+	InvokableCommandList = nil
+	IntervalMessageList = nil
+
+	recorder := &RecordingChatClient{}
+	return NewAdminServer("secret", recorder), recorder, func() {
+		commandsDirectory = "commands/"
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func adminRequest(server *AdminServer, method string, path string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	return response
+}
+
+func TestAdminServer_Unauthorized(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	request := httptest.NewRequest(http.MethodGet, "/commands", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Test Failed: Expected status 401 but was %d", response.Code)
+	}
+}
+
+func TestAdminServer_CreateCommand(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	response := adminRequest(server, http.MethodPost, "/commands", `{"invocation": "Discord", "message": "Join us!"}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Test Failed: Expected status 201 but was %d: %s", response.Code, response.Body.String())
+	}
+
+	command, exists := findCommand("discord")
+	if !exists || command.Message != "Join us!" {
+		t.Error("Test Failed: Expected the discord command to be loaded")
+	}
+
+	fileData, err := ioutil.ReadFile(filepath.Join(commandsDirectory, "discord.command.json"))
+	if err != nil {
+		t.Fatal("Test Failed: Expected the command to be saved to discord.command.json: " + err.Error())
+	}
+	var saved InvokableCommand
+	_ = json.Unmarshal(fileData, &saved)
+	if saved.Invocation != "discord" || saved.Message != "Join us!" {
+		t.Error("Test Failed: Expected the saved file to contain the command but was: " + string(fileData))
+	}
+}
+
+func TestAdminServer_CreateCommandWithReservedKeyword(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	response := adminRequest(server, http.MethodPost, "/commands", `{"invocation": "hug", "message": "hug", "parameters": [{"name": "username"}]}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Test Failed: Expected status 400 but was %d", response.Code)
+	}
+	if _, exists := findCommand("hug"); exists {
+		t.Error("Test Failed: Expected the command to not be loaded")
+	}
+	if commandFileExists("hug.command.json") {
+		t.Error("Test Failed: Expected the invalid command file to be removed")
+	}
+}
+
+func TestAdminServer_CreateDuplicateCommand(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	adminRequest(server, http.MethodPost, "/commands", `{"invocation": "discord", "message": "Join us!"}`)
+	response := adminRequest(server, http.MethodPost, "/commands", `{"invocation": "discord", "message": "Again"}`)
+	if response.Code != http.StatusConflict {
+		t.Errorf("Test Failed: Expected status 409 but was %d", response.Code)
+	}
+}
+
+func TestAdminServer_UpdateCommand(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	adminRequest(server, http.MethodPost, "/commands", `{"invocation": "discord", "message": "Join us!"}`)
+	response := adminRequest(server, http.MethodPut, "/commands/discord", `{"invocation": "discord", "message": "Updated"}`)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Test Failed: Expected status 200 but was %d: %s", response.Code, response.Body.String())
+	}
+
+	if len(invokableCommands()) != 1 {
+		t.Errorf("Test Failed: Expected 1 command to be loaded but was %d", len(invokableCommands()))
+	}
+	command, _ := findCommand("discord")
+	if command.Message != "Updated" {
+		t.Error("Test Failed: Expected message to be 'Updated' but was: " + command.Message)
+	}
+}
+
+func TestAdminServer_DisableAndDeleteCommand(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	adminRequest(server, http.MethodPost, "/commands", `{"invocation": "discord", "message": "Join us!"}`)
+
+	response := adminRequest(server, http.MethodPost, "/commands/discord/disable", "")
+	if response.Code != http.StatusOK {
+		t.Fatalf("Test Failed: Expected status 200 but was %d: %s", response.Code, response.Body.String())
+	}
+	command, _ := findCommand("discord")
+	if !command.Disabled {
+		t.Error("Test Failed: Expected the command to be disabled")
+	}
+
+	response = adminRequest(server, http.MethodDelete, "/commands/discord", "")
+	if response.Code != http.StatusNoContent {
+		t.Errorf("Test Failed: Expected status 204 but was %d", response.Code)
+	}
+	if _, exists := findCommand("discord"); exists {
+		t.Error("Test Failed: Expected the command to be unloaded")
+	}
+	if commandFileExists("discord.command.json") {
+		t.Error("Test Failed: Expected the command file to be deleted")
+	}
+}
+
+func TestAdminServer_CreateAndDisableInterval(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	response := adminRequest(server, http.MethodPost, "/intervals", `{"name": "follow", "message": "Follow!", "message_interval": 10}`)
+	if response.Code != http.StatusCreated {
+		t.Fatalf("Test Failed: Expected status 201 but was %d: %s", response.Code, response.Body.String())
+	}
+	if !commandFileExists("follow.interval.json") {
+		t.Error("Test Failed: Expected the interval message to be saved to follow.interval.json")
+	}
+
+	adminRequest(server, http.MethodPost, "/intervals/follow/disable", "")
+	interval, exists := findInterval("follow")
+	if !exists || !interval.Disabled || interval.MessageInterval != 10 {
+		t.Errorf("Test Failed: Expected a disabled interval message every 10 messages but was %+v", interval)
+	}
+}
+
+func TestAdminServer_CreateInvalidInterval(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	response := adminRequest(server, http.MethodPost, "/intervals", `{"name": "follow", "message": "Follow!", "message_interval": 0}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Test Failed: Expected status 400 but was %d", response.Code)
+	}
+
+	response = adminRequest(server, http.MethodPost, "/intervals", `{"name": "../follow", "message": "Follow!", "message_interval": 1}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Test Failed: Expected status 400 for a name with a path but was %d", response.Code)
+	}
+}
+
+func TestAdminServer_Say(t *testing.T) {
+	server, recorder, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+
+	response := adminRequest(server, http.MethodPost, "/say", `{"message": "Hello chat"}`)
+	if response.Code != http.StatusAccepted {
+		t.Errorf("Test Failed: Expected status 202 but was %d", response.Code)
+	}
+	if len(recorder.Messages) != 1 || recorder.Messages[0] != "Hello chat" {
+		t.Errorf("Test Failed: Expected the bot to say 'Hello chat' but said %v", recorder.Messages)
+	}
+
+	response = adminRequest(server, http.MethodPost, "/say", `{"channel": "elsewhere", "message": "Hello chat"}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Test Failed: Expected status 400 for a channel the bot has not joined but was %d", response.Code)
+	}
+}
+
+func TestAdminServer_Status(t *testing.T) {
+	_, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+	server := NewAdminServer("secret", NewRateLimitedChatClient(&RecordingChatClient{}, 1, rateLimitPeriod, 10))
+	server.chatClient.Say("testchannel", "queued")
+	messageCount = 5
+
+	response := adminRequest(server, http.MethodGet, "/status", "")
+	var status statusResponse
+	_ = json.Unmarshal(response.Body.Bytes(), &status)
+
+	if len(status.Channels) != 1 || status.Channels[0] != "testchannel" {
+		t.Errorf("Test Failed: Expected channels to be [testchannel] but was %v", status.Channels)
+	}
+	if status.MessageCount != 5 {
+		t.Errorf("Test Failed: Expected message count to be 5 but was %d", status.MessageCount)
+	}
+	if status.QueueDepth != 1 {
+		t.Errorf("Test Failed: Expected queue depth to be 1 but was %d", status.QueueDepth)
+	}
+}
+
+func TestAdminServer_Songs(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+	cleanUpSongs := setUpSongRequests(t, "")
+	defer cleanUpSongs()
+	_, _ = songQueue.Add("testchannel", Song{Title: "First", User: "viewer"}, 5)
+	_, _ = songQueue.Add("testchannel", Song{Title: "Second", User: "viewer"}, 5)
+
+	var songs []Song
+	response := adminRequest(server, http.MethodGet, "/songs", "")
+	_ = json.Unmarshal(response.Body.Bytes(), &songs)
+	if response.Code != http.StatusOK || len(songs) != 2 || songs[0].Title != "First" {
+		t.Errorf("Test Failed: Expected the queue but was %d: %s", response.Code, response.Body.String())
+	}
+
+	var skipped Song
+	response = adminRequest(server, http.MethodPost, "/songs/skip", "")
+	_ = json.Unmarshal(response.Body.Bytes(), &skipped)
+	if response.Code != http.StatusOK || skipped.Title != "First" {
+		t.Errorf("Test Failed: Expected First to be skipped but was %d: %s", response.Code, response.Body.String())
+	}
+
+	response = adminRequest(server, http.MethodDelete, "/songs", "")
+	if response.Code != http.StatusNoContent || len(songQueue.Songs("testchannel")) != 0 {
+		t.Errorf("Test Failed: Expected the queue to be cleared but was %d: %v", response.Code, songQueue.Songs("testchannel"))
+	}
+	response = adminRequest(server, http.MethodPost, "/songs/skip", "")
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Test Failed: Expected status 404 when the queue is empty but was %d", response.Code)
+	}
+}
+
+func TestAdminServer_SongEvents(t *testing.T) {
+	server, _, cleanUp := setUpAdminServer(t)
+	defer cleanUp()
+	cleanUpSongs := setUpSongRequests(t, "")
+	defer cleanUpSongs()
+
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	request, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/songs/events", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	reader := bufio.NewReader(response.Body)
+	readEvent := func() string {
+		var data string
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line == "\n" {
+				return data
+			}
+			if strings.HasPrefix(line, "data: ") {
+				data = strings.TrimSpace(strings.TrimPrefix(line, "data: "))
+			}
+		}
+	}
+
+	if event := readEvent(); event != "[]" {
+		t.Errorf("Test Failed: Expected the empty queue first but was %s", event)
+	}
+	_, _ = songQueue.Add("testchannel", Song{Title: "Live", User: "viewer"}, 5)
+	if event := readEvent(); !strings.Contains(event, `"title":"Live"`) {
+		t.Errorf("Test Failed: Expected the updated queue but was %s", event)
+	}
+}
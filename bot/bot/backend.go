@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+)
+
+// ChatMessage is a message sent in a channel on any chat network the bot can connect to
+type ChatMessage struct {
+	ID      string
+	Channel string
+	User    ChatUser
+	// The text of the message
+	Message string
+	Time    time.Time
+	// The name of the user the message replies to, if it is a reply
+	ReplyTo string
+}
+
+// ChatUser is the user who sent a chat message
+type ChatUser struct {
+	Name        string
+	DisplayName string
+	// The user's roles in the channel, named after Twitch's badges (e.g. broadcaster, moderator, vip and subscriber) with
+	// the badge's version as the value. Other networks map their own roles onto these
+	Badges map[string]int
+}
+
+// Backend connects the bot to a chat network
+type Backend interface {
+	ChatClient
+	// Connect joins the channel and calls handler with each message sent in it, blocking until the connection is closed
+	Connect(channelName string, handler func(message ChatMessage)) error
+	// Disconnect closes the connection, making Connect return
+	Disconnect() error
+}
+
+// Creates the backend for the BACKEND setting, either twitch (the default) or irc
+func newBackend(name string, secret string) (Backend, error) {
+	switch name {
+	case "", "twitch":
+		if secret == "" {
+			return nil, errors.New("no SECRET given in .env")
+		}
+		return NewTwitchBackend(secret), nil
+	case "irc":
+		if ircAddress == "" {
+			return nil, errors.New("IRC_ADDRESS must be set to use the irc backend")
+		}
+		return NewIRCBackend(ircAddress, os.Getenv("IRC_TLS") != "false", secret), nil
+	}
+	return nil, errors.New("BACKEND must be twitch or irc")
+}
+
+// Replaces new lines in text the bot sends with spaces, since a new line would let the text send another command to the
+// server
+func stripNewLines(text string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+}
@@ -0,0 +1,139 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// builtInCommand is a command implemented by the bot itself rather than loaded from a command file
+type builtInCommand struct {
+	invocation   string
+	aliases      []string
+	modOnly      bool
+	cooldown     time.Duration
+	userCooldown time.Duration
+	handler      func(client ChatClient, message ChatMessage, arguments []string)
+}
+
+// Returns the command as an InvokableCommand, so it can go through the same checks as commands loaded from files
+func (c builtInCommand) invokableCommand() InvokableCommand {
+	return InvokableCommand{
+		Invocation:   c.invocation,
+		Aliases:      c.aliases,
+		ModOnly:      c.modOnly,
+		Cooldown:     int(c.cooldown / time.Second),
+		UserCooldown: int(c.userCooldown / time.Second),
+	}
+}
+
+// messageListener is called with every message the bot receives, whether or not it invokes a command
+type messageListener func(client ChatClient, message ChatMessage)
+
+var builtInCommands []builtInCommand
+var messageListeners []messageListener
+
+// Guards builtInCommands, which can change while messages are handled (e.g. when a giveaway starts)
+var builtInCommandsMutex sync.RWMutex
+
+// Adds a built-in command, replacing any existing built-in command with the same invocation
+func registerBuiltInCommand(command builtInCommand) {
+	builtInCommandsMutex.Lock()
+	defer builtInCommandsMutex.Unlock()
+	removeBuiltInCommand(command.invocation)
+	builtInCommands = append(builtInCommands, command)
+}
+
+// Removes the built-in command with the given invocation
+func unregisterBuiltInCommand(invocation string) {
+	builtInCommandsMutex.Lock()
+	defer builtInCommandsMutex.Unlock()
+	removeBuiltInCommand(invocation)
+}
+
+func removeBuiltInCommand(invocation string) {
+	var commands []builtInCommand
+	for _, command := range builtInCommands {
+		if command.invocation != invocation {
+			commands = append(commands, command)
+		}
+	}
+	builtInCommands = commands
+}
+
+// Returns whether there is a built-in command with the given invocation or alias
+func hasBuiltInCommand(invocation string) bool {
+	builtInCommandsMutex.RLock()
+	defer builtInCommandsMutex.RUnlock()
+	for _, command := range builtInCommands {
+		if command.invocation == invocation {
+			return true
+		}
+		for _, alias := range command.aliases {
+			if alias == invocation {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Logs a warning for each name of a command loaded from a file that a built-in command already uses, since the
+// built-in command is the one that runs
+func warnIfHiddenByBuiltIn(command InvokableCommand) {
+	for _, name := range append([]string{command.Invocation}, command.Aliases...) {
+		if hasBuiltInCommand(strings.ToLower(name)) {
+			logger.Warn("Command is hidden by a built-in command with the same name", "file", command.filePath, "command", name)
+		}
+	}
+}
+
+// Runs the built-in command for the command string if there is one and returns whether there was one
+func handleBuiltInCommand(handler CommandProcessor, client ChatClient, message ChatMessage, commandString string) bool {
+	builtInCommandsMutex.RLock()
+	commands := append([]builtInCommand(nil), builtInCommands...)
+	builtInCommandsMutex.RUnlock()
+
+	for _, command := range commands {
+		if !handler.HasCommandBeenInvoked(command.invokableCommand(), commandString) {
+			continue
+		}
+		if !canInvoke(handler, command.invokableCommand(), message) {
+			return true
+		}
+
+		recordCommandInvoked(message, command.invocation)
+		command.handler(client, message, getArgumentsFromMessage(message))
+		return true
+	}
+	return false
+}
+
+// Adds a listener that is called with every message before any command is handled
+func registerMessageListener(listener messageListener) {
+	messageListeners = append(messageListeners, listener)
+}
+
+// Returns whether the user who sent the message is a mod or the broadcaster, for built-in commands that are only
+// partly mod only
+func isModerator(message ChatMessage) bool {
+	return message.User.Badges["moderator"] == 1 || message.User.Badges["broadcaster"] == 1
+}
+
+// Returns every word in the message after the command in lower case
+func getArgumentsFromMessage(message ChatMessage) []string {
+	words := strings.Fields(strings.ToLower(parseMessageText(message)))
+	if len(words) < 2 {
+		return nil
+	}
+	return words[1:]
+}
+
+// Returns the text of the message after the command, keeping its case
+func getArgumentTextFromMessage(message ChatMessage) string {
+	parts := strings.SplitN(strings.TrimSpace(parseMessageText(message)), " ", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
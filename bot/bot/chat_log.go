@@ -0,0 +1,354 @@
+package bot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	chatLogDateFormat   = "2006-01-02"
+	chatLogFileSuffix   = ".jsonl"
+	defaultLogsCount    = 3
+	maximumLogsCount    = 10
+	chatLogTimeFormat   = "2006-01-02 15:04"
+	maximumSearchPhrase = 100
+)
+
+// ChatLogEntry is a single chat message in the chat log archive
+type ChatLogEntry struct {
+	Time        time.Time      `json:"time"`
+	Channel     string         `json:"channel"`
+	User        string         `json:"user"`
+	DisplayName string         `json:"display_name"`
+	Badges      map[string]int `json:"badges,omitempty"`
+	MessageID   string         `json:"message_id"`
+	Text        string         `json:"text"`
+}
+
+type chatLogFile struct {
+	date string
+	file *os.File
+}
+
+// ChatArchive writes every chat message to a JSON Lines file per channel per day and deletes files older than the
+// retention period
+type ChatArchive struct {
+	directory     string
+	retentionDays int
+	mutex         sync.Mutex
+	openFiles     map[string]*chatLogFile
+}
+
+var chatArchive *ChatArchive
+
+// NewChatArchive creates a ChatArchive that writes to the given directory and keeps files for the given number of days,
+// or forever if retentionDays is 0
+func NewChatArchive(directory string, retentionDays int) *ChatArchive {
+	return &ChatArchive{
+		directory:     directory,
+		retentionDays: retentionDays,
+		openFiles:     map[string]*chatLogFile{},
+	}
+}
+
+// Sets up the chat log archive and its commands if CHAT_LOG_DIRECTORY is set
+func initChatArchive(directory string, retention string) error {
+	if directory == "" {
+		return nil
+	}
+
+	retentionDays := 0
+	if retention != "" {
+		var err error
+		retentionDays, err = strconv.Atoi(retention)
+		if err != nil || retentionDays < 0 {
+			return fmt.Errorf("CHAT_LOG_RETENTION_DAYS must be a number of days")
+		}
+	}
+
+	chatArchive = NewChatArchive(directory, retentionDays)
+	registerBuiltInCommand(builtInCommand{invocation: "logs", modOnly: true, handler: logsCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "search", modOnly: true, handler: searchCommand})
+	return nil
+}
+
+// Write appends the message to the channel's log file for the day it was sent, moving on to a new file when the day
+// changes
+func (a *ChatArchive) Write(message ChatMessage) error {
+	entry := ChatLogEntry{
+		Time:        message.Time,
+		Channel:     message.Channel,
+		User:        message.User.Name,
+		DisplayName: message.User.DisplayName,
+		Badges:      message.User.Badges,
+		MessageID:   message.ID,
+		Text:        message.Message,
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	logFile, err := a.fileFor(entry.Channel, entry.Time.Format(chatLogDateFormat))
+	if err != nil {
+		return err
+	}
+	_, err = logFile.file.Write(append(line, '\n'))
+	return err
+}
+
+// Returns the open log file for the channel and date, rotating to a new file if the date has changed
+func (a *ChatArchive) fileFor(channelName string, date string) (*chatLogFile, error) {
+	logFile, ok := a.openFiles[channelName]
+	if ok && logFile.date == date {
+		return logFile, nil
+	}
+	if ok {
+		_ = logFile.file.Close()
+		delete(a.openFiles, channelName)
+	}
+
+	channelDirectory := filepath.Join(a.directory, strings.ToLower(channelName))
+	err := os.MkdirAll(channelDirectory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(channelDirectory, date+chatLogFileSuffix), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	logFile = &chatLogFile{date: date, file: file}
+	a.openFiles[channelName] = logFile
+
+	a.removeExpiredFiles(channelDirectory)
+	return logFile, nil
+}
+
+// Deletes the log files in the channel directory that are older than the retention period
+func (a *ChatArchive) removeExpiredFiles(channelDirectory string) {
+	if a.retentionDays == 0 {
+		return
+	}
+
+	oldestDate := time.Now().UTC().AddDate(0, 0, -a.retentionDays).Format(chatLogDateFormat)
+	files, err := ioutil.ReadDir(channelDirectory)
+	if err != nil {
+		logger.Warn("Error reading chat log directory", "directory", channelDirectory, "error", err)
+		return
+	}
+
+	for _, file := range files {
+		date := strings.TrimSuffix(file.Name(), chatLogFileSuffix)
+		if !file.IsDir() && strings.HasSuffix(file.Name(), chatLogFileSuffix) && date < oldestDate {
+			err := os.Remove(filepath.Join(channelDirectory, file.Name()))
+			if err != nil {
+				logger.Warn("Error removing expired chat log", "file", file.Name(), "error", err)
+			}
+		}
+	}
+}
+
+// Close closes any open log files
+func (a *ChatArchive) Close() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for channelName, logFile := range a.openFiles {
+		_ = logFile.file.Close()
+		delete(a.openFiles, channelName)
+	}
+}
+
+// Search returns up to limit of the most recent entries in the channel's logs that match, oldest first
+func (a *ChatArchive) Search(channelName string, match func(entry ChatLogEntry) bool, limit int) ([]ChatLogEntry, error) {
+	files, err := chatLogFiles(filepath.Join(a.directory, strings.ToLower(channelName)))
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []ChatLogEntry
+	for i := len(files) - 1; i >= 0 && len(matches) < limit; i-- {
+		entries, err := readChatLogFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := len(entries) - 1; j >= 0 && len(matches) < limit; j-- {
+			if match(entries[j]) {
+				matches = append(matches, entries[j])
+			}
+		}
+	}
+
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches, nil
+}
+
+// Returns the paths of the log files in a channel's directory, oldest first
+func chatLogFiles(channelDirectory string) ([]string, error) {
+	files, err := ioutil.ReadDir(channelDirectory)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), chatLogFileSuffix) {
+			paths = append(paths, filepath.Join(channelDirectory, file.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Reads every entry in a log file, skipping any lines that are not valid entries
+func readChatLogFile(filePath string) ([]ChatLogEntry, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []ChatLogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry ChatLogEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// GrepChatLogs writes every entry in the logs in directory whose text matches the pattern to out, optionally only
+// including entries from the given channel and user
+func GrepChatLogs(directory string, channelName string, user string, pattern *regexp.Regexp, out io.Writer) error {
+	channels := []string{channelName}
+	if channelName == "" {
+		directories, err := ioutil.ReadDir(directory)
+		if err != nil {
+			return err
+		}
+		channels = nil
+		for _, channelDirectory := range directories {
+			if channelDirectory.IsDir() {
+				channels = append(channels, channelDirectory.Name())
+			}
+		}
+	}
+
+	for _, logChannel := range channels {
+		files, err := chatLogFiles(filepath.Join(directory, strings.ToLower(logChannel)))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			entries, err := readChatLogFile(file)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if (user == "" || strings.EqualFold(entry.User, user)) && pattern.MatchString(entry.Text) {
+					_, _ = fmt.Fprintf(out, "%s #%s %s: %s\n", entry.Time.Format(time.RFC3339), entry.Channel, entry.User, entry.Text)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Formats a log entry to be sent in chat
+func formatChatLogEntry(entry ChatLogEntry) string {
+	return fmt.Sprintf("[%s] %s: %s", entry.Time.Format(chatLogTimeFormat), entry.User, entry.Text)
+}
+
+// !logs <user> [n] sends the user's last n messages in chat
+func logsCommand(client ChatClient, message ChatMessage, arguments []string) {
+	if len(arguments) == 0 {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"logs <user> [number of messages]")
+		return
+	}
+
+	user := strings.TrimPrefix(arguments[0], "@")
+	count := defaultLogsCount
+	if len(arguments) > 1 {
+		parsed, err := strconv.Atoi(arguments[1])
+		if err != nil || parsed < 1 {
+			client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"logs <user> [number of messages]")
+			return
+		}
+		count = parsed
+	}
+	if count > maximumLogsCount {
+		count = maximumLogsCount
+	}
+
+	entries, err := chatArchive.Search(message.Channel, func(entry ChatLogEntry) bool {
+		return strings.EqualFold(entry.User, user) && entry.MessageID != message.ID
+	}, count)
+	if err != nil {
+		messageLogger(message).Error("Error searching chat logs", "error", err)
+		client.Say(message.Channel, "Could not search the chat logs")
+		return
+	}
+
+	if len(entries) == 0 {
+		client.Say(message.Channel, "No messages found from "+user)
+		return
+	}
+	for _, entry := range entries {
+		client.Say(message.Channel, formatChatLogEntry(entry))
+	}
+}
+
+// !search <phrase> sends the number of messages containing the phrase and the most recent one
+func searchCommand(client ChatClient, message ChatMessage, arguments []string) {
+	phrase := strings.Join(arguments, " ")
+	if phrase == "" || len(phrase) > maximumSearchPhrase {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"search <phrase>")
+		return
+	}
+
+	entries, err := chatArchive.Search(message.Channel, func(entry ChatLogEntry) bool {
+		return entry.MessageID != message.ID && strings.Contains(strings.ToLower(entry.Text), phrase)
+	}, maximumLogsCount)
+	if err != nil {
+		messageLogger(message).Error("Error searching chat logs", "error", err)
+		client.Say(message.Channel, "Could not search the chat logs")
+		return
+	}
+
+	if len(entries) == 0 {
+		client.Say(message.Channel, "No messages found containing '"+phrase+"'")
+		return
+	}
+	found := strconv.Itoa(len(entries))
+	if len(entries) == maximumLogsCount {
+		found += "+"
+	}
+	client.Say(message.Channel, fmt.Sprintf("%s messages found containing '%s', most recent: %s", found, phrase, formatChatLogEntry(entries[len(entries)-1])))
+}
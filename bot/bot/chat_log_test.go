@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sets up an empty chat archive with the chat log commands registered
+func setUpChatArchive(t *testing.T) func() {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix = "!"
+	channel = "testchannel"
+	IntervalMessageList = nil
+	InvokableCommandList = nil
+	builtInCommands = nil
+	err = initChatArchive(directory, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		chatArchive.Close()
+		chatArchive = nil
+		builtInCommands = nil
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func chatMessage(user string, text string, id string, sent time.Time) ChatMessage {
+	message := newChannelMessage(user, nil, text, id)
+	message.Time = sent
+	return message
+}
+
+func TestChatArchive_WritesPerChannelPerDay(t *testing.T) {
+	cleanUp := setUpChatArchive(t)
+	defer cleanUp()
+
+	today := time.Now().UTC()
+	yesterday := today.AddDate(0, 0, -1)
+	_ = chatArchive.Write(chatMessage("viewer", "first", "1", yesterday))
+	_ = chatArchive.Write(chatMessage("viewer", "second", "2", today))
+	_ = chatArchive.Write(chatMessage("viewer", "third", "3", today))
+
+	entries, err := readChatLogFile(filepath.Join(chatArchive.directory, "testchannel", today.Format(chatLogDateFormat)+".jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Text != "second" || entries[1].MessageID != "3" {
+		t.Errorf("Test Failed: Expected today's log to contain the second and third messages but was %+v", entries)
+	}
+
+	entries, _ = readChatLogFile(filepath.Join(chatArchive.directory, "testchannel", yesterday.Format(chatLogDateFormat)+".jsonl"))
+	if len(entries) != 1 || entries[0].Text != "first" {
+		t.Errorf("Test Failed: Expected yesterday's log to contain the first message but was %+v", entries)
+	}
+}
+
+func TestChatArchive_RemovesExpiredFiles(t *testing.T) {
+	cleanUp := setUpChatArchive(t)
+	defer cleanUp()
+
+	old := time.Now().UTC().AddDate(0, 0, -3)
+	_ = chatArchive.Write(chatMessage("viewer", "old", "1", old))
+	_ = chatArchive.Write(chatMessage("viewer", "new", "2", time.Now()))
+
+	files, _ := chatLogFiles(filepath.Join(chatArchive.directory, "testchannel"))
+	if len(files) != 1 || !strings.HasSuffix(files[0], time.Now().UTC().Format(chatLogDateFormat)+".jsonl") {
+		t.Errorf("Test Failed: Expected only today's log to be kept but was %v", files)
+	}
+}
+
+func TestLogsCommand(t *testing.T) {
+	cleanUp := setUpChatArchive(t)
+	defer cleanUp()
+
+	client := RecordingChatClient{}
+	handler := CommandHandler{}
+	onMessage(&handler, &client, chatMessage("viewer", "one", "1", time.Now()))
+	onMessage(&handler, &client, chatMessage("other", "not me", "2", time.Now()))
+	onMessage(&handler, &client, chatMessage("viewer", "two", "3", time.Now()))
+	onMessage(&handler, &client, chatMessage("viewer", "three", "4", time.Now()))
+
+	moderator := chatMessage("moderator", "!logs viewer 2", "5", time.Now())
+	moderator.User.Badges = map[string]int{"moderator": 1}
+	onMessage(&handler, &client, moderator)
+
+	if len(client.Messages) != 2 || !strings.HasSuffix(client.Messages[0], "viewer: two") || !strings.HasSuffix(client.Messages[1], "viewer: three") {
+		t.Errorf("Test Failed: Expected the last 2 messages from viewer but was %v", client.Messages)
+	}
+}
+
+func TestLogsCommand_NotMod(t *testing.T) {
+	cleanUp := setUpChatArchive(t)
+	defer cleanUp()
+
+	client := RecordingChatClient{}
+	onMessage(&CommandHandler{}, &client, chatMessage("viewer", "!logs viewer", "1", time.Now()))
+
+	if len(client.Messages) != 0 {
+		t.Errorf("Test Failed: Expected no response to a non mod but was %v", client.Messages)
+	}
+}
+
+func TestSearchCommand(t *testing.T) {
+	cleanUp := setUpChatArchive(t)
+	defer cleanUp()
+
+	client := RecordingChatClient{}
+	handler := CommandHandler{}
+	onMessage(&handler, &client, chatMessage("viewer", "When is the STREAM tomorrow?", "1", time.Now()))
+	onMessage(&handler, &client, chatMessage("other", "the stream is great", "2", time.Now()))
+	onMessage(&handler, &client, chatMessage("other", "hello", "3", time.Now()))
+
+	moderator := chatMessage("moderator", "!search the stream", "4", time.Now())
+	moderator.User.Badges = map[string]int{"moderator": 1}
+	onMessage(&handler, &client, moderator)
+
+	if len(client.Messages) != 1 || !strings.HasPrefix(client.Messages[0], "2 messages found containing 'the stream', most recent:") || !strings.HasSuffix(client.Messages[0], "other: the stream is great") {
+		t.Errorf("Test Failed: Expected 2 messages to be found but was %v", client.Messages)
+	}
+}
+
+func TestGrepChatLogs(t *testing.T) {
+	cleanUp := setUpChatArchive(t)
+	defer cleanUp()
+
+	_ = chatArchive.Write(chatMessage("viewer", "hello there", "1", time.Now()))
+	_ = chatArchive.Write(chatMessage("other", "hello", "2", time.Now()))
+	_ = chatArchive.Write(chatMessage("viewer", "goodbye", "3", time.Now()))
+
+	var out bytes.Buffer
+	err := GrepChatLogs(chatArchive.directory, "", "viewer", regexp.MustCompile("hel+o"), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out.String(), "\n") != 1 || !strings.Contains(out.String(), "#testchannel viewer: hello there") {
+		t.Error("Test Failed: Expected only viewer's hello message but was: " + out.String())
+	}
+}
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How a chat trigger's pattern is matched against messages
+const (
+	triggerMatchKeyword = "keyword"
+	triggerMatchPhrase  = "phrase"
+	triggerMatchRegex   = "regex"
+)
+
+// The roles a chat trigger can be limited to, each including the roles after it
+var triggerPermissions = []string{"broadcaster", "moderator", "vip", "subscriber", "everyone"}
+
+// ChatTrigger responds to chat messages that match its pattern without needing a prefix, loaded from a `.trigger.json`
+// file named after the trigger
+type ChatTrigger struct {
+	// Either keyword (the default) to match the pattern as whole words, phrase to match it anywhere in the message, or
+	// regex to match it as a regular expression whose capture groups can be used in Message as $1, $2 and so on
+	Match   string `json:"match,omitempty"`
+	Pattern string `json:"pattern"`
+	Message string `json:"message"`
+	// Seconds before the trigger can respond again in the channel, and to the same user. Mods skip cooldowns
+	Cooldown     int `json:"cooldown,omitempty"`
+	UserCooldown int `json:"user_cooldown,omitempty"`
+	// The chance of responding to a matching message, from 0 to 1 (defaults to 1)
+	Chance float64 `json:"chance"`
+	// The lowest role that can set off the trigger, one of everyone (the default), subscriber, vip, moderator or
+	// broadcaster
+	Permission string `json:"permission,omitempty"`
+	Disabled   bool   `json:"disabled,omitempty"`
+	name       string
+	filePath   string
+	expression *regexp.Regexp
+}
+
+// Guarded by commandsMutex, like the commands loaded from the same folder
+var ChatTriggerList []ChatTrigger
+
+// Returns a copy of the loaded chat triggers that is safe to use while triggers are being changed
+func chatTriggers() []ChatTrigger {
+	commandsMutex.RLock()
+	defer commandsMutex.RUnlock()
+	return append([]ChatTrigger(nil), ChatTriggerList...)
+}
+
+func loadChatTrigger(filePath string, fileData []byte) error {
+	trigger := ChatTrigger{Chance: 1}
+	err := json.Unmarshal(fileData, &trigger)
+	if err != nil {
+		return err
+	}
+	trigger.name = strings.ToLower(strings.TrimSuffix(filepath.Base(filePath), ".trigger.json"))
+	trigger.filePath = filePath
+
+	err = compileChatTrigger(&trigger)
+	if err != nil {
+		return errors.New("error importing trigger " + trigger.name + ": " + err.Error())
+	}
+
+	commandsMutex.Lock()
+	ChatTriggerList = append(ChatTriggerList, trigger)
+	commandsMutex.Unlock()
+	return nil
+}
+
+// Checks the trigger's settings and compiles its pattern
+func compileChatTrigger(trigger *ChatTrigger) error {
+	if trigger.Pattern == "" {
+		return errors.New("pattern must not be empty")
+	}
+	if trigger.Message == "" {
+		return errors.New("message must not be empty")
+	}
+	if trigger.Chance < 0 || trigger.Chance > 1 {
+		return errors.New("chance must be between 0 and 1")
+	}
+	if trigger.Cooldown < 0 || trigger.UserCooldown < 0 {
+		return errors.New("cooldown and user_cooldown must not be negative")
+	}
+	if trigger.Permission == "" {
+		trigger.Permission = "everyone"
+	}
+	if triggerPermissionRank(trigger.Permission) < 0 {
+		return errors.New("permission must be one of " + strings.Join(triggerPermissions, ", "))
+	}
+
+	var err error
+	switch trigger.Match {
+	case "", triggerMatchKeyword:
+		trigger.Match = triggerMatchKeyword
+		trigger.expression, err = regexp.Compile(`(?i)(^|\W)` + regexp.QuoteMeta(trigger.Pattern) + `($|\W)`)
+	case triggerMatchPhrase:
+		trigger.expression, err = regexp.Compile(`(?i)` + regexp.QuoteMeta(trigger.Pattern))
+	case triggerMatchRegex:
+		trigger.expression, err = regexp.Compile(trigger.Pattern)
+	default:
+		return errors.New("unknown match '" + trigger.Match + "'")
+	}
+	return err
+}
+
+// Returns where the role is in triggerPermissions, or -1 if it isn't one
+func triggerPermissionRank(role string) int {
+	for i, permission := range triggerPermissions {
+		if permission == role {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns whether the sender of the message has the role the trigger needs, or a higher one
+func (t ChatTrigger) allows(message ChatMessage) bool {
+	if t.Permission == "everyone" {
+		return true
+	}
+	for _, role := range triggerPermissions[:triggerPermissionRank(t.Permission)+1] {
+		if message.User.Badges[role] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the trigger's response to the message, or false if the message doesn't match
+func (t ChatTrigger) respond(handler CommandProcessor, message ChatMessage) (string, bool) {
+	groups := t.expression.FindStringSubmatch(message.Message)
+	if groups == nil {
+		return "", false
+	}
+
+	response := handler.ReplaceReservedKeywordsWithValues(t.Message, message)
+	if t.Match == triggerMatchRegex {
+		// Replaced from the last group so $1 doesn't replace the start of $10
+		for i := len(groups) - 1; i > 0; i-- {
+			response = strings.Replace(response, "$"+strconv.Itoa(i), groups[i], -1)
+		}
+	}
+	return response, true
+}
+
+// Responds to the message with every trigger it sets off. Commands and the bot's own messages don't set off triggers
+func runChatTriggers(handler CommandProcessor, client ChatClient, message ChatMessage) {
+	if strings.EqualFold(message.User.Name, nickname) {
+		return
+	}
+
+	for _, trigger := range chatTriggers() {
+		if trigger.Disabled || !trigger.allows(message) {
+			continue
+		}
+		response, matched := trigger.respond(handler, message)
+		if !matched {
+			continue
+		}
+
+		messageLog := messageLogger(message).With("trigger", trigger.name)
+		if trigger.Chance < 1 && rand.Float64() >= trigger.Chance {
+			messageLog.Debug("Trigger matched but did not roll its chance")
+			continue
+		}
+		cooldown := time.Duration(trigger.Cooldown) * time.Second
+		userCooldown := time.Duration(trigger.UserCooldown) * time.Second
+		if remaining := cooldowns.Use(message, "trigger:"+trigger.name, cooldown, userCooldown); remaining > 0 {
+			messageLog.Debug("Trigger is on cooldown", "remaining", remaining.String())
+			continue
+		}
+
+		messageLog.Info("Trigger matched")
+		client.Say(message.Channel, response)
+	}
+}
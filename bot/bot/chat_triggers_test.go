@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// Writes a chat trigger file and loads it
+func loadTestTrigger(t *testing.T, name string, data string) error {
+	filePath := filepath.Join(commandsDirectory, name+".trigger.json")
+	err := ioutil.WriteFile(filePath, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loadCommandDataFromFile(filePath)
+}
+
+func TestChatTriggers_MatchKeywordsPhrasesAndRegexes(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	cooldowns = NewCooldownTracker()
+	InvokableCommandList = []InvokableCommand{{Invocation: "schedule", Message: "Mondays and Fridays"}}
+
+	for name, data := range map[string]string{
+		"schedule": `{"pattern": "schedule", "message": "Type !schedule for the schedule, $username"}`,
+		"discord":  `{"match": "phrase", "pattern": "discord server", "message": "Join the Discord!"}`,
+		"stream":   `{"match": "regex", "pattern": "(?i)when is the (next )?(stream|vod)\\?", "message": "The $2 is on Monday"}`,
+	} {
+		if err := loadTestTrigger(t, name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "what's the Schedule?"},
+		testMessage{user: "viewer", text: "schedules are hard"},
+		testMessage{user: "viewer", text: "!schedule"},
+		testMessage{user: "viewer", text: "is there a discord server"},
+		testMessage{user: "viewer", text: "When is the next stream?"},
+		testMessage{user: "goatbot", text: "When is the stream?"},
+	)
+	expectMessages(t, []string{
+		"Type !schedule for the schedule, viewer",
+		"Mondays and Fridays",
+		"Join the Discord!",
+		"The stream is on Monday",
+	}, client.messages)
+}
+
+func TestChatTriggers_CooldownsChanceAndPermissions(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	cooldowns = NewCooldownTracker()
+
+	for name, data := range map[string]string{
+		"hi":     `{"pattern": "hi", "message": "Hello!", "cooldown": 60}`,
+		"never":  `{"pattern": "hi", "message": "Never sent", "chance": 0}`,
+		"subs":   `{"pattern": "perks", "message": "Thanks for subscribing!", "permission": "subscriber"}`,
+		"broken": `{"pattern": "oops", "message": "Broken", "permission": "admin"}`,
+	} {
+		err := loadTestTrigger(t, name, data)
+		if (name == "broken") != (err != nil) {
+			t.Errorf("Test Failed: Unexpected result loading the %s trigger: %v", name, err)
+		}
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "hi"},
+		testMessage{user: "other", text: "hi"},
+		testMessage{user: "viewer", text: "perks?"},
+		testMessage{user: "subscriber", badges: map[string]int{"subscriber": 12}, text: "perks?"},
+		testMessage{user: "mod", badges: map[string]int{"moderator": 1}, text: "perks?"},
+		testMessage{user: "oops", text: "oops"},
+	)
+	expectMessages(t, []string{"Hello!", "Thanks for subscribing!", "Thanks for subscribing!"}, client.messages)
+
+	unloadFile(filepath.Join(commandsDirectory, "hi.trigger.json"))
+	if len(chatTriggers()) != 2 {
+		t.Errorf("Test Failed: Expected unloading the file to remove its trigger but there were %d", len(chatTriggers()))
+	}
+}
@@ -2,53 +2,63 @@ package bot
 
 import (
 	"errors"
-	"github.com/gempir/go-twitch-irc/v2"
 	"math"
 	"strings"
+	"sync/atomic"
 )
 
 var messageCount uint32 = 0
 
 type CommandProcessor interface {
-	IncrementMessageCount(message twitch.PrivateMessage)
+	IncrementMessageCount(message ChatMessage)
 	HandleIntervalMessage(client ChatClient)
-	HasPermissionToInvoke(command InvokableCommand, message twitch.PrivateMessage) bool
+	HasPermissionToInvoke(command InvokableCommand, message ChatMessage) bool
 	HasCommandBeenInvoked(command InvokableCommand, commandString string) bool
-	GetCommandStringFromMessage(message twitch.PrivateMessage) (error, string)
-	GetParametersFromMessage(message twitch.PrivateMessage, command InvokableCommand) (error, []string)
-	ReplaceReservedKeywordsWithValues(commandMessage string, message twitch.PrivateMessage) string
+	GetCommandStringFromMessage(message ChatMessage) (error, string)
+	GetParametersFromMessage(message ChatMessage, command InvokableCommand) (error, []string)
+	ReplaceReservedKeywordsWithValues(commandMessage string, message ChatMessage) string
 	ReplaceCommandPlaceholdersWithValues(commandMessage string, parameters []CommandParameter, messageParameters []string) string
 }
 
 type CommandHandler struct{}
 
 // IncrementMessageCount increments the message count (excluding messages from the bot)
-func (h *CommandHandler) IncrementMessageCount(message twitch.PrivateMessage) {
-	if messageCount == math.MaxUint32-1 {
-		messageCount = 0
+func (h *CommandHandler) IncrementMessageCount(message ChatMessage) {
+	if atomic.LoadUint32(&messageCount) == math.MaxUint32-1 {
+		atomic.StoreUint32(&messageCount, 0)
 	}
 
 	if message.User.Name != nickname {
-		messageCount += 1
+		atomic.AddUint32(&messageCount, 1)
 	}
 }
 
 // HandleIntervalMessage goes through the IntervalMessageList and sends a message if it is time to send that message
 func (h *CommandHandler) HandleIntervalMessage(client ChatClient) {
-	for _, intervalMessage := range IntervalMessageList {
-		if messageCount%uint32(intervalMessage.MessageInterval) == uint32(0) {
+	count := atomic.LoadUint32(&messageCount)
+	for _, intervalMessage := range intervalMessages() {
+		if !intervalMessage.Disabled && count%uint32(intervalMessage.MessageInterval) == uint32(0) {
 			client.Say(channel, intervalMessage.Message)
 		}
 	}
 }
 
+// HasCommandBeenInvoked returns true if the command string is the command's invocation or one of its aliases, ignoring
+// case unless the command is case sensitive
 func (h *CommandHandler) HasCommandBeenInvoked(command InvokableCommand, commandString string) bool {
-	if commandString == command.Invocation {
+	matches := func(invocation string) bool {
+		if command.CaseSensitive {
+			return commandString == invocation
+		}
+		return strings.EqualFold(commandString, invocation)
+	}
+
+	if matches(command.Invocation) {
 		return true
 	}
 
 	for _, alias := range command.Aliases {
-		if commandString == alias {
+		if matches(alias) {
 			return true
 		}
 	}
@@ -57,12 +67,12 @@ func (h *CommandHandler) HasCommandBeenInvoked(command InvokableCommand, command
 }
 
 // HasPermissionToInvoke returns true if a command is mod only and the user invoking the command is a mod or broadcaster, or if the command is not mod only
-func (h *CommandHandler) HasPermissionToInvoke(command InvokableCommand, message twitch.PrivateMessage) bool {
+func (h *CommandHandler) HasPermissionToInvoke(command InvokableCommand, message ChatMessage) bool {
 	return !command.ModOnly || (command.ModOnly && (message.User.Badges["moderator"] == 1) || (message.User.Badges["broadcaster"] == 1))
 }
 
-// GetCommandStringFromMessage returns the command string used to invoke the command
-func (h *CommandHandler) GetCommandStringFromMessage(message twitch.PrivateMessage) (error, string) {
+// GetCommandStringFromMessage returns the command string used to invoke the command, as it was typed
+func (h *CommandHandler) GetCommandStringFromMessage(message ChatMessage) (error, string) {
 	messageText := parseMessageText(message)
 	command := strings.Split(messageText, " ")[0]
 	if command != "" {
@@ -73,7 +83,7 @@ func (h *CommandHandler) GetCommandStringFromMessage(message twitch.PrivateMessa
 }
 
 // GetParametersFromMessage returns the parameters used when invoking a command
-func (h *CommandHandler) GetParametersFromMessage(message twitch.PrivateMessage, command InvokableCommand) (error, []string) {
+func (h *CommandHandler) GetParametersFromMessage(message ChatMessage, command InvokableCommand) (error, []string) {
 	var numParameters = len(command.Parameters)
 	messageText := parseMessageText(message)
 	messageWords := strings.Split(messageText, " ")
@@ -87,8 +97,9 @@ func (h *CommandHandler) GetParametersFromMessage(message twitch.PrivateMessage,
 }
 
 // ReplaceReservedKeywordsWithValues returns the message with the reserved keywords replaced with their values
-func (h *CommandHandler) ReplaceReservedKeywordsWithValues(commandMessage string, message twitch.PrivateMessage) string {
+func (h *CommandHandler) ReplaceReservedKeywordsWithValues(commandMessage string, message ChatMessage) string {
 	var formattedMessage = commandMessage
+	formattedMessage = replaceUserStatsKeywords(formattedMessage, message)
 	formattedMessage = strings.Replace(formattedMessage, "$username", message.User.Name, -1)
 	return formattedMessage
 }
@@ -102,8 +113,8 @@ func (h *CommandHandler) ReplaceCommandPlaceholdersWithValues(commandMessage str
 	return formattedMessage
 }
 
-// Returns the content of the message without the prefix
-func parseMessageText(message twitch.PrivateMessage) string {
-	messageText := message.Message[len(prefix):]
-	return strings.ToLower(messageText)
+// Returns the content of the message without the prefix or mention of the bot, keeping its case
+func parseMessageText(message ChatMessage) string {
+	text, _ := commandText(message)
+	return text
 }
@@ -1,7 +1,6 @@
 package bot
 
 import (
-	"github.com/gempir/go-twitch-irc/v2"
 	"log"
 	"math"
 	"strconv"
@@ -24,7 +23,7 @@ func TestIncrementMessageCount_NormalIncrement(t *testing.T) {
 	nickname = "test"
 
 	handler := CommandHandler{}
-	handler.IncrementMessageCount(twitch.PrivateMessage{User: twitch.User{Name: "different"}})
+	handler.IncrementMessageCount(ChatMessage{User: ChatUser{Name: "different"}})
 	if messageCount != 1 {
 		t.Error("Test Failed: Expected messageCount to be 1 but was " + strconv.FormatInt(int64(messageCount), 10))
 	}
@@ -34,7 +33,7 @@ func TestIncrementMessageCount_MessageFromBot(t *testing.T) {
 	messageCount = 0
 	nickname = "test"
 	handler := CommandHandler{}
-	handler.IncrementMessageCount(twitch.PrivateMessage{User: twitch.User{Name: "test"}})
+	handler.IncrementMessageCount(ChatMessage{User: ChatUser{Name: "test"}})
 	if messageCount != 0 {
 		t.Error("Test Failed: Expected messageCount to be 0 but was " + strconv.FormatInt(int64(messageCount), 10))
 	}
@@ -44,7 +43,7 @@ func TestIncrementMessageCount_MaxMessageCount(t *testing.T) {
 	messageCount = math.MaxUint32 - 1
 	nickname = "test"
 	handler := CommandHandler{}
-	handler.IncrementMessageCount(twitch.PrivateMessage{User: twitch.User{Name: "different"}})
+	handler.IncrementMessageCount(ChatMessage{User: ChatUser{Name: "different"}})
 	if messageCount != 1 {
 		t.Error("Test Failed: Expected messageCount to be 1 but was " + strconv.FormatInt(int64(messageCount), 10))
 	}
@@ -173,13 +172,34 @@ func TestHasCommandBeenInvoked_NotInvoked(t *testing.T) {
 	}
 }
 
+func TestHasCommandBeenInvoked_IgnoresCase(t *testing.T) {
+	handler := CommandHandler{}
+	command := InvokableCommand{Invocation: "invoke", Aliases: []string{"alias1"}}
+
+	if !handler.HasCommandBeenInvoked(command, "Invoke") || !handler.HasCommandBeenInvoked(command, "ALIAS1") {
+		t.Error("Test Failed: Expected the command to be invoked regardless of case")
+	}
+}
+
+func TestHasCommandBeenInvoked_CaseSensitive(t *testing.T) {
+	handler := CommandHandler{}
+	command := InvokableCommand{Invocation: "GG", Aliases: []string{"Gg"}, CaseSensitive: true}
+
+	if !handler.HasCommandBeenInvoked(command, "GG") || !handler.HasCommandBeenInvoked(command, "Gg") {
+		t.Error("Test Failed: Expected the command to be invoked when typed with the same case")
+	}
+	if handler.HasCommandBeenInvoked(command, "gg") {
+		t.Error("Test Failed: Expected a case sensitive command not to be invoked when typed with a different case")
+	}
+}
+
 func TestHasPermissionToInvoke_NotModOnlyCommand(t *testing.T) {
 	testCommand := InvokableCommand{
 		ModOnly: false,
 	}
 
-	testMessage := twitch.PrivateMessage{
-		User: twitch.User{},
+	testMessage := ChatMessage{
+		User: ChatUser{},
 	}
 
 	handler := CommandHandler{}
@@ -195,8 +215,8 @@ func TestHasPermissionToInvoke_ModOnlyCommandNotMod(t *testing.T) {
 		ModOnly: true,
 	}
 
-	testMessage := twitch.PrivateMessage{
-		User: twitch.User{
+	testMessage := ChatMessage{
+		User: ChatUser{
 			Badges: nil,
 		},
 	}
@@ -213,8 +233,8 @@ func TestHasPermissionToInvoke_ModOnlyCommandBroadcaster(t *testing.T) {
 		ModOnly: true,
 	}
 
-	var testMessage = twitch.PrivateMessage{
-		User: twitch.User{Badges: map[string]int{
+	var testMessage = ChatMessage{
+		User: ChatUser{Badges: map[string]int{
 			"broadcaster": 1,
 		}},
 	}
@@ -232,8 +252,8 @@ func TestHasPermissionToInvoke_ModOnlyCommandModerator(t *testing.T) {
 		ModOnly: true,
 	}
 
-	var testMessage = twitch.PrivateMessage{
-		User: twitch.User{Badges: map[string]int{
+	var testMessage = ChatMessage{
+		User: ChatUser{Badges: map[string]int{
 			"moderator": 1,
 		}},
 	}
@@ -251,7 +271,7 @@ func TestGetParametersFromMessage_MismatchingNumberOfParameters(t *testing.T) {
 	command := InvokableCommand{Parameters: []CommandParameter{{Name: "test"}, {Name: "another"}}}
 
 	handler := CommandHandler{}
-	err, result := handler.GetParametersFromMessage(twitch.PrivateMessage{Message: "!command first"}, command)
+	err, result := handler.GetParametersFromMessage(ChatMessage{Message: "!command first"}, command)
 
 	if err == nil {
 		t.Error("Test Failed: Expected error but was nil")
@@ -272,7 +292,7 @@ func TestGetParametersFromMessage_ValidNumberOfParameters(t *testing.T) {
 	command := InvokableCommand{Parameters: []CommandParameter{{Name: "test"}, {Name: "another"}}}
 
 	handler := CommandHandler{}
-	err, result := handler.GetParametersFromMessage(twitch.PrivateMessage{Message: "!command first second"}, command)
+	err, result := handler.GetParametersFromMessage(ChatMessage{Message: "!command first second"}, command)
 
 	if err != nil {
 		t.Error("Test Failed: Expected no error but was: " + err.Error())
@@ -283,9 +303,24 @@ func TestGetParametersFromMessage_ValidNumberOfParameters(t *testing.T) {
 	}
 }
 
+func TestGetParametersFromMessage_KeepsCase(t *testing.T) {
+	prefix = "!"
+	command := InvokableCommand{Parameters: []CommandParameter{{Name: "game"}}}
+
+	handler := CommandHandler{}
+	err, result := handler.GetParametersFromMessage(ChatMessage{Message: "!LURK Minecraft"}, command)
+
+	if err != nil {
+		t.Error("Test Failed: Expected no error but was: " + err.Error())
+	}
+	if len(result) != 1 || result[0] != "Minecraft" {
+		t.Errorf("Test Failed: Expected the parameter to keep its case but was %v", result)
+	}
+}
+
 func TestReplaceReservedKeywordsWithValues_ReplaceUsernameOnce(t *testing.T) {
 	handler := CommandHandler{}
-	result := handler.ReplaceReservedKeywordsWithValues("hello $username", twitch.PrivateMessage{User: twitch.User{Name: "testUsername"}})
+	result := handler.ReplaceReservedKeywordsWithValues("hello $username", ChatMessage{User: ChatUser{Name: "testUsername"}})
 	if result != "hello testUsername" {
 		t.Error("Test Failed: Expected result to be 'hello testUsername' but was : " + result)
 	}
@@ -293,7 +328,7 @@ func TestReplaceReservedKeywordsWithValues_ReplaceUsernameOnce(t *testing.T) {
 
 func TestReplaceReservedKeywordsWithValues_ReplaceUsernameMultipleTimes(t *testing.T) {
 	handler := CommandHandler{}
-	result := handler.ReplaceReservedKeywordsWithValues("hello $username and $username", twitch.PrivateMessage{User: twitch.User{Name: "testUsername"}})
+	result := handler.ReplaceReservedKeywordsWithValues("hello $username and $username", ChatMessage{User: ChatUser{Name: "testUsername"}})
 	if result != "hello testUsername and testUsername" {
 		t.Error("Test Failed: Expected result to be 'hello testUsername and testUsername' but was : " + result)
 	}
@@ -326,7 +361,7 @@ func TestReplaceCommandPlaceholdersWithValues_ValidMultipleReplacementsOfMultipl
 func TestParseMessageText_SingleCharacterPrefixMultiWordMessage(t *testing.T) {
 	prefix = "!"
 	testMessage := "!this is a test message"
-	result := parseMessageText(twitch.PrivateMessage{Message: testMessage})
+	result := parseMessageText(ChatMessage{Message: testMessage})
 	if result != "this is a test message" {
 		t.Error("Test Failed: Expected to be 'this is a test message' but was " + result)
 	}
@@ -335,7 +370,7 @@ func TestParseMessageText_SingleCharacterPrefixMultiWordMessage(t *testing.T) {
 func TestParseMessageText_SingleCharacterPrefixSingleWordMessage(t *testing.T) {
 	prefix = "!"
 	testMessage := "!this"
-	result := parseMessageText(twitch.PrivateMessage{Message: testMessage})
+	result := parseMessageText(ChatMessage{Message: testMessage})
 	if result != "this" {
 		t.Error("Test Failed: Expected to be 'this' but was " + result)
 	}
@@ -344,7 +379,7 @@ func TestParseMessageText_SingleCharacterPrefixSingleWordMessage(t *testing.T) {
 func TestParseMessageText_MultiCharacterPrefixMultiWordMessage(t *testing.T) {
 	prefix = "prefix "
 	testMessage := "prefix this is a test"
-	result := parseMessageText(twitch.PrivateMessage{Message: testMessage})
+	result := parseMessageText(ChatMessage{Message: testMessage})
 	if result != "this is a test" {
 		t.Error("Test Failed: Expected to be 'this is a test' but was " + result)
 	}
@@ -353,16 +388,16 @@ func TestParseMessageText_MultiCharacterPrefixMultiWordMessage(t *testing.T) {
 func TestParseMessageText_SingleCharacterPrefixMixCases(t *testing.T) {
 	prefix = "!"
 	testMessage := "!this is a TEST"
-	result := parseMessageText(twitch.PrivateMessage{Message: testMessage})
-	if result != "this is a test" {
-		t.Error("Test Failed: Expected to be 'this is a test' but was " + result)
+	result := parseMessageText(ChatMessage{Message: testMessage})
+	if result != "this is a TEST" {
+		t.Error("Test Failed: Expected to be 'this is a TEST' but was " + result)
 	}
 }
 
 func TestParseMessageText_JustPrefix(t *testing.T) {
 	prefix = "!"
 	testMessage := "!"
-	result := parseMessageText(twitch.PrivateMessage{Message: testMessage})
+	result := parseMessageText(ChatMessage{Message: testMessage})
 	if result != "" {
 		t.Error("Test Failed: Expected to be '' but was " + result)
 	}
@@ -0,0 +1,152 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CommandTestCase is a single message sent to the bot in a command fixture and the messages the bot is expected to send in response
+type CommandTestCase struct {
+	User     string         `json:"user"`
+	Badges   map[string]int `json:"badges"`
+	Message  string         `json:"message"`
+	Expected []string       `json:"expected"`
+}
+
+// RecordingChatClient is a ChatClient that records every message it is asked to send
+type RecordingChatClient struct {
+	Messages []string
+}
+
+// Say records the message instead of sending it
+func (c *RecordingChatClient) Say(channel string, text string) {
+	c.Messages = append(c.Messages, text)
+}
+
+// InitCommandTests sets up the bot to run the command fixtures in the directory against the commands in the same folder.
+// Only the commands and built-in commands are set up, keeping their data in a temporary folder that the returned
+// function removes, so fixtures can't send webhooks, relay to Discord, write chat logs or change the bot's data
+func InitCommandTests(directory string) (func(), error) {
+	err := initSettings()
+	if err != nil {
+		return nil, err
+	}
+	temporaryDirectory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		return nil, err
+	}
+	cleanUp := func() {
+		_ = os.RemoveAll(temporaryDirectory)
+	}
+
+	dataDirectory = temporaryDirectory
+	commandsDirectory = directory
+	chatArchive = nil
+	webhooks = nil
+	discordBridge = nil
+	err = initBuiltInCommands()
+	if err != nil {
+		cleanUp()
+		return nil, err
+	}
+	LoadCommands()
+	return cleanUp, nil
+}
+
+// RunCommandTests runs every command fixture (`*.test.json`) in the given directory through the bot, writes the results
+// to out and returns the number of failed cases
+func RunCommandTests(directory string, out io.Writer) int {
+	var fixtures []string
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, ".test.json") {
+			fixtures = append(fixtures, path)
+		}
+		return nil
+	})
+	if err != nil {
+		_, _ = fmt.Fprintf(out, "Error finding command fixtures in %s: %s\n", directory, err.Error())
+		return 1
+	}
+
+	failures := 0
+	total := 0
+	for _, fixture := range fixtures {
+		cases, err := loadCommandTestCases(fixture)
+		if err != nil {
+			_, _ = fmt.Fprintf(out, "FAIL %s: %s\n", fixture, err.Error())
+			failures++
+			continue
+		}
+		total += len(cases)
+		failures += runCommandTestCases(fixture, cases, out)
+	}
+
+	_, _ = fmt.Fprintf(out, "%d of %d cases passed in %d fixtures\n", total-failures, total, len(fixtures))
+	return failures
+}
+
+// Loads the test cases from a command fixture file
+func loadCommandTestCases(filePath string) ([]CommandTestCase, error) {
+	fileData, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cases []CommandTestCase
+	err = json.Unmarshal(fileData, &cases)
+	if err != nil {
+		return nil, err
+	}
+	return cases, nil
+}
+
+// Runs the cases of a fixture in order as one conversation and returns the number of cases that failed
+func runCommandTestCases(fixture string, cases []CommandTestCase, out io.Writer) int {
+	messageCount = 0
+	commandHandler := CommandHandler{}
+	failures := 0
+
+	for i, testCase := range cases {
+		client := RecordingChatClient{}
+		message := newChannelMessage(testCase.User, testCase.Badges, testCase.Message, strconv.Itoa(i+1))
+		onMessage(&commandHandler, &client, message)
+		backgroundCommands.Wait()
+
+		diff := diffMessages(testCase.Expected, client.Messages)
+		if diff != "" {
+			failures++
+			_, _ = fmt.Fprintf(out, "FAIL %s #%d (%s: %s)\n%s", fixture, i+1, testCase.User, testCase.Message, diff)
+		}
+	}
+
+	if failures == 0 {
+		_, _ = fmt.Fprintf(out, "ok   %s (%d cases)\n", fixture, len(cases))
+	}
+	return failures
+}
+
+// Returns a line by line diff of the expected and actual messages, or an empty string if they are the same
+func diffMessages(expected []string, actual []string) string {
+	var diff strings.Builder
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		if i < len(expected) && i < len(actual) && expected[i] == actual[i] {
+			continue
+		}
+		if i < len(expected) {
+			diff.WriteString("    - " + expected[i] + "\n")
+		}
+		if i < len(actual) {
+			diff.WriteString("    + " + actual[i] + "\n")
+		}
+	}
+	return diff.String()
+}
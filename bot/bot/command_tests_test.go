@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDiffMessages_Same(t *testing.T) {
+	result := diffMessages([]string{"one", "two"}, []string{"one", "two"})
+	if result != "" {
+		t.Error("Test Failed: Expected no diff but was: " + result)
+	}
+}
+
+func TestDiffMessages_Different(t *testing.T) {
+	result := diffMessages([]string{"one", "two"}, []string{"one", "three"})
+	if result != "    - two\n    + three\n" {
+		t.Error("Test Failed: Expected diff of 'two' and 'three' but was: " + result)
+	}
+}
+
+func TestDiffMessages_MissingMessage(t *testing.T) {
+	result := diffMessages([]string{"one"}, nil)
+	if result != "    - one\n" {
+		t.Error("Test Failed: Expected diff of missing 'one' but was: " + result)
+	}
+}
+
+func TestRunCommandTests(t *testing.T) {
+	prefix = "!"
+	channel = "testchannel"
+	IntervalMessageList = nil
+	InvokableCommandList = []InvokableCommand{{Invocation: "ping", Message: "Pong!", ModOnly: true}}
+
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	fixture := `[
+		{"user": "viewer", "message": "!ping", "expected": []},
+		{"user": "mod", "badges": {"moderator": 1}, "message": "!ping", "expected": ["Pong!"]},
+		{"user": "viewer", "message": "!ping", "expected": ["Pong!"]}
+	]`
+	err = ioutil.WriteFile(filepath.Join(directory, "ping.command.test.json"), []byte(fixture), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	failures := RunCommandTests(directory, &out)
+
+	if failures != 1 {
+		t.Errorf("Test Failed: Expected 1 failure but was %d", failures)
+	}
+	if !strings.Contains(out.String(), "#3 (viewer: !ping)\n    - Pong!\n") {
+		t.Error("Test Failed: Expected output to contain the diff of the third case but was: " + out.String())
+	}
+	if !strings.Contains(out.String(), "2 of 3 cases passed in 1 fixtures") {
+		t.Error("Test Failed: Expected output to contain the summary but was: " + out.String())
+	}
+}
+
+func TestRunCommandTests_Examples(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+	commandsDirectory = filepath.Join("..", "testdata", "commands")
+	LoadCommands()
+
+	var out bytes.Buffer
+	if failures := RunCommandTests(commandsDirectory, &out); failures != 0 {
+		t.Error("Test Failed: Expected the example fixtures to pass but was: " + out.String())
+	}
+}
+
+func TestInitCommandTests_HasNoSideEffects(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+	defer func() {
+		userTracker = nil
+		pointsStore = nil
+		builtInCommands = nil
+		messageListeners = nil
+	}()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer server.Close()
+
+	directory := dataDirectory
+	webhooksFile := filepath.Join(directory, "webhooks.json")
+	err := ioutil.WriteFile(webhooksFile, []byte(`[{"url": "`+server.URL+`"}]`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PREFIX", "!")
+	t.Setenv("CHANNEL", "testchannel")
+	t.Setenv("NAME", "goatbot")
+	t.Setenv("FEATURES", "seen,points")
+	t.Setenv("DATA_DIRECTORY", filepath.Join(directory, "data"))
+	t.Setenv("CHAT_LOG_DIRECTORY", filepath.Join(directory, "logs"))
+	t.Setenv("WEBHOOKS_FILE", webhooksFile)
+	t.Setenv("DISCORD_WEBHOOK_URL", server.URL)
+
+	fixtures := filepath.Join("..", "testdata", "commands")
+	cleanUpTests, err := InitCommandTests(fixtures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testDataDirectory := dataDirectory
+
+	var out bytes.Buffer
+	if failures := RunCommandTests(fixtures, &out); failures != 0 {
+		t.Error("Test Failed: Expected the example fixtures to pass but was: " + out.String())
+	}
+	saveData()
+	cleanUpTests()
+
+	if webhooks != nil || discordBridge != nil || chatArchive != nil {
+		t.Error("Test Failed: Expected no webhooks, Discord bridge or chat archive to be set up")
+	}
+	if count := atomic.LoadInt32(&requests); count != 0 {
+		t.Errorf("Test Failed: Expected no webhook or Discord requests but there were %d", count)
+	}
+	for _, path := range []string{filepath.Join(directory, "data"), filepath.Join(directory, "logs"), testDataDirectory} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Test Failed: Expected %s not to exist after the fixtures ran", path)
+		}
+	}
+}
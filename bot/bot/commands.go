@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 type CommandParameter struct {
@@ -16,47 +16,90 @@ type CommandParameter struct {
 
 type InvokableCommand struct {
 	Invocation string             `json:"invocation"`
-	Parameters []CommandParameter `json:"parameters"`
+	Parameters []CommandParameter `json:"parameters,omitempty"`
 	Message    string             `json:"message"`
 	ModOnly    bool               `json:"mod_only"`
-	Aliases    []string           `json:"aliases"`
+	Aliases    []string           `json:"aliases,omitempty"`
+	Disabled   bool               `json:"disabled,omitempty"`
+	// Either empty for a command that sends Message, "http" for a command that fetches a value to put in Message or
+	// "exec" for a command that replies with the output of an executable
+	Type string       `json:"type,omitempty"`
+	HTTP *HTTPRequest `json:"http,omitempty"`
+	Exec *ExecCommand `json:"exec,omitempty"`
+	// Seconds before the command can be invoked again in the channel, and by the same user. Mods skip cooldowns
+	Cooldown     int `json:"cooldown,omitempty"`
+	UserCooldown int `json:"user_cooldown,omitempty"`
+	// Only match the invocation and aliases when typed with the same case. Parameters always keep the case they're typed in
+	CaseSensitive bool `json:"case_sensitive,omitempty"`
+	// Also invoke the command when a message starts with the invocation without a prefix
+	Keyword  bool `json:"keyword,omitempty"`
+	filePath string
+	// Set for `.command.lua` files, which run a script instead of sending Message
+	script *scriptCommand
 }
 
 type IntervalMessage struct {
 	Message         string `json:"message"`
 	MessageInterval int    `json:"message_interval"`
+	Disabled        bool   `json:"disabled,omitempty"`
+	filePath        string
 }
 
 var InvokableCommandList []InvokableCommand
 var IntervalMessageList []IntervalMessage
 var ReservedKeywords = [...]string{"username"}
 
+var commandsDirectory = "commands/"
+
+const (
+	commandTypeHTTP = "http"
+	commandTypeExec = "exec"
+)
+
+// Guards InvokableCommandList, IntervalMessageList and ChatTriggerList, which can be changed by the admin API while messages are handled
+var commandsMutex sync.RWMutex
+
 // TODO test
 
-// LoadCommands loads the commands from the commands/ folder into the bot's memory
+// LoadCommands loads the commands from the commands folder into the bot's memory
 func LoadCommands() {
-	log.Println("Loading commands")
+	logger.Info("Loading commands", "directory", commandsDirectory)
 
 	var files []string
 
-	filepathError := filepath.Walk("commands/", func(path string, info os.FileInfo, err error) error {
+	filepathError := filepath.Walk(commandsDirectory, func(path string, info os.FileInfo, err error) error {
 		files = append(files, path)
 		return nil
 	})
 
 	if filepathError != nil {
-		log.Fatalf(filepathError.Error())
+		logger.Error("Error finding command files", "directory", commandsDirectory, "error", filepathError)
+		os.Exit(1)
 	}
 
 	for _, filePath := range files {
 		err := parseFile(filePath)
 		if err != nil {
-			log.Println("Error loading file " + filePath + ": " + err.Error())
+			logger.Warn("Error loading file", "file", filePath, "error", err)
 		}
 	}
 
-	log.Printf("%d invokable commands successfully loaded\n", len(InvokableCommandList))
-	log.Printf("%d interval commands successfully loaded\n", len(IntervalMessageList))
+	logger.Info("Commands successfully loaded", "invokable_commands", len(invokableCommands()), "interval_messages", len(intervalMessages()),
+		"chat_triggers", len(chatTriggers()))
+}
+
+// Returns a copy of the loaded invokable commands that is safe to use while commands are being changed
+func invokableCommands() []InvokableCommand {
+	commandsMutex.RLock()
+	defer commandsMutex.RUnlock()
+	return append([]InvokableCommand(nil), InvokableCommandList...)
+}
+
+// Returns a copy of the loaded interval messages that is safe to use while interval messages are being changed
+func intervalMessages() []IntervalMessage {
+	commandsMutex.RLock()
+	defer commandsMutex.RUnlock()
+	return append([]IntervalMessage(nil), IntervalMessageList...)
 }
 
 // TODO test
@@ -67,7 +110,7 @@ func parseFile(filePath string) error {
 		defer func(currentFile *os.File) {
 			err := currentFile.Close()
 			if err != nil {
-				log.Println("Error closing " + filePath + ": " + err.Error())
+				logger.Warn("Error closing file", "file", filePath, "error", err)
 			}
 		}(currentFile)
 	}
@@ -87,37 +130,142 @@ func parseFile(filePath string) error {
 }
 
 func loadCommandDataFromFile(filePath string) error {
-	fileData, fileReadErr := ioutil.ReadFile(filePath)
-
-	if fileReadErr != nil {
-		log.Println("Error loading fileData " + filePath)
+	fileData, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
 	}
 
-	if strings.HasSuffix(filePath, ".interval.json") {
-		loadIntervalCommand(fileData)
+	if strings.HasSuffix(filePath, ".test.json") {
+		// Command fixtures are only used by `goatbot test`
+		return nil
+	} else if strings.HasSuffix(filePath, ".interval.json") {
+		return loadIntervalCommand(filePath, fileData)
 	} else if strings.HasSuffix(filePath, ".command.json") {
-		loadStandardCommand(fileData)
-	} else {
-		return errors.New("file does not have a valid suffix (i.e. `.command.json` or `.interval.json`")
+		return loadStandardCommand(filePath, fileData)
+	} else if strings.HasSuffix(filePath, ".command.lua") {
+		return loadScriptCommand(filePath, fileData)
+	} else if strings.HasSuffix(filePath, ".game.json") {
+		return loadGameConfig(filePath, fileData)
+	} else if strings.HasSuffix(filePath, ".trigger.json") {
+		return loadChatTrigger(filePath, fileData)
 	}
-	return nil
+	return errors.New("file does not have a valid suffix (i.e. `.command.json`, `.command.lua`, `.interval.json`, `.game.json` or `.trigger.json`")
 }
 
-func loadIntervalCommand(fileData []byte) {
+func loadIntervalCommand(filePath string, fileData []byte) error {
 	commandFromFile := IntervalMessage{}
-	_ = json.Unmarshal(fileData, &commandFromFile)
+	err := json.Unmarshal(fileData, &commandFromFile)
+	if err != nil {
+		return err
+	}
+	if commandFromFile.MessageInterval < 1 {
+		return errors.New("message_interval must be at least 1")
+	}
+
+	commandFromFile.filePath = filePath
+	commandsMutex.Lock()
 	IntervalMessageList = append(IntervalMessageList, commandFromFile)
+	commandsMutex.Unlock()
+	return nil
 }
 
-func loadStandardCommand(fileData []byte) {
+func loadStandardCommand(filePath string, fileData []byte) error {
 	commandFromFile := InvokableCommand{}
-	_ = json.Unmarshal(fileData, &commandFromFile)
-	err := checkParametersForReservedKeyword(commandFromFile)
+	err := json.Unmarshal(fileData, &commandFromFile)
+	if err != nil {
+		return err
+	}
+
+	err = checkParametersForReservedKeyword(commandFromFile)
 	if err != nil {
-		log.Println("Error importing command " + commandFromFile.Invocation + ": " + err.Error())
-	} else {
-		InvokableCommandList = append(InvokableCommandList, commandFromFile)
+		return errors.New("error importing command " + commandFromFile.Invocation + ": " + err.Error())
 	}
+	switch commandFromFile.Type {
+	case "":
+	case commandTypeHTTP:
+		err = validateHTTPRequest(commandFromFile.HTTP)
+		if err != nil {
+			return errors.New("error importing command " + commandFromFile.Invocation + ": " + err.Error())
+		}
+	case commandTypeExec:
+		err = validateExecCommand(commandFromFile.Exec)
+		if err != nil {
+			return errors.New("error importing command " + commandFromFile.Invocation + ": " + err.Error())
+		}
+	default:
+		return errors.New("error importing command " + commandFromFile.Invocation + ": unknown type '" + commandFromFile.Type + "'")
+	}
+
+	commandFromFile.filePath = filePath
+	warnIfHiddenByBuiltIn(commandFromFile)
+	commandsMutex.Lock()
+	InvokableCommandList = append(InvokableCommandList, commandFromFile)
+	commandsMutex.Unlock()
+	return nil
+}
+
+// Removes any commands, interval messages and chat triggers that were loaded from the given file
+func unloadFile(filePath string) {
+	commandsMutex.Lock()
+	defer commandsMutex.Unlock()
+
+	var commands []InvokableCommand
+	for _, command := range InvokableCommandList {
+		if command.filePath != filePath {
+			commands = append(commands, command)
+		}
+	}
+	InvokableCommandList = commands
+
+	var intervals []IntervalMessage
+	for _, interval := range IntervalMessageList {
+		if interval.filePath != filePath {
+			intervals = append(intervals, interval)
+		}
+	}
+	IntervalMessageList = intervals
+
+	var triggers []ChatTrigger
+	for _, trigger := range ChatTriggerList {
+		if trigger.filePath != filePath {
+			triggers = append(triggers, trigger)
+		}
+	}
+	ChatTriggerList = triggers
+}
+
+// Writes the given data to a command file and (re)loads the file the same way LoadCommands does, restoring the
+// previous contents of the file if it cannot be loaded
+func saveCommandFile(filePath string, fileData []byte) error {
+	previousData, readErr := ioutil.ReadFile(filePath)
+
+	err := ioutil.WriteFile(filePath, fileData, 0644)
+	if err != nil {
+		return err
+	}
+
+	unloadFile(filePath)
+	err = parseFile(filePath)
+	if err != nil {
+		if readErr == nil {
+			_ = ioutil.WriteFile(filePath, previousData, 0644)
+			_ = parseFile(filePath)
+		} else {
+			_ = os.Remove(filePath)
+		}
+		return err
+	}
+	return nil
+}
+
+// Deletes a file from the commands folder and unloads any commands it contained
+func deleteCommandFile(filePath string) error {
+	err := os.Remove(filePath)
+	if err != nil {
+		return err
+	}
+	unloadFile(filePath)
+	return nil
 }
 
 func checkParametersForReservedKeyword(command InvokableCommand) error {
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ConsoleUser is the user that messages typed into the console are sent as
+type ConsoleUser struct {
+	Name        string
+	Moderator   bool
+	Broadcaster bool
+}
+
+// ConsoleChatClient is a ChatClient that prints what the bot would say instead of sending it to Twitch
+type ConsoleChatClient struct {
+	Out io.Writer
+}
+
+// Say prints the message that the bot would have sent to the channel
+func (c *ConsoleChatClient) Say(channel string, text string) {
+	_, _ = fmt.Fprintf(c.Out, "[#%s] %s: %s\n", channel, nickname, text)
+}
+
+// StartConsole starts the bot in console mode, reading messages from stdin and printing responses to stdout
+func StartConsole(user ConsoleUser) {
+	logger.Info("Starting console, type a message and press enter to send it to the bot", "user", user.Name)
+	RunConsole(os.Stdin, os.Stdout, user)
+}
+
+// RunConsole sends every line read from in to the bot as a message from the given user until in is exhausted
+func RunConsole(in io.Reader, out io.Writer, user ConsoleUser) {
+	scanner := bufio.NewScanner(in)
+	client := ConsoleChatClient{Out: out}
+	commandHandler := CommandHandler{}
+	if polls != nil {
+		polls.Resume(&client, channel)
+	}
+
+	messageId := 0
+	for scanner.Scan() {
+		messageId++
+		onMessage(&commandHandler, &client, newConsoleMessage(user, scanner.Text(), strconv.Itoa(messageId)))
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.Error("Error reading from console", "error", err)
+	}
+	waitForBackgroundCommands(backgroundCommandsStopTimeout)
+	saveData()
+}
+
+// Creates a message as if it had been sent by the given user in the bot's channel
+func newConsoleMessage(user ConsoleUser, text string, id string) ChatMessage {
+	badges := map[string]int{}
+	if user.Moderator {
+		badges["moderator"] = 1
+	}
+	if user.Broadcaster {
+		badges["broadcaster"] = 1
+	}
+	return newChannelMessage(user.Name, badges, text, id)
+}
+
+// Creates a message sent in the bot's channel by a user with the given badges
+func newChannelMessage(username string, badges map[string]int, text string, id string) ChatMessage {
+	if badges == nil {
+		badges = map[string]int{}
+	}
+
+	return ChatMessage{
+		User: ChatUser{
+			Name:        username,
+			DisplayName: username,
+			Badges:      badges,
+		},
+		Channel: channel,
+		Message: text,
+		ID:      id,
+		Time:    time.Now(),
+	}
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConsoleChatClient_Say(t *testing.T) {
+	nickname = "GoatBot"
+	var out bytes.Buffer
+	client := ConsoleChatClient{Out: &out}
+	client.Say("testchannel", "hello")
+	if out.String() != "[#testchannel] GoatBot: hello\n" {
+		t.Error("Test Failed: Expected output to be '[#testchannel] GoatBot: hello' but was '" + out.String() + "'")
+	}
+}
+
+func TestNewConsoleMessage_Badges(t *testing.T) {
+	channel = "testchannel"
+	message := newConsoleMessage(ConsoleUser{Name: "viewer", Moderator: true}, "!hello", "1")
+	if message.User.Name != "viewer" {
+		t.Error("Test Failed: Expected user to be 'viewer' but was " + message.User.Name)
+	}
+	if message.User.Badges["moderator"] != 1 {
+		t.Error("Test Failed: Expected user to have the moderator badge")
+	}
+	if message.User.Badges["broadcaster"] != 0 {
+		t.Error("Test Failed: Expected user to not have the broadcaster badge")
+	}
+	if message.Channel != "testchannel" {
+		t.Error("Test Failed: Expected channel to be 'testchannel' but was " + message.Channel)
+	}
+}
+
+func TestRunConsole_InvokesCommand(t *testing.T) {
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "GoatBot"
+	IntervalMessageList = nil
+	InvokableCommandList = []InvokableCommand{{Invocation: "hello", Message: "Hi, $username!"}}
+
+	var out bytes.Buffer
+	RunConsole(strings.NewReader("!hello\nnot a command\n"), &out, ConsoleUser{Name: "viewer"})
+
+	if out.String() != "[#testchannel] GoatBot: Hi, viewer!\n" {
+		t.Error("Test Failed: Expected output to be '[#testchannel] GoatBot: Hi, viewer!' but was '" + out.String() + "'")
+	}
+}
+
+func TestRunConsole_ModOnlyCommand(t *testing.T) {
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "GoatBot"
+	IntervalMessageList = nil
+	InvokableCommandList = []InvokableCommand{{Invocation: "ping", Message: "Pong!", ModOnly: true}}
+
+	var out bytes.Buffer
+	RunConsole(strings.NewReader("!ping\n"), &out, ConsoleUser{Name: "viewer"})
+	if out.String() != "" {
+		t.Error("Test Failed: Expected no output for a non mod but was '" + out.String() + "'")
+	}
+
+	out.Reset()
+	RunConsole(strings.NewReader("!ping\n"), &out, ConsoleUser{Name: "viewer", Moderator: true})
+	if out.String() != "[#testchannel] GoatBot: Pong!\n" {
+		t.Error("Test Failed: Expected output to be '[#testchannel] GoatBot: Pong!' but was '" + out.String() + "'")
+	}
+}
+
+func TestRunConsole_DisabledCommand(t *testing.T) {
+	prefix = "!"
+	channel = "testchannel"
+	IntervalMessageList = nil
+	InvokableCommandList = []InvokableCommand{{Invocation: "hello", Message: "Hi!", Disabled: true}}
+
+	var out bytes.Buffer
+	RunConsole(strings.NewReader("!hello\n"), &out, ConsoleUser{Name: "viewer"})
+	if out.String() != "" {
+		t.Error("Test Failed: Expected no output for a disabled command but was '" + out.String() + "'")
+	}
+}
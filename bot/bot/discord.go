@@ -0,0 +1,447 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDiscordRelayPrefix = ">"
+	// The Twitch event relayed to Discord for every chat message
+	discordRelayChat = "chat"
+	// Discord allows messages of up to 2000 characters, Twitch up to 500
+	maximumDiscordMessageLength = 2000
+	maximumTwitchMessageLength  = 500
+)
+
+var (
+	discordAPIAddress   = "https://discord.com/api/v10"
+	discordPollInterval = 2 * time.Second
+	discordTimeout      = 5 * time.Second
+	// The most messages waiting to be sent to Discord, after which new messages are dropped
+	discordQueueSize = 100
+)
+
+// Matches Discord's user, role and channel mentions, e.g. <@123>, <@!123>, <@&123> and <#123>
+var discordMentionPattern = regexp.MustCompile(`<(@!?|@&|#)(\d+)>`)
+
+// DiscordMessage is a message posted in the Discord channel the bridge reads
+type DiscordMessage struct {
+	ID     string
+	Author string
+	// Whether the message was posted by a bot or a webhook, including the bridge itself
+	FromBot bool
+	Content string
+	// The names of the users mentioned in the message by their ID, so mentions can be shown as names in Twitch chat
+	Mentions map[string]string
+}
+
+// DiscordConnection sends messages to a Discord channel and receives the messages posted in it
+type DiscordConnection interface {
+	// Send posts the content in the Discord channel with the given username
+	Send(username string, content string) error
+	// Receive returns a channel of the messages posted in the Discord channel
+	Receive() <-chan DiscordMessage
+}
+
+// DiscordBridge mirrors Twitch chat and bot events to Discord, and relays Discord messages that start with the relay
+// prefix into Twitch chat
+type DiscordBridge struct {
+	connection  DiscordConnection
+	relay       map[string]bool
+	relayPrefix string
+	// Messages waiting to be sent to Discord, sent in order by one goroutine
+	outgoing chan discordOutgoingMessage
+	sending  sync.WaitGroup
+}
+
+type discordOutgoingMessage struct {
+	username string
+	content  string
+}
+
+var discordBridge *DiscordBridge
+
+// NewDiscordBridge creates a DiscordBridge that sends the given Twitch events (e.g. "chat", "raid") to Discord and
+// relays Discord messages starting with relayPrefix into Twitch chat, starting a goroutine that sends messages to Discord
+func NewDiscordBridge(connection DiscordConnection, relay []string, relayPrefix string) *DiscordBridge {
+	bridge := &DiscordBridge{
+		connection:  connection,
+		relay:       map[string]bool{},
+		relayPrefix: relayPrefix,
+		outgoing:    make(chan discordOutgoingMessage, discordQueueSize),
+	}
+	for _, event := range relay {
+		bridge.relay[event] = true
+	}
+	bridge.sending.Add(1)
+	go bridge.run()
+	return bridge
+}
+
+// Sends the queued messages to Discord until the queue is closed
+func (b *DiscordBridge) run() {
+	defer b.sending.Done()
+	for message := range b.outgoing {
+		err := b.connection.Send(message.username, message.content)
+		if err != nil {
+			logger.Warn("Error sending message to Discord", "error", err)
+		}
+	}
+}
+
+// Close sends the messages already queued and stops the goroutine sending them. No messages can be sent afterwards
+func (b *DiscordBridge) Close() {
+	close(b.outgoing)
+	b.sending.Wait()
+}
+
+// Sets up the Discord bridge if a Discord webhook URL is given. Discord messages are only relayed into Twitch chat if a
+// bot token and channel ID are also given
+func initDiscordBridge(webhookURL string, botToken string, channelID string, relay string, relayPrefix string) error {
+	if webhookURL == "" {
+		return nil
+	}
+	if !strings.HasPrefix(webhookURL, "https://") && !strings.HasPrefix(webhookURL, "http://") {
+		return errors.New("DISCORD_WEBHOOK_URL must be a URL")
+	}
+	if (botToken == "") != (channelID == "") {
+		return errors.New("DISCORD_BOT_TOKEN and DISCORD_CHANNEL_ID must both be set to relay Discord messages to chat")
+	}
+
+	events := []string{WebhookRaid, WebhookGiveawayWinner}
+	if relay != "" {
+		events = nil
+		for _, event := range strings.Split(relay, ",") {
+			event = strings.TrimSpace(event)
+			if event != discordRelayChat && !isWebhookEvent(event) {
+				return fmt.Errorf("DISCORD_RELAY contains unknown event '%s'", event)
+			}
+			events = append(events, event)
+		}
+	}
+	if relayPrefix == "" {
+		relayPrefix = defaultDiscordRelayPrefix
+	}
+
+	discordBridge = NewDiscordBridge(NewDiscordAPIConnection(webhookURL, botToken, channelID), events, relayPrefix)
+	registerMessageListener(discordBridge.handleMessage)
+	logger.Info("Discord bridge set up", "relay", strings.Join(events, ","), "relaying_to_chat", botToken != "")
+	return nil
+}
+
+// Start relays Discord messages into the channel's chat in the background
+func (b *DiscordBridge) Start(client ChatClient, channelName string) {
+	go func() {
+		for message := range b.connection.Receive() {
+			b.relayToChat(client, channelName, message)
+		}
+	}()
+}
+
+// Relays a Discord message into Twitch chat if it starts with the relay prefix and was not posted by a bot
+func (b *DiscordBridge) relayToChat(client ChatClient, channelName string, message DiscordMessage) {
+	// Messages posted by the bridge's own webhook come back as bot messages, so this also stops messages looping
+	if message.FromBot || !strings.HasPrefix(message.Content, b.relayPrefix) {
+		return
+	}
+	content := strings.TrimSpace(strings.TrimPrefix(message.Content, b.relayPrefix))
+	content = discordMentionPattern.ReplaceAllStringFunc(content, func(mention string) string {
+		parts := discordMentionPattern.FindStringSubmatch(mention)
+		if name, ok := message.Mentions[parts[2]]; ok && parts[1] != "#" && parts[1] != "@&" {
+			return "@" + name
+		}
+		return ""
+	})
+	content = strings.Join(strings.Fields(content), " ")
+	if content == "" {
+		return
+	}
+
+	relayed := truncateCharacters(fmt.Sprintf("[Discord] %s: %s", sanitiseDiscordName(message.Author), content), maximumTwitchMessageLength)
+	logger.Info("Relaying Discord message to chat", "channel", channelName, "author", message.Author)
+	client.Say(channelName, relayed)
+}
+
+// Mirrors chat messages to Discord if chat is relayed
+func (b *DiscordBridge) handleMessage(client ChatClient, message ChatMessage) {
+	if !b.relay[discordRelayChat] || strings.EqualFold(message.User.Name, nickname) {
+		return
+	}
+	b.send(message.User.DisplayName+" (Twitch)", message.Message)
+}
+
+// Mirrors a bot event to Discord if the event is relayed
+func (b *DiscordBridge) handleEvent(event string, channelName string, data map[string]interface{}) {
+	if !b.relay[event] {
+		return
+	}
+	b.send(nickname, formatDiscordEvent(event, channelName, data))
+}
+
+// Queues the content to be sent to Discord in the background so a slow webhook doesn't hold up chat
+func (b *DiscordBridge) send(username string, content string) {
+	content = truncateCharacters(sanitiseDiscordMentions(content), maximumDiscordMessageLength)
+	select {
+	case b.outgoing <- discordOutgoingMessage{username: username, content: content}:
+	default:
+		logger.Warn("Discord queue is full, dropping message", "username", username)
+	}
+}
+
+// Cuts the text to at most length characters, rather than bytes, so a character is never split in two
+func truncateCharacters(text string, length int) string {
+	count := 0
+	for i := range text {
+		if count == length {
+			return text[:i]
+		}
+		count++
+	}
+	return text
+}
+
+// Describes a bot event for Discord
+func formatDiscordEvent(event string, channelName string, data map[string]interface{}) string {
+	switch event {
+	case WebhookRaid:
+		return fmt.Sprintf("%v raided %s with %v viewers", data["display_name"], channelName, data["viewers"])
+	case WebhookGiveawayWinner:
+		return fmt.Sprintf("%v won the giveaway in %s", data["user"], channelName)
+	case WebhookCommandInvoked:
+		return fmt.Sprintf("%v used %s%v in %s", data["user"], commandPrefix(channelName), data["command"], channelName)
+	case WebhookDisconnected:
+		return fmt.Sprintf("Lost connection to %s: %v", channelName, data["reason"])
+	case WebhookModAction:
+		if data["action"] == "clear" {
+			return "The chat in " + channelName + " was cleared"
+		}
+		return fmt.Sprintf("%v: %v in %s", data["action"], data["user"], channelName)
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	details := make([]string, len(keys))
+	for i, key := range keys {
+		details[i] = fmt.Sprintf("%s=%v", key, data[key])
+	}
+	return fmt.Sprintf("%s in %s: %s", event, channelName, strings.Join(details, ", "))
+}
+
+// Stops Twitch messages pinging everyone in Discord. Webhook requests also turn off mentions, so this only keeps the
+// text from looking like a ping
+func sanitiseDiscordMentions(content string) string {
+	content = strings.Replace(content, "@everyone", "@\u200beveryone", -1)
+	content = strings.Replace(content, "@here", "@\u200bhere", -1)
+	return discordMentionPattern.ReplaceAllStringFunc(content, func(mention string) string {
+		return "<\u200b" + mention[1:]
+	})
+}
+
+// Removes characters from a Discord name that could make a relayed message look like a Twitch command
+func sanitiseDiscordName(name string) string {
+	name = strings.Join(strings.Fields(name), "_")
+	name = strings.TrimLeft(name, "/.!@")
+	if name == "" {
+		return "someone"
+	}
+	return name
+}
+
+// DiscordAPIConnection posts to a Discord webhook and, if it has a bot token, polls the Discord API for new messages
+type DiscordAPIConnection struct {
+	webhookURL string
+	botToken   string
+	channelID  string
+	client     *http.Client
+	// Copied from discordAPIAddress and discordPollInterval when the connection is created
+	apiAddress   string
+	pollInterval time.Duration
+	messages     chan DiscordMessage
+	stop         chan struct{}
+	polling      sync.WaitGroup
+}
+
+// NewDiscordAPIConnection creates a DiscordAPIConnection, which only receives messages if botToken and channelID are set
+func NewDiscordAPIConnection(webhookURL string, botToken string, channelID string) *DiscordAPIConnection {
+	return &DiscordAPIConnection{
+		webhookURL:   webhookURL,
+		botToken:     botToken,
+		channelID:    channelID,
+		client:       &http.Client{Timeout: discordTimeout},
+		apiAddress:   discordAPIAddress,
+		pollInterval: discordPollInterval,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Close stops polling for new messages, waiting for the poll in progress to finish
+func (c *DiscordAPIConnection) Close() {
+	close(c.stop)
+	c.polling.Wait()
+}
+
+type discordWebhookRequest struct {
+	Username        string                 `json:"username"`
+	Content         string                 `json:"content"`
+	AllowedMentions map[string]interface{} `json:"allowed_mentions"`
+}
+
+// Send posts the content to the webhook with mentions turned off
+func (c *DiscordAPIConnection) Send(username string, content string) error {
+	body, err := json.Marshal(discordWebhookRequest{
+		Username:        username,
+		Content:         content,
+		AllowedMentions: map[string]interface{}{"parse": []string{}},
+	})
+	if err != nil {
+		return err
+	}
+	response, err := c.client.Post(c.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("discord responded with %s", response.Status)
+	}
+	return nil
+}
+
+// Receive starts polling the channel for new messages, or returns a channel that never receives anything if there is
+// no bot token
+func (c *DiscordAPIConnection) Receive() <-chan DiscordMessage {
+	if c.messages == nil {
+		c.messages = make(chan DiscordMessage, 50)
+		if c.botToken != "" {
+			c.polling.Add(1)
+			go c.poll()
+		}
+	}
+	return c.messages
+}
+
+type discordAPIMessage struct {
+	ID        string `json:"id"`
+	Content   string `json:"content"`
+	WebhookID string `json:"webhook_id"`
+	Author    struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Bot        bool   `json:"bot"`
+	} `json:"author"`
+	Mentions []struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"mentions"`
+}
+
+// Polls the channel for messages newer than the last one seen, starting from the newest message so old messages are
+// not relayed when the bot starts
+func (c *DiscordAPIConnection) poll() {
+	defer c.polling.Done()
+	lastID := ""
+	for {
+		messages, err := c.fetchMessages(lastID)
+		if err != nil {
+			logger.Warn("Error reading Discord messages", "error", err)
+		}
+		// Discord returns the newest message first
+		for i := len(messages) - 1; i >= 0; i-- {
+			if isNewerDiscordID(messages[i].ID, lastID) {
+				if lastID != "" {
+					select {
+					case c.messages <- toDiscordMessage(messages[i]):
+					case <-c.stop:
+						close(c.messages)
+						return
+					}
+				}
+				lastID = messages[i].ID
+			}
+		}
+		if lastID == "" && err == nil {
+			// The channel is empty, so every message from now on is new
+			lastID = "0"
+		}
+
+		select {
+		case <-c.stop:
+			close(c.messages)
+			return
+		case <-time.After(c.pollInterval):
+		}
+	}
+}
+
+func (c *DiscordAPIConnection) fetchMessages(afterID string) ([]discordAPIMessage, error) {
+	address := fmt.Sprintf("%s/channels/%s/messages?limit=50", c.apiAddress, c.channelID)
+	if afterID == "" {
+		address = fmt.Sprintf("%s/channels/%s/messages?limit=1", c.apiAddress, c.channelID)
+	} else if afterID != "0" {
+		address += "&after=" + afterID
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), discordTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bot "+c.botToken)
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discord responded with %s", response.Status)
+	}
+	var messages []discordAPIMessage
+	err = json.NewDecoder(io.LimitReader(response.Body, 1024*1024)).Decode(&messages)
+	return messages, err
+}
+
+func toDiscordMessage(message discordAPIMessage) DiscordMessage {
+	author := message.Author.GlobalName
+	if author == "" {
+		author = message.Author.Username
+	}
+	mentions := map[string]string{}
+	for _, mention := range message.Mentions {
+		mentions[mention.ID] = mention.Username
+	}
+	return DiscordMessage{
+		ID:       message.ID,
+		Author:   author,
+		FromBot:  message.Author.Bot || message.WebhookID != "",
+		Content:  message.Content,
+		Mentions: mentions,
+	}
+}
+
+// Discord IDs are numbers that increase over time, but can be longer than an int64 in the future so compare them as text
+func isNewerDiscordID(id string, than string) bool {
+	if than == "" {
+		return true
+	}
+	if len(id) != len(than) {
+		return len(id) > len(than)
+	}
+	return id > than
+}
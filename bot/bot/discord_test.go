@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// A local stand-in for Discord that records what the bridge sends and lets tests post messages to the bridge
+type fakeDiscordConnection struct {
+	mutex    sync.Mutex
+	sent     []string
+	incoming chan DiscordMessage
+	// If set, each send waits until it can receive from blocked
+	blocked chan struct{}
+}
+
+func (c *fakeDiscordConnection) Send(username string, content string) error {
+	if c.blocked != nil {
+		<-c.blocked
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.sent = append(c.sent, username+": "+content)
+	return nil
+}
+
+func (c *fakeDiscordConnection) Receive() <-chan DiscordMessage {
+	return c.incoming
+}
+
+// Waits for the bridge to send count messages to Discord and returns them
+func (c *fakeDiscordConnection) waitForSent(count int) []string {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mutex.Lock()
+		sent := append([]string(nil), c.sent...)
+		c.mutex.Unlock()
+		if len(sent) >= count {
+			time.Sleep(10 * time.Millisecond)
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			return append([]string(nil), c.sent...)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// Sets up empty commands and data folders and a Discord bridge to a stand-in connection
+func setUpDiscordBridge(t *testing.T, relay ...string) (*fakeDiscordConnection, func()) {
+	cleanUp := setUpScripts(t)
+	connection := &fakeDiscordConnection{incoming: make(chan DiscordMessage)}
+	discordBridge = NewDiscordBridge(connection, relay, ">")
+	registerMessageListener(discordBridge.handleMessage)
+	return connection, func() {
+		close(connection.incoming)
+		discordBridge.Close()
+		discordBridge = nil
+		cleanUp()
+	}
+}
+
+func TestDiscordBridge_RelaysToDiscord(t *testing.T) {
+	connection, cleanUp := setUpDiscordBridge(t, discordRelayChat, WebhookRaid)
+	defer cleanUp()
+
+	sendMessages(&syncRecordingChatClient{},
+		testMessage{user: "viewer", text: "hello @everyone <@123>"},
+		testMessage{user: "goatbot", text: "the bot's own message"},
+	)
+	sendEvent(WebhookRaid, "testchannel", map[string]interface{}{"display_name": "Raider", "viewers": 42})
+	sendEvent(WebhookGiveawayWinner, "testchannel", map[string]interface{}{"user": "viewer"})
+
+	sent := connection.waitForSent(2)
+	if len(sent) != 2 {
+		t.Fatalf("Test Failed: Expected 2 messages to be sent to Discord but was %v", sent)
+	}
+	expected := map[string]bool{
+		"viewer (Twitch): hello @\u200beveryone <\u200b@123>": true,
+		"goatbot: Raider raided testchannel with 42 viewers":  true,
+	}
+	for _, message := range sent {
+		if !expected[message] {
+			t.Errorf("Test Failed: Expected the chat message and the raid to be sent but got '%s'", message)
+		}
+	}
+}
+
+func TestDiscordBridge_RelaysToChat(t *testing.T) {
+	connection, cleanUp := setUpDiscordBridge(t)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	discordBridge.Start(client, "testchannel")
+	for _, message := range []DiscordMessage{
+		{Author: "Goat Fan", Content: "> hi <@42> and <@&7> in <#9>", Mentions: map[string]string{"42": "sheep"}},
+		{Author: "Goat Fan", Content: "not relayed"},
+		{Author: "GoatBot", FromBot: true, Content: "> relayed by the bridge itself"},
+		{Author: "/ban", Content: "> /ban everyone"},
+		{Author: "Goat Fan", Content: "> " + strings.Repeat("é", 600)},
+	} {
+		connection.incoming <- message
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for client.count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if len(client.messages) != 3 {
+		t.Fatalf("Test Failed: Expected 3 messages to be relayed but was %v", client.messages)
+	}
+	if client.messages[0] != "[Discord] Goat_Fan: hi @sheep and in" {
+		t.Errorf("Test Failed: Expected mentions to be replaced but was '%s'", client.messages[0])
+	}
+	if client.messages[1] != "[Discord] ban: /ban everyone" {
+		t.Errorf("Test Failed: Expected the username to be prefixed but was '%s'", client.messages[1])
+	}
+	if utf8.RuneCountInString(client.messages[2]) != maximumTwitchMessageLength || !utf8.ValidString(client.messages[2]) {
+		t.Errorf("Test Failed: Expected long messages to be cut to %d characters but was %d", maximumTwitchMessageLength, utf8.RuneCountInString(client.messages[2]))
+	}
+}
+
+func TestDiscordBridge_SendsInOrderAndLimitsQueue(t *testing.T) {
+	discordQueueSize = 2
+	defer func() {
+		discordQueueSize = 100
+	}()
+	connection, cleanUp := setUpDiscordBridge(t, discordRelayChat)
+	defer cleanUp()
+	connection.blocked = make(chan struct{})
+
+	// Wait for the first message to be taken from the queue, so it is being sent while the rest are queued
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: strings.Repeat("é", 2500)})
+	deadline := time.Now().Add(time.Second)
+	for len(discordBridge.outgoing) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i <= 4; i++ {
+		sendMessages(client, testMessage{user: "viewer", text: fmt.Sprintf("message %d", i)})
+	}
+	close(connection.blocked)
+
+	sent := connection.waitForSent(3)
+	if len(sent) != 3 {
+		t.Fatalf("Test Failed: Expected the messages past the queue to be dropped but was %v", sent)
+	}
+	if content := strings.TrimPrefix(sent[0], "viewer (Twitch): "); utf8.RuneCountInString(content) != maximumDiscordMessageLength || !utf8.ValidString(content) {
+		t.Errorf("Test Failed: Expected long messages to be cut to %d characters but was %d", maximumDiscordMessageLength, utf8.RuneCountInString(content))
+	}
+	if sent[1] != "viewer (Twitch): message 1" || sent[2] != "viewer (Twitch): message 2" {
+		t.Errorf("Test Failed: Expected the queued messages to be sent in order but was %v", sent[1:])
+	}
+}
+
+func TestDiscordAPIConnection(t *testing.T) {
+	var mutex sync.Mutex
+	var webhookBodies []discordWebhookRequest
+	var channelMessages []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if request.URL.Path == "/webhook" {
+			var body discordWebhookRequest
+			_ = json.NewDecoder(request.Body).Decode(&body)
+			webhookBodies = append(webhookBodies, body)
+			writer.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if request.Header.Get("Authorization") != "Bot token" || request.URL.Path != "/channels/99/messages" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		after := request.URL.Query().Get("after")
+		var newer []string
+		// Messages are returned newest first
+		for i := len(channelMessages) - 1; i >= 0; i-- {
+			if isNewerDiscordID(fmt.Sprint(i+1), after) {
+				newer = append(newer, channelMessages[i])
+			}
+			if request.URL.Query().Get("limit") == "1" {
+				break
+			}
+		}
+		_, _ = fmt.Fprintf(writer, "[%s]", strings.Join(newer, ","))
+	}))
+	defer server.Close()
+
+	discordAPIAddress = server.URL
+	discordPollInterval = 5 * time.Millisecond
+	defer func() {
+		discordAPIAddress = "https://discord.com/api/v10"
+		discordPollInterval = 2 * time.Second
+	}()
+
+	connection := NewDiscordAPIConnection(server.URL+"/webhook", "token", "99")
+	defer connection.Close()
+	if err := connection.Send("GoatBot", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if len(webhookBodies) != 1 || webhookBodies[0].Username != "GoatBot" || webhookBodies[0].Content != "hello" {
+		t.Errorf("Test Failed: Expected the message to be posted to the webhook but was %+v", webhookBodies)
+	}
+
+	mutex.Lock()
+	channelMessages = append(channelMessages, `{"id": "1", "content": "> old", "author": {"username": "fan"}}`)
+	mutex.Unlock()
+	messages := connection.Receive()
+	time.Sleep(20 * time.Millisecond)
+	mutex.Lock()
+	channelMessages = append(channelMessages,
+		`{"id": "2", "content": "> new <@5>", "author": {"username": "fan", "global_name": "Fan"}, "mentions": [{"id": "5", "username": "sheep"}]}`,
+		`{"id": "3", "content": "> from the bridge", "webhook_id": "8", "author": {"username": "GoatBot", "bot": true}}`)
+	mutex.Unlock()
+
+	select {
+	case message := <-messages:
+		if message.ID != "2" || message.Author != "Fan" || message.Mentions["5"] != "sheep" || message.FromBot {
+			t.Errorf("Test Failed: Expected the new message to be received but was %+v", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Test Failed: Expected the new message to be received")
+	}
+	select {
+	case message := <-messages:
+		if message.ID != "3" || !message.FromBot {
+			t.Errorf("Test Failed: Expected the webhook message to be marked as from a bot but was %+v", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Test Failed: Expected the webhook message to be received")
+	}
+}
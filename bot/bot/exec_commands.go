@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultExecTimeout = 5 * time.Second
+	maximumExecTimeout = 30 * time.Second
+	defaultExecError   = "Sorry, that command failed"
+	// The most output read from an exec command, more than enough for a chat message
+	maximumExecOutput = 64 * 1024
+)
+
+// The folder exec commands must be in, which they are also run in. Exec commands are turned off if it is empty
+var execDirectory string
+
+// ExecCommand is the executable an exec command runs when it is invoked
+type ExecCommand struct {
+	// The executable to run, relative to EXEC_DIRECTORY
+	Command string `json:"command"`
+	// Arguments passed to the executable, which can contain the command's parameters and $username. They are passed
+	// straight to the executable without going through a shell
+	Args []string `json:"args,omitempty"`
+	// Environment variables set for the executable, which can also contain the command's parameters and $username
+	Env            map[string]string `json:"env,omitempty"`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"`
+	// Sent if the executable fails, times out or exits with a non-zero status
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// execSender is the JSON the executable receives on stdin
+type execSender struct {
+	User        string            `json:"user"`
+	DisplayName string            `json:"display_name"`
+	Channel     string            `json:"channel"`
+	Message     string            `json:"message"`
+	IsMod       bool              `json:"is_mod"`
+	Badges      map[string]int    `json:"badges"`
+	Parameters  map[string]string `json:"parameters"`
+}
+
+// Sets the folder exec commands are allowed to run executables from
+func initExecCommands(directory string) error {
+	if directory == "" {
+		execDirectory = ""
+		return nil
+	}
+	absolute, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(absolute)
+	if err != nil || !info.IsDir() {
+		return errors.New("EXEC_DIRECTORY must be a folder")
+	}
+	execDirectory = absolute
+	return nil
+}
+
+// Checks the exec settings of a command loaded from a file
+func validateExecCommand(command *ExecCommand) error {
+	if command == nil || command.Command == "" {
+		return errors.New("exec commands need an exec.command")
+	}
+	if command.TimeoutSeconds < 0 || time.Duration(command.TimeoutSeconds)*time.Second > maximumExecTimeout {
+		return fmt.Errorf("exec.timeout_seconds must be between 0 and %d", int(maximumExecTimeout/time.Second))
+	}
+	_, err := resolveExecutable(command.Command)
+	return err
+}
+
+// Returns the full path of the executable, or an error if it is not inside the exec directory
+func resolveExecutable(command string) (string, error) {
+	if execDirectory == "" {
+		return "", errors.New("exec commands are turned off, set EXEC_DIRECTORY to turn them on")
+	}
+	directory, err := filepath.EvalSymlinks(execDirectory)
+	if err != nil {
+		return "", err
+	}
+	executable, err := filepath.EvalSymlinks(filepath.Join(execDirectory, command))
+	if err != nil {
+		return "", err
+	}
+	relative, err := filepath.Rel(directory, executable)
+	if err != nil || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return "", errors.New("exec.command must be inside EXEC_DIRECTORY")
+	}
+	return executable, nil
+}
+
+// Runs the command's executable and returns the first line it writes to stdout, or the error message if it fails
+func runExecCommand(handler CommandProcessor, message ChatMessage, command InvokableCommand, messageParameters []string) string {
+	output, err := execCommandOutput(handler, message, command, messageParameters)
+	if err != nil {
+		messageLogger(message).Warn("Error running exec command", "command", command.Invocation, "error", err)
+		errorMessage := command.Exec.ErrorMessage
+		if errorMessage == "" {
+			errorMessage = defaultExecError
+		}
+		return handler.ReplaceReservedKeywordsWithValues(errorMessage, message)
+	}
+	return output
+}
+
+func execCommandOutput(handler CommandProcessor, message ChatMessage, command InvokableCommand, messageParameters []string) (string, error) {
+	executable, err := resolveExecutable(command.Exec.Command)
+	if err != nil {
+		return "", err
+	}
+
+	fillPlaceholders := func(value string) string {
+		value = strings.Replace(value, "$username", message.User.Name, -1)
+		return handler.ReplaceCommandPlaceholdersWithValues(value, command.Parameters, messageParameters)
+	}
+	args := make([]string, len(command.Exec.Args))
+	for i, arg := range command.Exec.Args {
+		args[i] = fillPlaceholders(arg)
+	}
+	// Only pass on what the executable needs to run, not the bot's secrets
+	env := []string{"PATH=" + os.Getenv("PATH"), "HOME=" + os.Getenv("HOME")}
+	for name, value := range command.Exec.Env {
+		env = append(env, name+"="+fillPlaceholders(value))
+	}
+
+	sender := execSender{
+		User:        message.User.Name,
+		DisplayName: message.User.DisplayName,
+		Channel:     message.Channel,
+		Message:     message.Message,
+		IsMod:       isModerator(message),
+		Badges:      message.User.Badges,
+		Parameters:  map[string]string{},
+	}
+	for i, parameter := range command.Parameters {
+		sender.Parameters[parameter.Name] = messageParameters[i]
+	}
+	stdin, err := json.Marshal(sender)
+	if err != nil {
+		return "", err
+	}
+
+	timeout := defaultExecTimeout
+	if command.Exec.TimeoutSeconds > 0 {
+		timeout = time.Duration(command.Exec.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	process := exec.CommandContext(ctx, executable, args...)
+	process.Dir = execDirectory
+	process.Env = env
+	process.Stdin = bytes.NewReader(stdin)
+	stdout := &limitedBuffer{limit: maximumExecOutput}
+	stderr := &limitedBuffer{limit: maximumExecOutput}
+	process.Stdout = stdout
+	process.Stderr = stderr
+	// Don't wait for anything the executable started to close its output after it has been killed
+	process.WaitDelay = time.Second
+
+	err = process.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("executable took longer than %s", timeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(stdout.String()))
+	scanner.Buffer(make([]byte, maximumExecOutput), maximumExecOutput)
+	if scanner.Scan() {
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+	return "", nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the rest
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if remaining := b.limit - b.Len(); remaining > 0 {
+		if len(data) > remaining {
+			b.Buffer.Write(data[:remaining])
+		} else {
+			b.Buffer.Write(data)
+		}
+	}
+	return len(data), nil
+}
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Sets up empty commands and data folders and an exec folder containing the given shell scripts
+func setUpExecCommands(t *testing.T, scripts map[string]string) func() {
+	if runtime.GOOS == "windows" {
+		t.Skip("exec command tests use shell scripts")
+	}
+	cleanUp := setUpScripts(t)
+	cooldowns = NewCooldownTracker()
+
+	directory := filepath.Join(dataDirectory, "exec")
+	err := os.Mkdir(directory, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, script := range scripts {
+		err = ioutil.WriteFile(filepath.Join(directory, name), []byte("#!/bin/sh\n"+script), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = initExecCommands(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		execDirectory = ""
+		cleanUp()
+	}
+}
+
+func TestExecCommand_ArgsEnvAndStdin(t *testing.T) {
+	cleanUp := setUpExecCommands(t, map[string]string{
+		"echo.sh": `read sender
+echo "$1 $2 $PLAYER $(pwd | xargs basename)"
+echo "second line"`,
+		"stdin.sh": "cat",
+	})
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "echo",
+		Parameters: []CommandParameter{{Name: "player"}},
+		Type:       commandTypeExec,
+		Exec: &ExecCommand{
+			Command: "echo.sh",
+			Args:    []string{"$player", "$username"},
+			Env:     map[string]string{"PLAYER": "player=$player"},
+		},
+	}, {
+		Invocation: "sender",
+		Parameters: []CommandParameter{{Name: "player"}},
+		Type:       commandTypeExec,
+		Exec:       &ExecCommand{Command: "stdin.sh"},
+	}}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!echo $(reboot);goat"},
+		testMessage{user: "viewer", text: "!echo"},
+		modMessage("!sender goat"),
+	)
+	expectMessages(t, []string{
+		"$(reboot);goat viewer player=$(reboot);goat exec",
+		"Invalid usage of command",
+		`{"user":"mod","display_name":"mod","channel":"testchannel","message":"!sender goat","is_mod":true,"badges":{"moderator":1},"parameters":{"player":"goat"}}`,
+	}, client.messages)
+}
+
+func TestExecCommand_Failures(t *testing.T) {
+	cleanUp := setUpExecCommands(t, map[string]string{
+		"fail.sh":   "echo partial\nexit 3",
+		"slow.sh":   "sleep 5\necho done",
+		"silent.sh": "exit 0",
+	})
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{
+		{Invocation: "fail", Type: commandTypeExec, Exec: &ExecCommand{Command: "fail.sh", ErrorMessage: "Sorry $username"}},
+		{Invocation: "slow", Type: commandTypeExec, Exec: &ExecCommand{Command: "slow.sh", TimeoutSeconds: 1}},
+		{Invocation: "silent", Type: commandTypeExec, Exec: &ExecCommand{Command: "silent.sh"}},
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!fail"},
+		testMessage{user: "viewer", text: "!slow"},
+		testMessage{user: "viewer", text: "!silent"},
+	)
+	expectMessages(t, []string{"Sorry viewer", defaultExecError}, client.messages)
+}
+
+func TestLoadStandardCommand_Exec(t *testing.T) {
+	cleanUp := setUpExecCommands(t, map[string]string{"stats.sh": "echo stats"})
+	defer cleanUp()
+
+	err := os.Symlink("/bin/sh", filepath.Join(execDirectory, "shell"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := `{"invocation": "stats", "type": "exec", "exec": {"command": "stats.sh"}}`
+	if err := loadStandardCommand("stats.command.json", []byte(valid)); err != nil {
+		t.Errorf("Test Failed: Expected the exec command to load but got %v", err)
+	}
+
+	for _, invalid := range []string{
+		`{"invocation": "stats", "type": "exec"}`,
+		`{"invocation": "stats", "type": "exec", "exec": {"command": "missing.sh"}}`,
+		`{"invocation": "stats", "type": "exec", "exec": {"command": "../../../bin/sh"}}`,
+		`{"invocation": "stats", "type": "exec", "exec": {"command": "/bin/sh"}}`,
+		`{"invocation": "stats", "type": "exec", "exec": {"command": "shell"}}`,
+		`{"invocation": "stats", "type": "exec", "exec": {"command": "stats.sh", "timeout_seconds": 60}}`,
+	} {
+		if loadStandardCommand("stats.command.json", []byte(invalid)) == nil {
+			t.Errorf("Test Failed: Expected an error loading %s", invalid)
+		}
+	}
+
+	execDirectory = ""
+	if loadStandardCommand("stats.command.json", []byte(valid)) == nil {
+		t.Error("Test Failed: Expected exec commands to be turned off without EXEC_DIRECTORY")
+	}
+}
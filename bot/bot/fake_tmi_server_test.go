@@ -0,0 +1,184 @@
+package bot
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTmiServer is an in-process IRC server that speaks enough of Twitch's IRCv3 dialect for the bot to connect to it
+type fakeTmiServer struct {
+	t          *testing.T
+	listener   net.Listener
+	mutex      sync.Mutex
+	conn       net.Conn
+	nextId     int
+	connects   chan string
+	joins      chan string
+	privmsgs   chan string
+	capability chan string
+}
+
+// Starts a fake TMI server listening on a random local port
+func newFakeTmiServer(t *testing.T) *fakeTmiServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeTmiServer{
+		t:          t,
+		listener:   listener,
+		connects:   make(chan string, 10),
+		joins:      make(chan string, 10),
+		privmsgs:   make(chan string, 100),
+		capability: make(chan string, 10),
+	}
+	go server.accept()
+	return server
+}
+
+func (s *fakeTmiServer) address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *fakeTmiServer) close() {
+	_ = s.listener.Close()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn != nil {
+		_ = s.conn.Close()
+	}
+}
+
+func (s *fakeTmiServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		s.conn = conn
+		s.mutex.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// Handles the lines sent by a client on a single connection
+func (s *fakeTmiServer) handle(conn net.Conn) {
+	var pass, nick string
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		command, params := parseFakeTmiLine(line)
+		switch command {
+		case "CAP":
+			if len(params) == 2 && params[0] == "REQ" {
+				s.capability <- params[1]
+				s.writeTo(conn, ":tmi.twitch.tv CAP * ACK :"+params[1])
+			}
+		case "PASS":
+			pass = params[0]
+		case "NICK":
+			nick = params[0]
+			if !strings.HasPrefix(pass, "oauth:") {
+				s.writeTo(conn, ":tmi.twitch.tv NOTICE * :Improperly formatted auth")
+				continue
+			}
+			s.writeTo(conn, fmt.Sprintf(":tmi.twitch.tv 001 %s :Welcome, GLHF!", nick))
+			s.writeTo(conn, fmt.Sprintf(":tmi.twitch.tv 376 %s :>", nick))
+			s.connects <- nick
+		case "JOIN":
+			for _, joined := range strings.Split(params[0], ",") {
+				s.writeTo(conn, fmt.Sprintf(":%s!%s@%s.tmi.twitch.tv JOIN %s", nick, nick, nick, joined))
+				s.joins <- strings.TrimPrefix(joined, "#")
+			}
+		case "PING":
+			s.writeTo(conn, ":tmi.twitch.tv PONG tmi.twitch.tv :"+strings.Join(params, " "))
+		case "PRIVMSG":
+			s.privmsgs <- params[1]
+		}
+	}
+}
+
+// Splits an IRC line sent by a client into its command and parameters
+func parseFakeTmiLine(line string) (string, []string) {
+	var trailing string
+	hasTrailing := false
+	if index := strings.Index(line, " :"); index != -1 {
+		trailing = line[index+2:]
+		line = line[:index]
+		hasTrailing = true
+	}
+
+	parts := strings.Split(line, " ")
+	params := parts[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return parts[0], params
+}
+
+func (s *fakeTmiServer) writeTo(conn net.Conn, line string) {
+	_, _ = conn.Write([]byte(line + "\r\n"))
+}
+
+// Writes a line to the most recent connection
+func (s *fakeTmiServer) write(line string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		s.t.Fatal("Test Failed: No client is connected to the fake TMI server")
+	}
+	s.writeTo(s.conn, line)
+}
+
+// Sends a chat message with tags from the given user with the given badges (e.g. "moderator/1")
+func (s *fakeTmiServer) sendPrivateMessage(channel string, user string, badges string, text string) {
+	s.mutex.Lock()
+	s.nextId++
+	id := s.nextId
+	s.mutex.Unlock()
+
+	tags := fmt.Sprintf("@badge-info=;badges=%s;color=;display-name=%s;emotes=;id=%d;mod=0;room-id=1;subscriber=0;tmi-sent-ts=%d;turbo=0;user-id=%d;user-type=",
+		badges, user, id, time.Now().UnixNano()/int64(time.Millisecond), id)
+	s.write(fmt.Sprintf("%s :%s!%s@%s.tmi.twitch.tv PRIVMSG #%s :%s", tags, user, user, user, channel, text))
+}
+
+// Sends a USERNOTICE with the given msg-id (e.g. "raid") and any extra tags
+func (s *fakeTmiServer) sendUserNotice(channel string, user string, msgId string, extraTags string) {
+	tags := fmt.Sprintf("@badge-info=;badges=;display-name=%s;login=%s;msg-id=%s;room-id=1;system-msg=;tmi-sent-ts=%d;user-id=2", user, user, msgId, time.Now().UnixNano()/int64(time.Millisecond))
+	if extraTags != "" {
+		tags += ";" + extraTags
+	}
+	s.write(fmt.Sprintf("%s :tmi.twitch.tv USERNOTICE #%s", tags, channel))
+}
+
+// Asks the client to reconnect
+func (s *fakeTmiServer) sendReconnect() {
+	s.write(":tmi.twitch.tv RECONNECT")
+}
+
+// Waits for a value to be received on the given channel, failing the test if none is received in time
+func (s *fakeTmiServer) expect(values chan string, description string) string {
+	select {
+	case value := <-values:
+		return value
+	case <-time.After(2 * time.Second):
+		s.t.Fatal("Test Failed: Timed out waiting for " + description)
+		return ""
+	}
+}
+
+// Fails the test if a value is received on the given channel within the wait time
+func (s *fakeTmiServer) expectNothing(values chan string, wait time.Duration, description string) {
+	select {
+	case value := <-values:
+		s.t.Error("Test Failed: Expected no " + description + " but received: " + value)
+	case <-time.After(wait):
+	}
+}
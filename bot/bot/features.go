@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+)
+
+// The built-in features that can be turned on with FEATURES, each adding its own commands
+var availableFeatures = []string{"seen", "points", "giveaways", "polls", "games", "trivia", "songs"}
+
+// Splits the FEATURES setting, a comma separated list of the built-in features to turn on. Features are off unless
+// they're listed, so their commands don't take the names of commands loaded from files
+func parseFeatures(setting string) (map[string]bool, error) {
+	features := map[string]bool{}
+	for _, value := range strings.Split(setting, ",") {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		known := false
+		for _, feature := range availableFeatures {
+			if feature == value {
+				known = true
+			}
+		}
+		if !known {
+			return nil, errors.New("unknown feature '" + value + "', FEATURES can contain " + strings.Join(availableFeatures, ", "))
+		}
+		features[value] = true
+	}
+
+	if features["games"] && !features["points"] {
+		return nil, errors.New("the games feature needs the points feature to be turned on")
+	}
+	return features, nil
+}
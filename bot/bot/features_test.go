@@ -0,0 +1,40 @@
+package bot
+
+import (
+	"testing"
+)
+
+func TestParseFeatures(t *testing.T) {
+	features, err := parseFeatures("Points, games,,songs")
+	if err != nil || len(features) != 3 || !features["points"] || !features["games"] || !features["songs"] {
+		t.Errorf("Test Failed: Expected points, games and songs to be turned on but was %v, %v", features, err)
+	}
+
+	features, err = parseFeatures("")
+	if err != nil || len(features) != 0 {
+		t.Errorf("Test Failed: Expected every feature to be off by default but was %v, %v", features, err)
+	}
+
+	for _, setting := range []string{"points,dance", "games"} {
+		if _, err := parseFeatures(setting); err == nil {
+			t.Errorf("Test Failed: Expected an error for FEATURES=%s", setting)
+		}
+	}
+}
+
+func TestInitBuiltInCommands_SongCostNeedsPoints(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	defer func() {
+		userTracker = nil
+		songQueue = nil
+		songRequestCost = 0
+		builtInCommands = nil
+	}()
+	t.Setenv("FEATURES", "songs")
+	t.Setenv("SONG_REQUEST_COST", "10")
+
+	if err := initBuiltInCommands(); err == nil {
+		t.Error("Test Failed: Expected an error for a song request cost without points")
+	}
+}
@@ -0,0 +1,454 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GameConfig is the odds, cooldown and messages of a points game, loaded from a `.game.json` file named after the game,
+// e.g. `gamble.game.json`. Anything missing from the file keeps its default
+type GameConfig struct {
+	Disabled bool `json:"disabled,omitempty"`
+	// The chance of winning, from 0 to 1
+	WinChance float64 `json:"win_chance"`
+	// How many times the amount bet is won on top of getting the bet back
+	Payout float64 `json:"payout"`
+	// How long a user (or for a heist, the channel) has to wait between games
+	CooldownSeconds int `json:"cooldown_seconds"`
+	// How long a duel can be accepted for, or how long users can join a heist for
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// How long to wait between each message of a heist's outcome
+	StepDelayMilliseconds int               `json:"step_delay_milliseconds"`
+	Messages              map[string]string `json:"messages"`
+}
+
+var defaultGameConfigs = map[string]GameConfig{
+	"gamble": {
+		WinChance:       0.5,
+		Payout:          1,
+		CooldownSeconds: 30,
+		Messages: map[string]string{
+			"win":  "$username gambled $amount points and won! They now have $balance points",
+			"lose": "$username gambled $amount points and lost them all. They now have $balance points",
+		},
+	},
+	"duel": {
+		WinChance:       0.5,
+		CooldownSeconds: 30,
+		TimeoutSeconds:  60,
+		Messages: map[string]string{
+			"challenge": "$target, $username has challenged you to a duel for $amount points! Type $prefixaccept or $prefixdecline",
+			"win":       "$winner won the duel against $loser and takes $amount points!",
+			"declined":  "$target declined the duel",
+			"expired":   "$target didn't accept the duel in time",
+		},
+	},
+	"heist": {
+		WinChance:             0.6,
+		Payout:                1,
+		CooldownSeconds:       300,
+		TimeoutSeconds:        60,
+		StepDelayMilliseconds: 3000,
+		Messages: map[string]string{
+			"start":   "$username is planning a heist! Type $prefixheist <points> to join in the next $timeout",
+			"begin":   "The crew of $count sets off on the heist...",
+			"middle":  "The alarms go off, everyone run!",
+			"success": "The heist is over! Survivors: $results",
+			"failure": "The heist is over and the whole crew got caught",
+		},
+	},
+}
+
+// GameManager runs the points games, using a random number generator that can be seeded for tests
+type GameManager struct {
+	mutex     sync.Mutex
+	random    *rand.Rand
+	configs   map[string]GameConfig
+	cooldowns map[string]time.Time
+	duels     map[string]*duel
+	heists    map[string]*heist
+}
+
+// A duel waiting to be accepted
+type duel struct {
+	challenger string
+	target     string
+	amount     int64
+	timer      *time.Timer
+}
+
+// A heist that users can join until its join window closes
+type heist struct {
+	members []heistMember
+	joined  map[string]bool
+}
+
+type heistMember struct {
+	user   string
+	amount int64
+}
+
+var games *GameManager
+
+// NewGameManager creates a GameManager with the default game configs that uses random for every game's outcome
+func NewGameManager(random *rand.Rand) *GameManager {
+	configs := map[string]GameConfig{}
+	for name, config := range defaultGameConfigs {
+		configs[name] = config
+	}
+	return &GameManager{
+		random:    random,
+		configs:   configs,
+		cooldowns: map[string]time.Time{},
+		duels:     map[string]*duel{},
+		heists:    map[string]*heist{},
+	}
+}
+
+// Sets up the gamble, duel and heist commands
+func initGames() {
+	games = NewGameManager(rand.New(rand.NewSource(time.Now().UnixNano())))
+	registerGameCommands()
+}
+
+func registerGameCommands() {
+	registerBuiltInCommand(builtInCommand{invocation: "gamble", handler: games.gambleCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "duel", handler: games.duelCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "accept", handler: games.acceptCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "decline", handler: games.declineCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "heist", handler: games.heistCommand})
+}
+
+// Loads a `.game.json` file over the defaults of the game it is named after
+func loadGameConfig(filePath string, fileData []byte) error {
+	name := strings.TrimSuffix(filepath.Base(filePath), ".game.json")
+	defaultConfig, ok := defaultGameConfigs[name]
+	if !ok {
+		return fmt.Errorf("there is no game called %s", name)
+	}
+
+	config := defaultConfig
+	config.Messages = map[string]string{}
+	for key, text := range defaultConfig.Messages {
+		config.Messages[key] = text
+	}
+	err := json.Unmarshal(fileData, &config)
+	if err != nil {
+		return err
+	}
+	if config.WinChance < 0 || config.WinChance > 1 {
+		return fmt.Errorf("win_chance must be between 0 and 1")
+	}
+	if config.Payout < 0 || config.CooldownSeconds < 0 || config.TimeoutSeconds < 0 || config.StepDelayMilliseconds < 0 {
+		return fmt.Errorf("payout, cooldown_seconds, timeout_seconds and step_delay_milliseconds must not be negative")
+	}
+
+	if games != nil {
+		games.mutex.Lock()
+		games.configs[name] = config
+		games.mutex.Unlock()
+	}
+	return nil
+}
+
+// Returns the config of a game and whether it is enabled
+func (g *GameManager) config(name string) (GameConfig, bool) {
+	config := g.configs[name]
+	return config, !config.Disabled && pointsStore != nil
+}
+
+// Returns how long the key has left on its cooldown, starting a new cooldown if it has finished. Cooldowns that have
+// finished are removed, so users who stop playing don't stay in the map
+func (g *GameManager) cooldown(key string, seconds int) time.Duration {
+	now := time.Now()
+	if remaining := g.cooldowns[key].Sub(now); remaining > 0 {
+		return remaining
+	}
+	for other, ends := range g.cooldowns {
+		if !ends.After(now) {
+			delete(g.cooldowns, other)
+		}
+	}
+	if seconds > 0 {
+		g.cooldowns[key] = now.Add(time.Duration(seconds) * time.Second)
+	}
+	return 0
+}
+
+// Returns whether the random number generator rolled a win with the given chance
+func (g *GameManager) roll(chance float64) bool {
+	return g.random.Float64() < chance
+}
+
+// Returns the winnings of a successful bet, including the bet itself
+func winnings(amount int64, payout float64) int64 {
+	return amount + int64(math.Round(float64(amount)*payout))
+}
+
+// Parses an amount of points as a number, "all" or a percentage of the user's balance
+func parseAmount(argument string, balance int64) (int64, bool) {
+	if argument == "all" {
+		return balance, balance > 0
+	}
+	if strings.HasSuffix(argument, "%") {
+		percentage, err := strconv.ParseFloat(strings.TrimSuffix(argument, "%"), 64)
+		if err != nil || percentage <= 0 || percentage > 100 {
+			return 0, false
+		}
+		amount := int64(float64(balance) * percentage / 100)
+		return amount, amount > 0
+	}
+	amount, err := strconv.ParseInt(argument, 10, 64)
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+	return amount, true
+}
+
+// Fills in the keywords of a game message
+func gameMessage(channelName string, config GameConfig, key string, keywords ...string) string {
+	return strings.NewReplacer(append(keywords, "$prefix", commandPrefix(channelName))...).Replace(config.Messages[key])
+}
+
+// !gamble <points|all|percentage%>
+func (g *GameManager) gambleCommand(client ChatClient, message ChatMessage, arguments []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	config, enabled := g.config("gamble")
+	if !enabled {
+		return
+	}
+	if len(arguments) == 0 {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"gamble <points|all|percentage%>")
+		return
+	}
+
+	balance := pointsStore.Balance(message.Channel, message.User.Name)
+	amount, ok := parseAmount(arguments[0], balance)
+	if !ok || balance < amount {
+		client.Say(message.Channel, fmt.Sprintf("@%s you don't have enough points to gamble that", message.User.DisplayName))
+		return
+	}
+	if remaining := g.cooldown("gamble:"+strings.ToLower(message.Channel)+":"+strings.ToLower(message.User.Name), config.CooldownSeconds); remaining > 0 {
+		client.Say(message.Channel, fmt.Sprintf("@%s you can gamble again in %s", message.User.DisplayName, formatCooldown(remaining)))
+		return
+	}
+	if pointsStore.Spend(message.Channel, message.User.Name, amount) != nil {
+		client.Say(message.Channel, fmt.Sprintf("@%s you don't have enough points to gamble that", message.User.DisplayName))
+		return
+	}
+
+	result := "lose"
+	balance = pointsStore.Balance(message.Channel, message.User.Name)
+	if g.roll(config.WinChance) {
+		result = "win"
+		balance = pointsStore.Add(message.Channel, message.User.Name, winnings(amount, config.Payout))
+	}
+	client.Say(message.Channel, gameMessage(message.Channel, config, result, "$username", message.User.DisplayName, "$amount", strconv.FormatInt(amount, 10), "$balance", strconv.FormatInt(balance, 10)))
+}
+
+// !duel <user> <points> challenges the user to a duel that they can accept or decline
+func (g *GameManager) duelCommand(client ChatClient, message ChatMessage, arguments []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	config, enabled := g.config("duel")
+	if !enabled {
+		return
+	}
+	if len(arguments) < 2 {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"duel <user> <points>")
+		return
+	}
+
+	challenger := strings.ToLower(message.User.Name)
+	target := strings.TrimPrefix(arguments[0], "@")
+	amount, ok := parseAmount(arguments[1], pointsStore.Balance(message.Channel, challenger))
+	if !ok || pointsStore.Balance(message.Channel, challenger) < amount {
+		client.Say(message.Channel, fmt.Sprintf("@%s you don't have enough points to duel for that", message.User.DisplayName))
+		return
+	}
+	if target == challenger || target == strings.ToLower(nickname) {
+		client.Say(message.Channel, fmt.Sprintf("@%s you can't duel %s", message.User.DisplayName, target))
+		return
+	}
+
+	key := strings.ToLower(message.Channel) + ":" + target
+	if _, pending := g.duels[key]; pending {
+		client.Say(message.Channel, fmt.Sprintf("@%s %s already has a duel waiting to be accepted", message.User.DisplayName, target))
+		return
+	}
+	if remaining := g.cooldown("duel:"+strings.ToLower(message.Channel)+":"+challenger, config.CooldownSeconds); remaining > 0 {
+		client.Say(message.Channel, fmt.Sprintf("@%s you can duel again in %s", message.User.DisplayName, formatCooldown(remaining)))
+		return
+	}
+
+	challenge := &duel{challenger: challenger, target: target, amount: amount}
+	g.duels[key] = challenge
+	challenge.timer = time.AfterFunc(time.Duration(config.TimeoutSeconds)*time.Second, func() {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		if g.duels[key] == challenge {
+			delete(g.duels, key)
+			client.Say(message.Channel, gameMessage(message.Channel, config, "expired", "$username", challenger, "$target", target))
+		}
+	})
+	client.Say(message.Channel, gameMessage(message.Channel, config, "challenge", "$username", message.User.DisplayName, "$target", target, "$amount", strconv.FormatInt(amount, 10)))
+}
+
+// Returns and removes the duel waiting for the user to accept it
+func (g *GameManager) takeDuel(message ChatMessage) (*duel, bool) {
+	key := strings.ToLower(message.Channel) + ":" + strings.ToLower(message.User.Name)
+	challenge, pending := g.duels[key]
+	if pending {
+		challenge.timer.Stop()
+		delete(g.duels, key)
+	}
+	return challenge, pending
+}
+
+// !accept accepts the duel waiting for the user, taking the points from both users and giving them all to the winner
+func (g *GameManager) acceptCommand(client ChatClient, message ChatMessage, arguments []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	config, _ := g.config("duel")
+	challenge, pending := g.takeDuel(message)
+	if !pending {
+		return
+	}
+
+	if pointsStore.Spend(message.Channel, challenge.target, challenge.amount) != nil {
+		client.Say(message.Channel, fmt.Sprintf("@%s you don't have enough points to accept the duel", message.User.DisplayName))
+		return
+	}
+	if pointsStore.Spend(message.Channel, challenge.challenger, challenge.amount) != nil {
+		pointsStore.Add(message.Channel, challenge.target, challenge.amount)
+		client.Say(message.Channel, fmt.Sprintf("%s no longer has enough points for the duel", challenge.challenger))
+		return
+	}
+
+	winner, loser := challenge.challenger, challenge.target
+	if !g.roll(config.WinChance) {
+		winner, loser = loser, winner
+	}
+	pointsStore.Add(message.Channel, winner, 2*challenge.amount)
+	client.Say(message.Channel, gameMessage(message.Channel, config, "win", "$winner", winner, "$loser", loser, "$amount", strconv.FormatInt(challenge.amount, 10)))
+}
+
+// !decline declines the duel waiting for the user
+func (g *GameManager) declineCommand(client ChatClient, message ChatMessage, arguments []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	config, _ := g.config("duel")
+	challenge, pending := g.takeDuel(message)
+	if pending {
+		client.Say(message.Channel, gameMessage(message.Channel, config, "declined", "$username", challenge.challenger, "$target", message.User.DisplayName))
+	}
+}
+
+// !heist <points> starts a heist, or joins the heist if one is being planned
+func (g *GameManager) heistCommand(client ChatClient, message ChatMessage, arguments []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	config, enabled := g.config("heist")
+	if !enabled {
+		return
+	}
+	if len(arguments) == 0 {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"heist <points|all|percentage%>")
+		return
+	}
+
+	user := strings.ToLower(message.User.Name)
+	channelName := strings.ToLower(message.Channel)
+	current, planning := g.heists[channelName]
+	if planning && current.joined[user] {
+		return
+	}
+
+	amount, ok := parseAmount(arguments[0], pointsStore.Balance(message.Channel, user))
+	if !ok || pointsStore.Balance(message.Channel, user) < amount {
+		client.Say(message.Channel, fmt.Sprintf("@%s you don't have enough points to join the heist with that", message.User.DisplayName))
+		return
+	}
+	if !planning {
+		if remaining := g.cooldown("heist:"+channelName, config.CooldownSeconds); remaining > 0 {
+			client.Say(message.Channel, fmt.Sprintf("@%s the next heist can start in %s", message.User.DisplayName, formatCooldown(remaining)))
+			return
+		}
+	}
+	if pointsStore.Spend(message.Channel, user, amount) != nil {
+		if !planning {
+			// The heist didn't start, so the next one doesn't have to wait
+			delete(g.cooldowns, "heist:"+channelName)
+		}
+		client.Say(message.Channel, fmt.Sprintf("@%s you don't have enough points to join the heist with that", message.User.DisplayName))
+		return
+	}
+
+	if planning {
+		current.members = append(current.members, heistMember{user: user, amount: amount})
+		current.joined[user] = true
+		return
+	}
+
+	current = &heist{members: []heistMember{{user: user, amount: amount}}, joined: map[string]bool{user: true}}
+	g.heists[channelName] = current
+	window := time.Duration(config.TimeoutSeconds) * time.Second
+	time.AfterFunc(window, func() {
+		g.runHeist(client, message.Channel, current)
+	})
+	client.Say(message.Channel, gameMessage(message.Channel, config, "start", "$username", message.User.DisplayName, "$timeout", window.String()))
+}
+
+// Works out the outcome of the heist once its join window closes, sending the outcome a message at a time
+func (g *GameManager) runHeist(client ChatClient, channelName string, current *heist) {
+	g.mutex.Lock()
+	config, _ := g.config("heist")
+	delete(g.heists, strings.ToLower(channelName))
+
+	var results []string
+	for _, member := range current.members {
+		if g.roll(config.WinChance) {
+			won := winnings(member.amount, config.Payout)
+			pointsStore.Add(channelName, member.user, won)
+			results = append(results, fmt.Sprintf("%s (%d)", member.user, won))
+		}
+	}
+	g.mutex.Unlock()
+
+	outcome := []string{
+		gameMessage(channelName, config, "begin", "$count", strconv.Itoa(len(current.members))),
+		gameMessage(channelName, config, "middle"),
+	}
+	if len(results) > 0 {
+		outcome = append(outcome, gameMessage(channelName, config, "success", "$results", strings.Join(results, ", "), "$count", strconv.Itoa(len(results))))
+	} else {
+		outcome = append(outcome, gameMessage(channelName, config, "failure"))
+	}
+
+	for i, text := range outcome {
+		if i > 0 {
+			time.Sleep(time.Duration(config.StepDelayMilliseconds) * time.Millisecond)
+		}
+		if text != "" {
+			client.Say(channelName, text)
+		}
+	}
+}
+
+// Formats the time left on a cooldown to the nearest second
+func formatCooldown(remaining time.Duration) string {
+	return pluralise(int(math.Ceil(remaining.Seconds())), "second")
+}
@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sets up an empty data folder and the games with a seeded random number generator, giving viewer and other 100 points
+func setUpGames(t *testing.T, seed int64) func() {
+	cleanUpPoints := setUpPoints(t)
+	pointsPerMessage = 0
+	games = NewGameManager(rand.New(rand.NewSource(seed)))
+	registerGameCommands()
+	pointsStore.Add("testchannel", "viewer", 100)
+	pointsStore.Add("testchannel", "other", 100)
+	return func() {
+		games = nil
+		pointsPerMessage = 1
+		cleanUpPoints()
+	}
+}
+
+// Returns whether the first roll of a generator with the given seed wins with the given chance
+func firstRollWins(seed int64, chance float64) bool {
+	return rand.New(rand.NewSource(seed)).Float64() < chance
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		argument string
+		amount   int64
+		ok       bool
+	}{
+		{"10", 10, true},
+		{"all", 80, true},
+		{"25%", 20, true},
+		{"0", 0, false},
+		{"-5", 0, false},
+		{"150%", 0, false},
+		{"lots", 0, false},
+	}
+	for _, testCase := range cases {
+		amount, ok := parseAmount(testCase.argument, 80)
+		if amount != testCase.amount || ok != testCase.ok {
+			t.Errorf("Test Failed: Expected '%s' to be %d, %v but was %d, %v", testCase.argument, testCase.amount, testCase.ok, amount, ok)
+		}
+	}
+}
+
+func TestGamble(t *testing.T) {
+	cleanUp := setUpGames(t, 1)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!gamble 500"},
+		testMessage{user: "viewer", text: "!gamble 50%"},
+		testMessage{user: "viewer", text: "!gamble 10"},
+	)
+
+	expected := "viewer gambled 50 points and lost them all. They now have 50 points"
+	if firstRollWins(1, 0.5) {
+		expected = "viewer gambled 50 points and won! They now have 150 points"
+	}
+	expectMessages(t, []string{
+		"@viewer you don't have enough points to gamble that",
+		expected,
+		"@viewer you can gamble again in 30 seconds",
+	}, client.messages)
+}
+
+func TestGamble_ConfigFile(t *testing.T) {
+	cleanUp := setUpGames(t, 1)
+	defer cleanUp()
+
+	filePath := filepath.Join(dataDirectory, "gamble.game.json")
+	err := ioutil.WriteFile(filePath, []byte(`{"win_chance": 1, "payout": 2, "cooldown_seconds": 0, "messages": {"win": "$username won $amount!"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = loadCommandDataFromFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: "!gamble 10"}, testMessage{user: "viewer", text: "!gamble all"})
+	expectMessages(t, []string{"viewer won 10!", "viewer won 120!"}, client.messages)
+	if balance := pointsStore.Balance("testchannel", "viewer"); balance != 360 {
+		t.Errorf("Test Failed: Expected winnings to be 3 times the bet but balance was %d", balance)
+	}
+	if games.configs["gamble"].Messages["lose"] != defaultGameConfigs["gamble"].Messages["lose"] {
+		t.Error("Test Failed: Expected messages missing from the file to keep their defaults")
+	}
+}
+
+func TestLoadGameConfig_Invalid(t *testing.T) {
+	if loadGameConfig("commands/poker.game.json", []byte(`{}`)) == nil {
+		t.Error("Test Failed: Expected an error for a game that does not exist")
+	}
+	if loadGameConfig("commands/gamble.game.json", []byte(`{"win_chance": 2}`)) == nil {
+		t.Error("Test Failed: Expected an error for a win chance over 1")
+	}
+}
+
+func TestDuel_Accept(t *testing.T) {
+	cleanUp := setUpGames(t, 2)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!duel @other 40"},
+		testMessage{user: "viewer", text: "!accept"},
+		testMessage{user: "other", text: "!accept"},
+	)
+
+	winner, loser := "viewer", "other"
+	if !firstRollWins(2, 0.5) {
+		winner, loser = loser, winner
+	}
+	expectMessages(t, []string{
+		"other, viewer has challenged you to a duel for 40 points! Type !accept or !decline",
+		winner + " won the duel against " + loser + " and takes 40 points!",
+	}, client.messages)
+	if pointsStore.Balance("testchannel", winner) != 140 || pointsStore.Balance("testchannel", loser) != 60 {
+		t.Errorf("Test Failed: Expected the winner to take the loser's points")
+	}
+}
+
+func TestDuel_Decline(t *testing.T) {
+	cleanUp := setUpGames(t, 1)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!duel other 10"},
+		testMessage{user: "viewer", text: "!duel other 10"},
+		testMessage{user: "other", text: "!decline"},
+		testMessage{user: "other", text: "!accept"},
+	)
+
+	expectMessages(t, []string{
+		"other, viewer has challenged you to a duel for 10 points! Type !accept or !decline",
+		"@viewer other already has a duel waiting to be accepted",
+		"other declined the duel",
+	}, client.messages)
+	if pointsStore.Balance("testchannel", "viewer") != 100 || pointsStore.Balance("testchannel", "other") != 100 {
+		t.Error("Test Failed: Expected no points to change hands")
+	}
+}
+
+func TestDuel_Expires(t *testing.T) {
+	cleanUp := setUpGames(t, 1)
+	defer cleanUp()
+	config := games.configs["duel"]
+	config.TimeoutSeconds = 0
+	games.configs["duel"] = config
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: "!duel other 10"})
+	deadline := time.Now().Add(time.Second)
+	for client.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if client.last() != "other didn't accept the duel in time" {
+		t.Errorf("Test Failed: Expected the duel to expire but was '%s'", client.last())
+	}
+}
+
+func TestHeist(t *testing.T) {
+	cleanUp := setUpGames(t, 3)
+	defer cleanUp()
+	config := games.configs["heist"]
+	config.TimeoutSeconds = 1
+	config.StepDelayMilliseconds = 1
+	games.configs["heist"] = config
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!heist 30"},
+		testMessage{user: "other", text: "!heist all"},
+		testMessage{user: "other", text: "!heist 10"},
+	)
+	deadline := time.Now().Add(3 * time.Second)
+	for client.count() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	random := rand.New(rand.NewSource(3))
+	viewerWins, otherWins := random.Float64() < config.WinChance, random.Float64() < config.WinChance
+	var survivors []string
+	if viewerWins {
+		survivors = append(survivors, "viewer (60)")
+	}
+	if otherWins {
+		survivors = append(survivors, "other (200)")
+	}
+	result := "The heist is over and the whole crew got caught"
+	if len(survivors) > 0 {
+		result = "The heist is over! Survivors: " + strings.Join(survivors, ", ")
+	}
+	expectMessages(t, []string{
+		"viewer is planning a heist! Type !heist <points> to join in the next 1s",
+		"The crew of 2 sets off on the heist...",
+		"The alarms go off, everyone run!",
+		result,
+	}, client.messages)
+
+	sendMessages(client, testMessage{user: "viewer", text: "!heist 10"})
+	if client.last() != "@viewer the next heist can start in 299 seconds" {
+		t.Errorf("Test Failed: Expected the heist to be on cooldown but was '%s'", client.last())
+	}
+}
+
+func TestGameManager_CooldownsAreRemovedOnceFinished(t *testing.T) {
+	manager := NewGameManager(rand.New(rand.NewSource(1)))
+	manager.cooldowns["gamble:testchannel:gone"] = time.Now().Add(-time.Second)
+	manager.cooldowns["gamble:testchannel:waiting"] = time.Now().Add(time.Minute)
+
+	if remaining := manager.cooldown("gamble:testchannel:viewer", 30); remaining != 0 {
+		t.Errorf("Test Failed: Expected no cooldown for a new user but was %s", remaining)
+	}
+	if _, ok := manager.cooldowns["gamble:testchannel:gone"]; ok || len(manager.cooldowns) != 2 {
+		t.Errorf("Test Failed: Expected only the finished cooldown to be removed but was %v", manager.cooldowns)
+	}
+	if remaining := manager.cooldown("gamble:testchannel:waiting", 30); remaining <= 0 {
+		t.Error("Test Failed: Expected the waiting user to still be on cooldown")
+	}
+}
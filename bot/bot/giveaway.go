@@ -0,0 +1,417 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultGiveawayClaimTime = 60 * time.Second
+	// The most entries subs= can give subscribers
+	maximumGiveawaySubscriberWeight = 1000
+	// The most extra entries a user can get from their points
+	maximumGiveawayPointsEntries = 1000
+)
+
+// GiveawayWinner is a user drawn as the winner of a giveaway
+type GiveawayWinner struct {
+	User    string    `json:"user"`
+	DrawnAt time.Time `json:"drawn_at"`
+	Claimed bool      `json:"claimed"`
+}
+
+// GiveawayRecord is the history of a giveaway
+type GiveawayRecord struct {
+	Keyword   string           `json:"keyword"`
+	StartedAt time.Time        `json:"started_at"`
+	EndedAt   time.Time        `json:"ended_at,omitempty"`
+	Entrants  int              `json:"entrants"`
+	Winners   []GiveawayWinner `json:"winners"`
+}
+
+type giveawayEntrant struct {
+	user   string
+	weight int64
+}
+
+// A giveaway running in a channel
+type giveaway struct {
+	channel          string
+	record           GiveawayRecord
+	open             bool
+	entrants         []giveawayEntrant
+	entered          map[string]bool
+	subscriberWeight int64
+	pointsPerEntry   int64
+	pendingWinner    string
+	claimTimer       *time.Timer
+	closeTimer       *time.Timer
+	client           ChatClient
+}
+
+// GiveawayManager runs giveaways, at most one per channel at a time
+type GiveawayManager struct {
+	mutex     sync.Mutex
+	giveaways map[string]*giveaway
+	claimTime time.Duration
+	random    *rand.Rand
+}
+
+var giveaways *GiveawayManager
+
+// NewGiveawayManager creates a GiveawayManager where winners have claimTime to respond before another winner is drawn
+func NewGiveawayManager(claimTime time.Duration, random *rand.Rand) *GiveawayManager {
+	return &GiveawayManager{
+		giveaways: map[string]*giveaway{},
+		claimTime: claimTime,
+		random:    random,
+	}
+}
+
+// Sets up giveaways and the giveaway command, with winners having claimTime seconds to claim their prize
+func initGiveaways(claimTime string) error {
+	claimDuration := defaultGiveawayClaimTime
+	if claimTime != "" {
+		seconds, err := strconv.Atoi(claimTime)
+		if err != nil || seconds < 1 {
+			return errors.New("GIVEAWAY_CLAIM_SECONDS must be a positive number of seconds")
+		}
+		claimDuration = time.Duration(seconds) * time.Second
+	}
+
+	giveaways = NewGiveawayManager(claimDuration, rand.New(rand.NewSource(time.Now().UnixNano())))
+	registerMessageListener(giveaways.handleMessage)
+	registerBuiltInCommand(builtInCommand{invocation: "giveaway", modOnly: true, handler: giveaways.giveawayCommand})
+	return nil
+}
+
+// !giveaway start|draw|end|status
+func (g *GiveawayManager) giveawayCommand(client ChatClient, message ChatMessage, arguments []string) {
+	if len(arguments) == 0 {
+		channelPrefix := commandPrefix(message.Channel)
+		client.Say(message.Channel, "Usage: "+channelPrefix+"giveaway start <keyword> [duration] [subs=<weight>] [points=<points per extra entry>], "+channelPrefix+"giveaway draw, "+channelPrefix+"giveaway end")
+		return
+	}
+
+	switch arguments[0] {
+	case "start":
+		g.start(client, message.Channel, arguments[1:])
+	case "draw":
+		g.draw(client, message.Channel)
+	case "end", "stop", "cancel":
+		g.end(client, message.Channel)
+	case "status":
+		g.status(client, message.Channel)
+	default:
+		client.Say(message.Channel, "Unknown giveaway command '"+arguments[0]+"'")
+	}
+}
+
+// Starts a giveaway that users enter by using the keyword as a command
+func (g *GiveawayManager) start(client ChatClient, channelName string, arguments []string) {
+	if len(arguments) == 0 {
+		client.Say(channelName, "Usage: "+commandPrefix(channelName)+"giveaway start <keyword> [duration] [subs=<weight>] [points=<points per extra entry>]")
+		return
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if _, running := g.giveaways[channelName]; running {
+		client.Say(channelName, "A giveaway is already running, end it with "+commandPrefix(channelName)+"giveaway end")
+		return
+	}
+
+	keyword := arguments[0]
+	for _, value := range channelPrefixes.Prefixes(channelName) {
+		if strings.HasPrefix(keyword, value) {
+			keyword = strings.TrimPrefix(keyword, value)
+			break
+		}
+	}
+	current := &giveaway{
+		channel:          channelName,
+		record:           GiveawayRecord{Keyword: keyword, StartedAt: time.Now()},
+		open:             true,
+		entered:          map[string]bool{},
+		subscriberWeight: 1,
+		client:           client,
+	}
+
+	var duration time.Duration
+	for _, option := range arguments[1:] {
+		var err error
+		if strings.HasPrefix(option, "subs=") {
+			current.subscriberWeight, err = strconv.ParseInt(strings.TrimPrefix(option, "subs="), 10, 64)
+		} else if strings.HasPrefix(option, "points=") {
+			if pointsStore == nil {
+				client.Say(channelName, "Points aren't turned on, so giveaway entries can't use them")
+				return
+			}
+			current.pointsPerEntry, err = strconv.ParseInt(strings.TrimPrefix(option, "points="), 10, 64)
+		} else {
+			duration, err = time.ParseDuration(option)
+		}
+		if err != nil || current.subscriberWeight < 1 || current.subscriberWeight > maximumGiveawaySubscriberWeight ||
+			current.pointsPerEntry < 0 || duration < 0 {
+			client.Say(channelName, "Invalid giveaway option '"+option+"'")
+			return
+		}
+	}
+
+	if _, exists := findCommand(keyword); exists || hasBuiltInCommand(keyword) {
+		client.Say(channelName, "The keyword "+commandPrefix(channelName)+keyword+" is already a command")
+		return
+	}
+
+	g.giveaways[channelName] = current
+	registerBuiltInCommand(builtInCommand{invocation: keyword, handler: g.enter})
+	g.saveRecord(current)
+
+	announcement := "A giveaway has started! Type " + commandPrefix(channelName) + keyword + " to enter"
+	if duration > 0 {
+		announcement += fmt.Sprintf(", entries close in %s", duration)
+		current.closeTimer = time.AfterFunc(duration, func() {
+			g.closeEntries(channelName, current)
+		})
+	}
+	client.Say(channelName, announcement)
+}
+
+// Closes entries to the giveaway once its duration has passed
+func (g *GiveawayManager) closeEntries(channelName string, expired *giveaway) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.giveaways[channelName] != expired || !expired.open {
+		return
+	}
+	expired.open = false
+	unregisterBuiltInCommand(expired.record.Keyword)
+	expired.client.Say(channelName, fmt.Sprintf("Giveaway entries are closed, %d entered", len(expired.entrants)))
+}
+
+// Enters the user invoking the giveaway keyword into the giveaway, once
+func (g *GiveawayManager) enter(client ChatClient, message ChatMessage, arguments []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	current, running := g.giveaways[message.Channel]
+	user := strings.ToLower(message.User.Name)
+	if !running || !current.open || current.entered[user] {
+		return
+	}
+
+	weight := int64(1)
+	if message.User.Badges["subscriber"] > 0 || message.User.Badges["founder"] > 0 {
+		weight = current.subscriberWeight
+	}
+	if current.pointsPerEntry > 0 && pointsStore != nil {
+		extra := pointsStore.Balance(message.Channel, user) / current.pointsPerEntry
+		if extra > maximumGiveawayPointsEntries {
+			extra = maximumGiveawayPointsEntries
+		}
+		if extra > 0 {
+			weight += extra
+		}
+	}
+
+	current.entered[user] = true
+	current.entrants = append(current.entrants, giveawayEntrant{user: user, weight: weight})
+	current.record.Entrants = len(current.entrants)
+}
+
+// Draws a winner, closing entries if they are still open
+func (g *GiveawayManager) draw(client ChatClient, channelName string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	current, running := g.giveaways[channelName]
+	if !running {
+		client.Say(channelName, "There is no giveaway running")
+		return
+	}
+	if current.pendingWinner != "" {
+		client.Say(channelName, "Waiting for "+current.pendingWinner+" to claim their prize")
+		return
+	}
+	if current.open {
+		current.open = false
+		unregisterBuiltInCommand(current.record.Keyword)
+		if current.closeTimer != nil {
+			current.closeTimer.Stop()
+		}
+	}
+	current.client = client
+	g.drawWinner(current)
+}
+
+// Picks a random entrant who has not already been drawn, weighted by their number of entries
+func (g *GiveawayManager) drawWinner(current *giveaway) {
+	drawn := map[string]bool{}
+	for _, winner := range current.record.Winners {
+		drawn[winner.User] = true
+	}
+
+	var total int64
+	for _, entrant := range current.entrants {
+		if drawn[entrant.user] {
+			continue
+		}
+		if entrant.weight > math.MaxInt64-total {
+			// Not reachable with the limits on entries, but a total that wrapped around would make the draw panic
+			total = math.MaxInt64
+			break
+		}
+		total += entrant.weight
+	}
+	if total <= 0 {
+		current.client.Say(current.channel, "There is nobody left to draw")
+		return
+	}
+
+	ticket := g.random.Int63n(total)
+	for _, entrant := range current.entrants {
+		if drawn[entrant.user] {
+			continue
+		}
+		if ticket < entrant.weight {
+			current.pendingWinner = entrant.user
+			current.record.Winners = append(current.record.Winners, GiveawayWinner{User: entrant.user, DrawnAt: time.Now()})
+			break
+		}
+		ticket -= entrant.weight
+	}
+	g.saveRecord(current)
+
+	winner := current.pendingWinner
+	sendEvent(WebhookGiveawayWinner, current.channel, map[string]interface{}{
+		"user":    winner,
+		"keyword": current.record.Keyword,
+		"draw":    len(current.record.Winners),
+	})
+	current.client.Say(current.channel, fmt.Sprintf("@%s has won the giveaway! Say something in chat within %s to claim your prize", winner, g.claimTime))
+	current.claimTimer = time.AfterFunc(g.claimTime, func() {
+		g.claimExpired(current, winner)
+	})
+}
+
+// Draws another winner if the winner did not claim their prize in time
+func (g *GiveawayManager) claimExpired(current *giveaway, winner string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.giveaways[current.channel] != current || current.pendingWinner != winner {
+		return
+	}
+	current.pendingWinner = ""
+	current.client.Say(current.channel, winner+" didn't claim their prize in time, re-rolling...")
+	g.drawWinner(current)
+}
+
+// Lets the pending winner claim their prize by sending any message
+func (g *GiveawayManager) handleMessage(client ChatClient, message ChatMessage) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	current, running := g.giveaways[message.Channel]
+	if !running || current.pendingWinner == "" || current.pendingWinner != strings.ToLower(message.User.Name) {
+		return
+	}
+
+	current.claimTimer.Stop()
+	current.record.Winners[len(current.record.Winners)-1].Claimed = true
+	current.pendingWinner = ""
+	g.saveRecord(current)
+	client.Say(message.Channel, fmt.Sprintf("Congratulations @%s, your prize has been claimed!", message.User.DisplayName))
+}
+
+// Ends the giveaway
+func (g *GiveawayManager) end(client ChatClient, channelName string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	current, running := g.giveaways[channelName]
+	if !running {
+		client.Say(channelName, "There is no giveaway running")
+		return
+	}
+
+	if current.closeTimer != nil {
+		current.closeTimer.Stop()
+	}
+	if current.claimTimer != nil {
+		current.claimTimer.Stop()
+	}
+	unregisterBuiltInCommand(current.record.Keyword)
+	delete(g.giveaways, channelName)
+
+	current.record.EndedAt = time.Now()
+	g.saveRecord(current)
+	client.Say(channelName, "The giveaway has ended")
+}
+
+// Sends the number of entrants and the winners so far
+func (g *GiveawayManager) status(client ChatClient, channelName string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	current, running := g.giveaways[channelName]
+	if !running {
+		client.Say(channelName, "There is no giveaway running")
+		return
+	}
+
+	var winners []string
+	for _, winner := range current.record.Winners {
+		if winner.Claimed {
+			winners = append(winners, winner.User)
+		}
+	}
+	status := fmt.Sprintf("%d entered the giveaway", len(current.entrants))
+	if current.open {
+		status += ", type " + commandPrefix(channelName) + current.record.Keyword + " to enter"
+	}
+	if len(winners) > 0 {
+		status += ". Winners: " + strings.Join(winners, ", ")
+	}
+	client.Say(channelName, status)
+}
+
+// Saves the giveaway to the channel's giveaway history, replacing the previous save of the same giveaway
+func (g *GiveawayManager) saveRecord(current *giveaway) {
+	history, err := GiveawayHistory(current.channel)
+	if err != nil {
+		logger.Error("Error loading giveaway history", "channel", current.channel, "error", err)
+		return
+	}
+
+	replaced := false
+	for i, record := range history {
+		if record.StartedAt.Equal(current.record.StartedAt) {
+			history[i] = current.record
+			replaced = true
+		}
+	}
+	if !replaced {
+		history = append(history, current.record)
+	}
+
+	err = writeJSONFile(channelDataFile("giveaways", current.channel), history)
+	if err != nil {
+		logger.Error("Error saving giveaway history", "channel", current.channel, "error", err)
+	}
+}
+
+// GiveawayHistory returns every giveaway that has been run in the channel, oldest first
+func GiveawayHistory(channelName string) ([]GiveawayRecord, error) {
+	var history []GiveawayRecord
+	err := readJSONFile(channelDataFile("giveaways", channelName), &history)
+	return history, err
+}
@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sets up an empty data folder and a giveaway manager with a seeded random number generator
+func setUpGiveaways(t *testing.T, claimTime time.Duration) func() {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDirectory = directory
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "goatbot"
+	IntervalMessageList = nil
+	InvokableCommandList = nil
+	builtInCommands = nil
+	messageListeners = nil
+	giveaways = NewGiveawayManager(claimTime, rand.New(rand.NewSource(1)))
+	registerMessageListener(giveaways.handleMessage)
+	registerBuiltInCommand(builtInCommand{invocation: "giveaway", modOnly: true, handler: giveaways.giveawayCommand})
+	return func() {
+		giveaways = nil
+		builtInCommands = nil
+		messageListeners = nil
+		dataDirectory = "data/"
+		_ = os.RemoveAll(directory)
+	}
+}
+
+// A message sent to the bot during a giveaway test
+type testMessage struct {
+	user   string
+	badges map[string]int
+	text   string
+}
+
+func modMessage(text string) testMessage {
+	return testMessage{user: "mod", badges: map[string]int{"moderator": 1}, text: text}
+}
+
+// Sends each message to the bot, waiting for any http or exec commands it invokes to reply before sending the next
+func sendMessages(client ChatClient, messages ...testMessage) {
+	handler := CommandHandler{}
+	for i, message := range messages {
+		onMessage(&handler, client, newChannelMessage(message.user, message.badges, message.text, string(rune('a'+i))))
+		backgroundCommands.Wait()
+	}
+}
+
+func TestGiveaway_EnterOnceAndClaim(t *testing.T) {
+	cleanUp := setUpGiveaways(t, time.Hour)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!giveaway start !enter"},
+		modMessage("!giveaway start !enter"),
+		testMessage{user: "viewer", text: "!enter"},
+		testMessage{user: "viewer", text: "!enter"},
+		modMessage("!giveaway status"),
+		modMessage("!giveaway draw"),
+	)
+	if client.messages[0] != "A giveaway has started! Type !enter to enter" {
+		t.Errorf("Test Failed: Expected the giveaway to start but was '%s'", client.messages[0])
+	}
+	if client.messages[1] != "1 entered the giveaway, type !enter to enter" {
+		t.Errorf("Test Failed: Expected viewer to only be entered once but was '%s'", client.messages[1])
+	}
+	if client.last() != "@viewer has won the giveaway! Say something in chat within 1h0m0s to claim your prize" {
+		t.Errorf("Test Failed: Expected viewer to win but was '%s'", client.last())
+	}
+
+	sendMessages(client, testMessage{user: "viewer", text: "yay"}, testMessage{user: "latecomer", text: "!enter"})
+	if client.last() != "Congratulations @viewer, your prize has been claimed!" {
+		t.Errorf("Test Failed: Expected viewer to claim their prize but was '%s'", client.last())
+	}
+
+	sendMessages(client, modMessage("!giveaway end"))
+	history, err := GiveawayHistory("testchannel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Keyword != "enter" || history[0].Entrants != 1 || history[0].EndedAt.IsZero() {
+		t.Fatalf("Test Failed: Expected one ended giveaway with one entrant in the history but was %+v", history)
+	}
+	if len(history[0].Winners) != 1 || history[0].Winners[0].User != "viewer" || !history[0].Winners[0].Claimed {
+		t.Errorf("Test Failed: Expected viewer to be saved as the claimed winner but was %+v", history[0].Winners)
+	}
+	if hasBuiltInCommand("enter") {
+		t.Error("Test Failed: Expected the keyword command to be removed when the giveaway ends")
+	}
+}
+
+func TestGiveaway_RerollsWhenUnclaimed(t *testing.T) {
+	cleanUp := setUpGiveaways(t, 20*time.Millisecond)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		modMessage("!giveaway start !enter"),
+		testMessage{user: "first", text: "!enter"},
+		testMessage{user: "second", text: "!enter"},
+		modMessage("!giveaway draw"),
+	)
+
+	deadline := time.Now().Add(time.Second)
+	for client.count() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	client.mutex.Lock()
+	messages := append([]string(nil), client.messages...)
+	client.mutex.Unlock()
+	if len(messages) < 4 {
+		t.Fatalf("Test Failed: Expected a re-roll but was %v", messages)
+	}
+	firstWinner := strings.TrimPrefix(strings.Fields(messages[1])[0], "@")
+	if messages[2] != firstWinner+" didn't claim their prize in time, re-rolling..." {
+		t.Errorf("Test Failed: Expected %s to time out but was '%s'", firstWinner, messages[2])
+	}
+	if messages[1] == messages[3] || !strings.HasSuffix(messages[3], "has won the giveaway! Say something in chat within 20ms to claim your prize") {
+		t.Errorf("Test Failed: Expected a different winner to be drawn but was '%s'", messages[3])
+	}
+}
+
+func TestGiveaway_WeightsSubscribers(t *testing.T) {
+	cleanUp := setUpGiveaways(t, time.Hour)
+	defer cleanUp()
+
+	subscriberWins := 0
+	for i := 0; i < 50; i++ {
+		client := &syncRecordingChatClient{}
+		sendMessages(client,
+			modMessage("!giveaway start !enter subs=9"),
+			testMessage{user: "viewer", text: "!enter"},
+			testMessage{user: "subscriber", badges: map[string]int{"subscriber": 1}, text: "!enter"},
+			modMessage("!giveaway draw"),
+			modMessage("!giveaway end"),
+		)
+		if client.messages[1] == "@subscriber has won the giveaway! Say something in chat within 1h0m0s to claim your prize" {
+			subscriberWins++
+		}
+	}
+
+	if subscriberWins < 35 {
+		t.Errorf("Test Failed: Expected the subscriber to win about 90%% of giveaways but won %d of 50", subscriberWins)
+	}
+}
+
+func TestGiveaway_ClosesAfterDuration(t *testing.T) {
+	cleanUp := setUpGiveaways(t, time.Hour)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, modMessage("!giveaway start enter 10ms"))
+	deadline := time.Now().Add(time.Second)
+	for client.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	sendMessages(client, testMessage{user: "viewer", text: "!enter"}, modMessage("!giveaway draw"))
+
+	if client.messages[0] != "A giveaway has started! Type !enter to enter, entries close in 10ms" {
+		t.Errorf("Test Failed: Expected the giveaway to start with a duration but was '%s'", client.messages[0])
+	}
+	if client.last() != "There is nobody left to draw" {
+		t.Errorf("Test Failed: Expected no entries after entries closed but was '%s'", client.last())
+	}
+}
+
+func TestGiveaway_KeywordCannotBeACommand(t *testing.T) {
+	cleanUp := setUpGiveaways(t, time.Hour)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, modMessage("!giveaway start giveaway"))
+	if client.last() != "The keyword !giveaway is already a command" {
+		t.Errorf("Test Failed: Expected the keyword to be rejected but was '%s'", client.last())
+	}
+}
+
+func TestGiveaway_LimitsEntries(t *testing.T) {
+	cleanUp := setUpGiveaways(t, time.Hour)
+	defer cleanUp()
+	pointsStore = NewPointsStore()
+	defer func() {
+		pointsStore = nil
+	}()
+	pointsStore.Add("testchannel", "rich", math.MaxInt64/2)
+	pointsStore.Add("testchannel", "richer", math.MaxInt64/2)
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		modMessage("!giveaway start !enter subs=9223372036854775807"),
+		modMessage("!giveaway start !enter subs=1000 points=1"),
+		testMessage{user: "rich", badges: map[string]int{"subscriber": 1}, text: "!enter"},
+		testMessage{user: "richer", badges: map[string]int{"subscriber": 1}, text: "!enter"},
+		modMessage("!giveaway draw"),
+	)
+	if client.messages[0] != "Invalid giveaway option 'subs=9223372036854775807'" {
+		t.Errorf("Test Failed: Expected the subscriber weight to be too high but was '%s'", client.messages[0])
+	}
+	if !strings.HasSuffix(client.last(), "has won the giveaway! Say something in chat within 1h0m0s to claim your prize") {
+		t.Errorf("Test Failed: Expected a winner to be drawn but was '%s'", client.last())
+	}
+
+	for _, entrant := range giveaways.giveaways["testchannel"].entrants {
+		if entrant.weight != maximumGiveawaySubscriberWeight+maximumGiveawayPointsEntries {
+			t.Errorf("Test Failed: Expected %s to have the most entries but had %d", entrant.user, entrant.weight)
+		}
+	}
+}
+
+func TestGiveaway_PointsNeedPointsFeature(t *testing.T) {
+	cleanUp := setUpGiveaways(t, time.Hour)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, modMessage("!giveaway start !enter points=100"), modMessage("!giveaway status"))
+	if client.messages[0] != "Points aren't turned on, so giveaway entries can't use them" {
+		t.Errorf("Test Failed: Expected points entries to be rejected but was '%s'", client.messages[0])
+	}
+	if client.last() != "There is no giveaway running" {
+		t.Errorf("Test Failed: Expected the giveaway not to start but was '%s'", client.last())
+	}
+}
@@ -0,0 +1,293 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHTTPTimeout  = 3 * time.Second
+	maximumHTTPTimeout  = 10 * time.Second
+	defaultHTTPFallback = "Sorry, that command isn't working right now"
+	// The placeholder in the message of an http command that is replaced with the value fetched
+	urlFetchKeyword = "$urlfetch"
+)
+
+// The largest response an http command will read
+var httpCommandMaxBytes int64 = 64 * 1024
+var httpCommandClient = &http.Client{}
+var httpCache = NewHTTPCache()
+
+// The most responses kept in the cache, since the arguments of a command are part of the key and anyone can change them
+var httpCacheMaxEntries = 500
+
+// HTTPRequest is the request an http command makes when it is invoked
+type HTTPRequest struct {
+	// The URL to request, which can contain the command's parameters and $username
+	URL     string            `json:"url"`
+	Method  string            `json:"method,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Picks a field out of a JSON response, e.g. `$.players[0].rank`. The whole response is used if it is empty
+	Select         string `json:"select,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+	CacheSeconds   int    `json:"cache_seconds,omitempty"`
+	// Sent instead of the message if the request fails
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Checks the http settings of a command loaded from a file
+func validateHTTPRequest(request *HTTPRequest) error {
+	if request == nil || request.URL == "" {
+		return errors.New("http commands need an http.url")
+	}
+	if !strings.HasPrefix(request.URL, "http://") && !strings.HasPrefix(request.URL, "https://") {
+		return errors.New("http.url must start with http:// or https://")
+	}
+	switch strings.ToUpper(request.Method) {
+	case "", http.MethodGet, http.MethodPost:
+	default:
+		return errors.New("http.method must be GET or POST")
+	}
+	if _, err := parseSelector(request.Select); err != nil {
+		return err
+	}
+	if request.TimeoutSeconds < 0 || time.Duration(request.TimeoutSeconds)*time.Second > maximumHTTPTimeout {
+		return fmt.Errorf("http.timeout_seconds must be between 0 and %d", int(maximumHTTPTimeout/time.Second))
+	}
+	if request.CacheSeconds < 0 {
+		return errors.New("http.cache_seconds cannot be negative")
+	}
+	return nil
+}
+
+// Fetches the command's URL and returns its message with $urlfetch replaced with the value fetched, or the fallback
+// message if the request fails
+func runHTTPCommand(handler CommandProcessor, message ChatMessage, command InvokableCommand, messageParameters []string) string {
+	request := command.HTTP
+	requestURL := strings.Replace(request.URL, "$username", url.QueryEscape(message.User.Name), -1)
+	escapedParameters := make([]string, len(messageParameters))
+	for i, parameter := range messageParameters {
+		escapedParameters[i] = url.QueryEscape(parameter)
+	}
+	requestURL = handler.ReplaceCommandPlaceholdersWithValues(requestURL, command.Parameters, escapedParameters)
+
+	value, err := fetchHTTPValue(request, requestURL)
+	if err != nil {
+		messageLogger(message).Warn("Error running http command", "command", command.Invocation, "url", requestURL, "error", err)
+		fallback := request.Fallback
+		if fallback == "" {
+			fallback = defaultHTTPFallback
+		}
+		return handler.ReplaceReservedKeywordsWithValues(fallback, message)
+	}
+
+	formattedMessage := handler.ReplaceReservedKeywordsWithValues(command.Message, message)
+	formattedMessage = handler.ReplaceCommandPlaceholdersWithValues(formattedMessage, command.Parameters, messageParameters)
+	return strings.Replace(formattedMessage, urlFetchKeyword, value, -1)
+}
+
+// Returns the selected value from the response to the request, using the cached response if there is one
+func fetchHTTPValue(request *HTTPRequest, requestURL string) (string, error) {
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	cacheKey := method + " " + requestURL + " " + request.Body
+
+	body, cached := httpCache.Get(cacheKey)
+	if !cached {
+		var err error
+		body, err = doHTTPRequest(request, method, requestURL)
+		if err != nil {
+			return "", err
+		}
+		if request.CacheSeconds > 0 {
+			httpCache.Set(cacheKey, body, time.Duration(request.CacheSeconds)*time.Second)
+		}
+	}
+
+	if request.Select == "" {
+		return strings.TrimSpace(string(body)), nil
+	}
+	var response interface{}
+	err := json.Unmarshal(body, &response)
+	if err != nil {
+		return "", fmt.Errorf("response is not JSON: %w", err)
+	}
+	return selectJSONValue(response, request.Select)
+}
+
+func doHTTPRequest(request *HTTPRequest, method string, requestURL string) ([]byte, error) {
+	timeout := defaultHTTPTimeout
+	if request.TimeoutSeconds > 0 {
+		timeout = time.Duration(request.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	httpRequest, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewBufferString(request.Body))
+	if err != nil {
+		return nil, err
+	}
+	httpRequest.Header.Set("User-Agent", "GoatBot")
+	for name, value := range request.Headers {
+		httpRequest.Header.Set(name, value)
+	}
+
+	response, err := httpCommandClient.Do(httpRequest)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("response status was %s", response.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, httpCommandMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > httpCommandMaxBytes {
+		return nil, fmt.Errorf("response is larger than %d bytes", httpCommandMaxBytes)
+	}
+	return body, nil
+}
+
+// Splits a selector like `$.players[0].rank` into the keys and indexes to follow, i.e. ["players", 0, "rank"]
+func parseSelector(selector string) ([]interface{}, error) {
+	selector = strings.TrimPrefix(strings.TrimPrefix(selector, "$"), ".")
+	var path []interface{}
+	for _, part := range strings.Split(selector, ".") {
+		if part == "" {
+			continue
+		}
+		key := part
+		if bracket := strings.Index(part, "["); bracket != -1 {
+			key = part[:bracket]
+		}
+		if key != "" {
+			path = append(path, key)
+		}
+
+		indexes := part[len(key):]
+		for indexes != "" {
+			closing := strings.Index(indexes, "]")
+			if !strings.HasPrefix(indexes, "[") || closing == -1 {
+				return nil, fmt.Errorf("invalid selector '%s'", selector)
+			}
+			index, err := strconv.Atoi(indexes[1:closing])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid index in selector '%s'", selector)
+			}
+			path = append(path, index)
+			indexes = indexes[closing+1:]
+		}
+	}
+	return path, nil
+}
+
+// Follows the selector through the decoded JSON response and formats the value it ends at
+func selectJSONValue(response interface{}, selector string) (string, error) {
+	path, err := parseSelector(selector)
+	if err != nil {
+		return "", err
+	}
+
+	value := response
+	for _, step := range path {
+		switch step := step.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return "", fmt.Errorf("%s not found in response", selector)
+			}
+			value, ok = object[step]
+			if !ok {
+				return "", fmt.Errorf("%s not found in response", selector)
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok || step >= len(array) {
+				return "", fmt.Errorf("%s not found in response", selector)
+			}
+			value = array[step]
+		}
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return "", fmt.Errorf("%s is null in response", selector)
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
+
+// HTTPCache keeps the responses of http commands for as long as each command's cache_seconds
+type HTTPCache struct {
+	mutex   sync.Mutex
+	entries map[string]httpCacheEntry
+	// The number of responses cached so far, used to find the oldest response
+	added uint64
+}
+
+type httpCacheEntry struct {
+	body    []byte
+	order   uint64
+	expires time.Time
+}
+
+// NewHTTPCache creates an empty HTTPCache
+func NewHTTPCache() *HTTPCache {
+	return &HTTPCache{entries: map[string]httpCacheEntry{}}
+}
+
+// Get returns the cached response for the key if it has not expired
+func (c *HTTPCache) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// Set caches the response for the key for the given duration, removing any other responses that have expired and the
+// oldest response if the cache is full
+func (c *HTTPCache) Set(key string, body []byte, duration time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := time.Now()
+	oldestKey := ""
+	var oldest uint64
+	for existingKey, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, existingKey)
+		} else if oldestKey == "" || entry.order < oldest {
+			oldestKey, oldest = existingKey, entry.order
+		}
+	}
+	if _, exists := c.entries[key]; !exists && len(c.entries) >= httpCacheMaxEntries {
+		delete(c.entries, oldestKey)
+	}
+	c.added++
+	c.entries[key] = httpCacheEntry{body: body, order: c.added, expires: now.Add(duration)}
+}
@@ -0,0 +1,289 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Sets up empty commands and data folders, an empty cache and a stats server that counts its requests
+func setUpHTTPCommands(t *testing.T) (*httptest.Server, *int32, func()) {
+	cleanUp := setUpScripts(t)
+	cooldowns = NewCooldownTracker()
+	httpCache = NewHTTPCache()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch request.URL.Path {
+		case "/players/goat":
+			_, _ = fmt.Fprint(writer, `{"player": {"name": "goat", "ranks": [{"rank": 3}, {"rank": 7}], "online": true}}`)
+		case "/players":
+			body, _ := io.ReadAll(request.Body)
+			_, _ = fmt.Fprintf(writer, `{"method": "%s", "body": %q, "token": "%s"}`, request.Method, body, request.Header.Get("Authorization"))
+		case "/text":
+			_, _ = fmt.Fprint(writer, " plain text \n")
+		case "/slow":
+			time.Sleep(1500 * time.Millisecond)
+		case "/large":
+			_, _ = fmt.Fprint(writer, strings.Repeat("a", int(httpCommandMaxBytes)+1))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, &requests, func() {
+		server.Close()
+		cleanUp()
+	}
+}
+
+func TestHTTPCommand_Select(t *testing.T) {
+	server, _, cleanUp := setUpHTTPCommands(t)
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "rank",
+		Parameters: []CommandParameter{{Name: "player"}},
+		Message:    "$player is rank $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/players/$player", Select: "$.player.ranks[1].rank"},
+	}, {
+		Invocation: "online",
+		Message:    "Online: $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/players/goat", Select: "player.online"},
+	}, {
+		Invocation: "text",
+		Message:    "Says $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/text"},
+	}}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!rank goat"},
+		testMessage{user: "viewer", text: "!online"},
+		testMessage{user: "viewer", text: "!text"},
+		testMessage{user: "viewer", text: "!rank"},
+	)
+	expectMessages(t, []string{"goat is rank 7", "Online: true", "Says plain text", "Invalid usage of command"}, client.messages)
+}
+
+func TestHTTPCommand_Post(t *testing.T) {
+	server, _, cleanUp := setUpHTTPCommands(t)
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "post",
+		Message:    "$urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP: &HTTPRequest{
+			URL:     server.URL + "/players",
+			Method:  "post",
+			Body:    "hello",
+			Headers: map[string]string{"Authorization": "secret"},
+		},
+	}}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: "!post"})
+	expectMessages(t, []string{`{"method": "POST", "body": "hello", "token": "secret"}`}, client.messages)
+}
+
+func TestHTTPCommand_Fallback(t *testing.T) {
+	server, _, cleanUp := setUpHTTPCommands(t)
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "missing",
+		Message:    "Got $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/missing", Fallback: "Sorry $username, no stats"},
+	}, {
+		Invocation: "field",
+		Message:    "Got $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/players/goat", Select: "player.missing"},
+	}, {
+		Invocation: "slow",
+		Message:    "Got $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/slow", TimeoutSeconds: 1},
+	}, {
+		Invocation: "large",
+		Message:    "Got $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/large"},
+	}}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!missing"},
+		testMessage{user: "viewer", text: "!field"},
+		testMessage{user: "viewer", text: "!slow"},
+		testMessage{user: "viewer", text: "!large"},
+	)
+	expectMessages(t, []string{"Sorry viewer, no stats", defaultHTTPFallback, defaultHTTPFallback, defaultHTTPFallback}, client.messages)
+}
+
+func TestHTTPCommand_Cache(t *testing.T) {
+	server, requests, cleanUp := setUpHTTPCommands(t)
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "cached",
+		Parameters: []CommandParameter{{Name: "player"}},
+		Message:    "$urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/players/$player", Select: "player.name", CacheSeconds: 60},
+	}}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!cached goat"},
+		testMessage{user: "viewer", text: "!cached goat"},
+		testMessage{user: "viewer", text: "!cached sheep"},
+	)
+	expectMessages(t, []string{"goat", "goat", defaultHTTPFallback}, client.messages)
+	if atomic.LoadInt32(requests) != 2 {
+		t.Errorf("Test Failed: Expected 2 requests, one for each URL, but was %d", atomic.LoadInt32(requests))
+	}
+}
+
+func TestLoadStandardCommand_HTTP(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+
+	valid := `{"invocation": "rank", "message": "$urlfetch", "type": "http", "http": {"url": "https://example.com/rank", "select": "$.ranks[0]"}}`
+	if err := loadStandardCommand("rank.command.json", []byte(valid)); err != nil {
+		t.Errorf("Test Failed: Expected the http command to load but got %v", err)
+	}
+
+	for _, invalid := range []string{
+		`{"invocation": "rank", "message": "$urlfetch", "type": "http"}`,
+		`{"invocation": "rank", "message": "$urlfetch", "type": "http", "http": {"url": "file:///etc/passwd"}}`,
+		`{"invocation": "rank", "message": "$urlfetch", "type": "http", "http": {"url": "https://example.com", "method": "DELETE"}}`,
+		`{"invocation": "rank", "message": "$urlfetch", "type": "http", "http": {"url": "https://example.com", "select": "ranks[x]"}}`,
+		`{"invocation": "rank", "message": "$urlfetch", "type": "ftp"}`,
+	} {
+		if loadStandardCommand("rank.command.json", []byte(invalid)) == nil {
+			t.Errorf("Test Failed: Expected an error loading %s", invalid)
+		}
+	}
+}
+
+func TestHTTPCommand_RunsInTheBackground(t *testing.T) {
+	server, _, cleanUp := setUpHTTPCommands(t)
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "slow",
+		Message:    "Slow response$urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/slow", TimeoutSeconds: 3},
+	}, {
+		Invocation: "hello",
+		Message:    "Hello!",
+	}}
+
+	client := &syncRecordingChatClient{}
+	handler := CommandHandler{}
+	start := time.Now()
+	onMessage(&handler, client, newChannelMessage("viewer", nil, "!slow", "1"))
+	onMessage(&handler, client, newChannelMessage("viewer", nil, "!hello", "2"))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Test Failed: Expected the slow command not to hold up other messages but took %s", elapsed)
+	}
+	if client.count() != 1 || client.last() != "Hello!" {
+		t.Errorf("Test Failed: Expected the next message to be answered first but was %v", client.messages)
+	}
+
+	backgroundCommands.Wait()
+	expectMessages(t, []string{"Hello!", "Slow response"}, client.messages)
+}
+
+func TestHTTPCache_LimitsEntries(t *testing.T) {
+	httpCacheMaxEntries = 2
+	defer func() {
+		httpCacheMaxEntries = 500
+	}()
+
+	cache := NewHTTPCache()
+	cache.Set("expired", []byte("gone"), -time.Second)
+	cache.Set("first", []byte("1"), time.Minute)
+	cache.Set("second", []byte("2"), time.Minute)
+	cache.Set("third", []byte("3"), time.Minute)
+
+	if _, ok := cache.Get("first"); ok {
+		t.Error("Test Failed: Expected the oldest response to be removed when the cache was full")
+	}
+	if len(cache.entries) != 2 {
+		t.Errorf("Test Failed: Expected 2 responses to be cached but was %d", len(cache.entries))
+	}
+	for _, key := range []string{"second", "third"} {
+		if _, ok := cache.Get(key); !ok {
+			t.Errorf("Test Failed: Expected the %s response to be cached", key)
+		}
+	}
+}
+
+func TestHTTPCommand_LimitsCommandsInTheBackground(t *testing.T) {
+	server, requests, cleanUp := setUpHTTPCommands(t)
+	defer cleanUp()
+	slots := backgroundCommandSlots[commandTypeHTTP]
+	backgroundCommandSlots[commandTypeHTTP] = make(chan struct{}, 1)
+	defer func() {
+		backgroundCommandSlots[commandTypeHTTP] = slots
+	}()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "slow",
+		Message:    "Slow response$urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/slow", TimeoutSeconds: 3},
+	}}
+
+	client := &syncRecordingChatClient{}
+	handler := CommandHandler{}
+	for i, user := range []string{"viewer", "other", "another"} {
+		onMessage(&handler, client, newChannelMessage(user, nil, "!slow", strconv.Itoa(i)))
+	}
+	backgroundCommands.Wait()
+
+	expectMessages(t, []string{"Slow response"}, client.messages)
+	if count := atomic.LoadInt32(requests); count != 1 {
+		t.Errorf("Test Failed: Expected the commands past the limit to be dropped but there were %d requests", count)
+	}
+
+	// The slot is free again once the command has replied
+	sendMessages(client, testMessage{user: "viewer", text: "!slow"})
+	if client.count() != 2 {
+		t.Errorf("Test Failed: Expected the command to run once the slot was free but was %v", client.messages)
+	}
+}
+
+func TestRunConsole_WaitsForCommandsInTheBackground(t *testing.T) {
+	server, _, cleanUp := setUpHTTPCommands(t)
+	defer cleanUp()
+	nickname = "GoatBot"
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "text",
+		Message:    "Fetched: $urlfetch",
+		Type:       commandTypeHTTP,
+		HTTP:       &HTTPRequest{URL: server.URL + "/text"},
+	}}
+
+	var out bytes.Buffer
+	RunConsole(strings.NewReader("!text\n"), &out, ConsoleUser{Name: "viewer"})
+	if out.String() != "[#testchannel] GoatBot: Fetched: plain text\n" {
+		t.Error("Test Failed: Expected the http command's reply before the console returned but was '" + out.String() + "'")
+	}
+}
@@ -0,0 +1,401 @@
+package bot
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const ircPingTimeout = 5 * time.Minute
+
+// Channel membership prefixes from NAMES replies, and the roles they give. Voiced users can use mod only commands, the
+// same as ops
+var ircPrefixRoles = map[byte]string{
+	'~': "broadcaster",
+	'&': "moderator",
+	'@': "moderator",
+	'%': "moderator",
+	'+': "voice",
+}
+
+// Channel modes that give a user a role
+var ircModeRoles = map[byte]string{
+	'q': "broadcaster",
+	'a': "moderator",
+	'o': "moderator",
+	'h': "moderator",
+	'v': "voice",
+}
+
+// ircLine is a line received from an IRC server, e.g. `@msgid=1 :nick!user@host PRIVMSG #channel :hello`
+type ircLine struct {
+	Tags    map[string]string
+	Nick    string
+	Command string
+	Params  []string
+}
+
+// Parses a line in the RFC 1459 format, with IRCv3 message tags
+func parseIRCLine(line string) (ircLine, error) {
+	parsed := ircLine{Tags: map[string]string{}}
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		space := strings.Index(line, " ")
+		if space == -1 {
+			return parsed, errors.New("line has tags but no command")
+		}
+		for _, tag := range strings.Split(line[1:space], ";") {
+			parts := strings.SplitN(tag, "=", 2)
+			if len(parts) == 2 {
+				parsed.Tags[parts[0]] = unescapeIRCTag(parts[1])
+			} else {
+				parsed.Tags[parts[0]] = ""
+			}
+		}
+		line = strings.TrimLeft(line[space+1:], " ")
+	}
+
+	if strings.HasPrefix(line, ":") {
+		space := strings.Index(line, " ")
+		if space == -1 {
+			return parsed, errors.New("line has a source but no command")
+		}
+		source := line[1:space]
+		if bang := strings.Index(source, "!"); bang != -1 {
+			source = source[:bang]
+		}
+		parsed.Nick = source
+		line = strings.TrimLeft(line[space+1:], " ")
+	}
+
+	trailing := ""
+	hasTrailing := false
+	if colon := strings.Index(line, " :"); colon != -1 {
+		trailing = line[colon+2:]
+		hasTrailing = true
+		line = line[:colon]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return parsed, errors.New("line has no command")
+	}
+	parsed.Command = strings.ToUpper(fields[0])
+	parsed.Params = fields[1:]
+	if hasTrailing {
+		parsed.Params = append(parsed.Params, trailing)
+	}
+	return parsed, nil
+}
+
+func unescapeIRCTag(value string) string {
+	var unescaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			unescaped.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case ':':
+			unescaped.WriteByte(';')
+		case 's':
+			unescaped.WriteByte(' ')
+		case 'r':
+			unescaped.WriteByte('\r')
+		case 'n':
+			unescaped.WriteByte('\n')
+		default:
+			unescaped.WriteByte(value[i])
+		}
+	}
+	return unescaped.String()
+}
+
+// IRCBackend connects the bot to a channel on a plain IRC network, such as Libera.Chat or a private IRCd
+type IRCBackend struct {
+	address  string
+	useTLS   bool
+	password string
+
+	mutex   sync.Mutex
+	conn    net.Conn
+	nick    string
+	roles   map[string]map[string]bool
+	closing bool
+	count   uint64
+}
+
+// NewIRCBackend creates an IRCBackend that connects to the server at address, e.g. irc.libera.chat:6697, sending the
+// password as the server password if it is set
+func NewIRCBackend(address string, useTLS bool, password string) *IRCBackend {
+	return &IRCBackend{address: address, useTLS: useTLS, password: password}
+}
+
+// Say sends a message to the channel
+func (b *IRCBackend) Say(channelName string, text string) {
+	b.send("PRIVMSG " + ircChannel(channelName) + " :" + stripNewLines(text))
+}
+
+// Disconnect quits the server, making Connect return
+func (b *IRCBackend) Disconnect() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.closing = true
+	if b.conn == nil {
+		return nil
+	}
+	_, _ = fmt.Fprint(b.conn, "QUIT :Goodbye\r\n")
+	return b.conn.Close()
+}
+
+// Connect registers with the server, joins the channel and handles its messages until the connection is closed
+func (b *IRCBackend) Connect(channelName string, handler func(message ChatMessage)) error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	if b.useTLS {
+		var host string
+		host, _, err = net.SplitHostPort(b.address)
+		if err != nil {
+			return err
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", b.address)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.mutex.Lock()
+	if b.closing {
+		b.mutex.Unlock()
+		_ = conn.Close()
+		return nil
+	}
+	b.conn = conn
+	b.nick = nickname
+	b.roles = map[string]map[string]bool{}
+	b.mutex.Unlock()
+
+	// multi-prefix lists every prefix a user has in NAMES replies, so losing op doesn't hide that they still have voice
+	b.send("CAP REQ :multi-prefix message-tags")
+	if b.password != "" {
+		b.send("PASS " + b.password)
+	}
+	b.send("NICK " + nickname)
+	b.send("USER " + nickname + " 0 * :GoatBot")
+
+	reader := bufio.NewReader(conn)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(ircPingTimeout))
+		text, err := reader.ReadString('\n')
+		if err != nil {
+			b.mutex.Lock()
+			closing := b.closing
+			b.mutex.Unlock()
+			metrics.Disconnected()
+			if closing {
+				return nil
+			}
+			return err
+		}
+
+		line, err := parseIRCLine(text)
+		if err != nil {
+			logger.Debug("Ignoring invalid IRC line", "line", strings.TrimSpace(text), "error", err)
+			continue
+		}
+		b.handleLine(line, channelName, handler)
+	}
+}
+
+func (b *IRCBackend) handleLine(line ircLine, channelName string, handler func(message ChatMessage)) {
+	switch line.Command {
+	case "PING":
+		b.send("PONG :" + strings.Join(line.Params, " "))
+	case "CAP":
+		if len(line.Params) > 1 && (line.Params[1] == "ACK" || line.Params[1] == "NAK") {
+			b.send("CAP END")
+		}
+	case "001":
+		if len(line.Params) > 0 {
+			b.mutex.Lock()
+			b.nick = line.Params[0]
+			b.mutex.Unlock()
+		}
+		metrics.Connected()
+		logger.Info("Connected", "channel", channelName, "address", b.address)
+		b.send("JOIN " + ircChannel(channelName))
+	case "433":
+		// The nickname is taken, so try again with an underscore on the end
+		b.mutex.Lock()
+		b.nick += "_"
+		nick := b.nick
+		b.mutex.Unlock()
+		b.send("NICK " + nick)
+	case "353":
+		// RPL_NAMREPLY: <me> <type> <channel> :<prefixed nicks>
+		if len(line.Params) >= 4 {
+			for _, name := range strings.Fields(line.Params[3]) {
+				nick := strings.TrimLeft(name, "~&@%+")
+				for i := 0; i < len(name)-len(nick); i++ {
+					b.setRole(nick, ircPrefixRoles[name[i]], true)
+				}
+			}
+		}
+	case "MODE":
+		b.handleMode(line)
+	case "NICK":
+		if len(line.Params) > 0 {
+			b.renameUser(line.Nick, line.Params[0])
+		}
+	case "PART", "QUIT":
+		b.removeUser(line.Nick)
+	case "KICK":
+		if len(line.Params) > 1 {
+			b.removeUser(line.Params[1])
+		}
+	case "PRIVMSG":
+		if len(line.Params) < 2 || !strings.EqualFold(line.Params[0], ircChannel(channelName)) {
+			return
+		}
+		b.mutex.Lock()
+		fromSelf := strings.EqualFold(line.Nick, b.nick)
+		b.mutex.Unlock()
+		text := line.Params[1]
+		// Ignore the bot's own messages echoed back and CTCP requests such as /me and VERSION
+		if fromSelf || strings.HasPrefix(text, "\x01") {
+			return
+		}
+		handler(b.chatMessage(line, channelName))
+	}
+}
+
+// Creates a ChatMessage from a PRIVMSG line, with the sender's roles from their channel modes
+func (b *IRCBackend) chatMessage(line ircLine, channelName string) ChatMessage {
+	id := line.Tags["msgid"]
+	if id == "" {
+		id = "irc-" + strconv.FormatUint(atomic.AddUint64(&b.count, 1), 10)
+	}
+	sentAt := time.Now()
+	if serverTime, err := time.Parse(time.RFC3339Nano, line.Tags["time"]); err == nil {
+		sentAt = serverTime
+	}
+
+	badges := map[string]int{}
+	b.mutex.Lock()
+	for role := range b.roles[strings.ToLower(line.Nick)] {
+		badges[role] = 1
+	}
+	b.mutex.Unlock()
+	if badges["voice"] == 1 {
+		badges["moderator"] = 1
+	}
+
+	return ChatMessage{
+		ID:      id,
+		Channel: channelName,
+		User: ChatUser{
+			Name:        strings.ToLower(line.Nick),
+			DisplayName: line.Nick,
+			Badges:      badges,
+		},
+		Message: line.Params[1],
+		Time:    sentAt,
+	}
+}
+
+// Updates roles from a channel MODE change, e.g. `MODE #channel +ov-v alice alice bob`
+func (b *IRCBackend) handleMode(line ircLine) {
+	if len(line.Params) < 2 || !strings.HasPrefix(line.Params[0], "#") {
+		return
+	}
+	arguments := line.Params[2:]
+	adding := true
+	for i := 0; i < len(line.Params[1]); i++ {
+		mode := line.Params[1][i]
+		switch {
+		case mode == '+':
+			adding = true
+		case mode == '-':
+			adding = false
+		case ircModeRoles[mode] != "":
+			if len(arguments) == 0 {
+				return
+			}
+			b.setRole(arguments[0], ircModeRoles[mode], adding)
+			arguments = arguments[1:]
+		case strings.IndexByte("beIkl", mode) != -1:
+			// Modes that take an argument but don't give a role. l only takes one when it is set
+			if len(arguments) > 0 && (mode != 'l' || adding) {
+				arguments = arguments[1:]
+			}
+		}
+	}
+}
+
+func (b *IRCBackend) setRole(nick string, role string, has bool) {
+	if role == "" || nick == "" {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	nick = strings.ToLower(nick)
+	if b.roles[nick] == nil {
+		b.roles[nick] = map[string]bool{}
+	}
+	if has {
+		b.roles[nick][role] = true
+	} else {
+		delete(b.roles[nick], role)
+	}
+}
+
+func (b *IRCBackend) renameUser(from string, to string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if strings.EqualFold(from, b.nick) {
+		b.nick = to
+	}
+	if roles, ok := b.roles[strings.ToLower(from)]; ok {
+		delete(b.roles, strings.ToLower(from))
+		b.roles[strings.ToLower(to)] = roles
+	}
+}
+
+func (b *IRCBackend) removeUser(nick string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.roles, strings.ToLower(nick))
+}
+
+// Sends a line to the server
+func (b *IRCBackend) send(line string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.conn == nil {
+		logger.Warn("Not connected to IRC, dropping message", "line", line)
+		return
+	}
+	_, err := fmt.Fprint(b.conn, line+"\r\n")
+	if err != nil {
+		logger.Warn("Error sending to IRC", "error", err)
+	}
+}
+
+// Returns the IRC name of the channel, which starts with #
+func ircChannel(channelName string) string {
+	if strings.HasPrefix(channelName, "#") {
+		return channelName
+	}
+	return "#" + channelName
+}
@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"bufio"
+	"crypto/x509"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseIRCLine(t *testing.T) {
+	line, err := parseIRCLine("@msgid=abc;note=a\\sb\\:c :Nick!user@host PRIVMSG #channel :hello there :)\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line.Tags["msgid"] != "abc" || line.Tags["note"] != "a b;c" {
+		t.Errorf("Test Failed: Expected the tags to be parsed but were %v", line.Tags)
+	}
+	if line.Nick != "Nick" || line.Command != "PRIVMSG" || len(line.Params) != 2 || line.Params[0] != "#channel" || line.Params[1] != "hello there :)" {
+		t.Errorf("Test Failed: Expected the PRIVMSG to be parsed but was %+v", line)
+	}
+
+	line, err = parseIRCLine("ping irc.example.com")
+	if err != nil || line.Command != "PING" || line.Nick != "" || len(line.Params) != 1 || line.Params[0] != "irc.example.com" {
+		t.Errorf("Test Failed: Expected the PING to be parsed but was %+v, %v", line, err)
+	}
+
+	if _, err = parseIRCLine(":source.only"); err == nil {
+		t.Error("Test Failed: Expected an error for a line without a command")
+	}
+}
+
+// fakeIRCd is an in-process IRC server that registers the bot, sends it lines and records what it sends back
+type fakeIRCd struct {
+	listener net.Listener
+	conns    chan net.Conn
+	lines    chan string
+}
+
+func newFakeIRCd(t *testing.T) *fakeIRCd {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeIRCd{listener: listener, conns: make(chan net.Conn, 1), lines: make(chan string, 100)}
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		server.conns <- conn
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			server.lines <- scanner.Text()
+		}
+		close(server.lines)
+	}()
+	return server
+}
+
+// Waits for the bot to send a line starting with the given text, skipping any other lines
+func (s *fakeIRCd) expect(t *testing.T, start string) string {
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case line := <-s.lines:
+			if strings.HasPrefix(line, start) {
+				return line
+			}
+		case <-timeout:
+			t.Fatalf("Test Failed: Timed out waiting for the bot to send '%s'", start)
+			return ""
+		}
+	}
+}
+
+func TestIRCBackend_CommandsAndRoles(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	cooldowns = NewCooldownTracker()
+	metrics = NewMetrics()
+	InvokableCommandList = []InvokableCommand{
+		{Invocation: "hello", Message: "Hi, $username!"},
+		{Invocation: "ping", Message: "Pong!", ModOnly: true},
+	}
+
+	server := newFakeIRCd(t)
+	defer server.listener.Close()
+	backend := NewIRCBackend(server.listener.Addr().String(), false, "serverpass")
+	done := make(chan error, 1)
+	go func() {
+		done <- connect(backend, backend)
+	}()
+	conn := <-server.conns
+	send := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	server.expect(t, "CAP REQ :multi-prefix message-tags")
+	server.expect(t, "PASS serverpass")
+	server.expect(t, "NICK goatbot")
+	send(":irc.example.com CAP * ACK :multi-prefix message-tags")
+	server.expect(t, "CAP END")
+	send(":irc.example.com 001 goatbot :Welcome")
+	server.expect(t, "JOIN #testchannel")
+	send(":irc.example.com 353 goatbot = #testchannel :@Op +Voiced viewer goatbot")
+	send("PING :irc.example.com")
+	server.expect(t, "PONG :irc.example.com")
+
+	send(":viewer!v@host PRIVMSG #testchannel :!hello")
+	if line := server.expect(t, "PRIVMSG"); line != "PRIVMSG #testchannel :Hi, viewer!" {
+		t.Errorf("Test Failed: Expected the bot to respond to !hello but sent '%s'", line)
+	}
+
+	send(":viewer!v@host PRIVMSG #testchannel :!ping")
+	send(":Op!o@host PRIVMSG #testchannel :!ping")
+	send(":Voiced!v@host PRIVMSG #testchannel :!ping")
+	send(":irc.example.com MODE #testchannel +o-v viewer Voiced")
+	send(":viewer!v@host NICK newname")
+	send(":newname!v@host PRIVMSG #testchannel :!ping")
+	send(":Voiced!v@host PRIVMSG #testchannel :!ping")
+	send(":Op!o@host PRIVMSG #otherchannel :!ping")
+	send(":Op!o@host PRIVMSG #testchannel :\x01VERSION\x01")
+	send(":goatbot!g@host PRIVMSG #testchannel :!ping")
+	send(":viewer2!v@host PRIVMSG #testchannel :!hello\r\nQUIT")
+
+	var responses []string
+	for i := 0; i < 4; i++ {
+		responses = append(responses, server.expect(t, "PRIVMSG"))
+	}
+	expected := []string{
+		"PRIVMSG #testchannel :Pong!",
+		"PRIVMSG #testchannel :Pong!",
+		"PRIVMSG #testchannel :Pong!",
+		"PRIVMSG #testchannel :Hi, viewer2!",
+	}
+	expectMessages(t, expected, responses)
+
+	_ = backend.Disconnect()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Test Failed: Expected Connect to return without an error after disconnecting but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("Test Failed: Timed out waiting for the bot to disconnect")
+	}
+}
+
+func TestIRCBackend_TLSServerName(t *testing.T) {
+	if err := NewIRCBackend("irc.example.com", true, "").Connect("testchannel", nil); err == nil || !strings.Contains(err.Error(), "missing port") {
+		t.Errorf("Test Failed: Expected an address without a port to be rejected but got %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available:", err)
+	}
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.Listener = listener
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	// The test certificate is valid for ::1 but isn't trusted, so the handshake can only fail once the name has matched
+	err = NewIRCBackend(listener.Addr().String(), true, "").Connect("testchannel", nil)
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Errorf("Test Failed: Expected the IPv6 address to match the certificate but got %v", err)
+	}
+}
@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// SetLogger replaces the logger used by the bot
+func SetLogger(newLogger *slog.Logger) {
+	logger = newLogger
+}
+
+// NewLogger creates a logger that writes to out at the given level (debug, info, warn or error) in the given format
+// (text or json). An empty level or format uses the defaults of info and text
+func NewLogger(out io.Writer, level string, format string) (*slog.Logger, error) {
+	var logLevel slog.Level
+	switch strings.ToLower(level) {
+	case "debug":
+		logLevel = slog.LevelDebug
+	case "", "info":
+		logLevel = slog.LevelInfo
+	case "warn", "warning":
+		logLevel = slog.LevelWarn
+	case "error":
+		logLevel = slog.LevelError
+	default:
+		return nil, errors.New("unknown log level '" + level + "'")
+	}
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(out, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, options)), nil
+	default:
+		return nil, errors.New("unknown log format '" + format + "'")
+	}
+}
+
+// Returns a logger with the channel, user and id of the message
+func messageLogger(message ChatMessage) *slog.Logger {
+	return logger.With("channel", message.Channel, "user", message.User.Name, "message_id", message.ID)
+}
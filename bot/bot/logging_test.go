@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger_JSONWithMessageFields(t *testing.T) {
+	var out bytes.Buffer
+	jsonLogger, err := NewLogger(&out, "info", "json")
+	if err != nil {
+		t.Fatal("Test Failed: Expected no error but was: " + err.Error())
+	}
+	previousLogger := logger
+	SetLogger(jsonLogger)
+	defer SetLogger(previousLogger)
+
+	messageLogger(ChatMessage{Channel: "testchannel", User: ChatUser{Name: "viewer"}, ID: "abc"}).Info("test", "command", "hello")
+
+	var entry map[string]interface{}
+	err = json.Unmarshal(out.Bytes(), &entry)
+	if err != nil {
+		t.Fatal("Test Failed: Expected a JSON log entry but was: " + out.String())
+	}
+	expected := map[string]string{"msg": "test", "channel": "testchannel", "user": "viewer", "message_id": "abc", "command": "hello"}
+	for key, value := range expected {
+		if entry[key] != value {
+			t.Errorf("Test Failed: Expected %s to be '%s' but was '%v'", key, value, entry[key])
+		}
+	}
+}
+
+func TestNewLogger_Level(t *testing.T) {
+	var out bytes.Buffer
+	warnLogger, _ := NewLogger(&out, "warn", "text")
+	warnLogger.Info("hidden")
+	warnLogger.Warn("shown")
+
+	if strings.Contains(out.String(), "hidden") || !strings.Contains(out.String(), "shown") {
+		t.Error("Test Failed: Expected only warnings to be logged but was: " + out.String())
+	}
+}
+
+func TestNewLogger_Invalid(t *testing.T) {
+	_, err := NewLogger(&bytes.Buffer{}, "loud", "text")
+	if err == nil {
+		t.Error("Test Failed: Expected an error for an unknown level")
+	}
+
+	_, err = NewLogger(&bytes.Buffer{}, "info", "xml")
+	if err == nil {
+		t.Error("Test Failed: Expected an error for an unknown format")
+	}
+}
+
+func TestOnMessage_NoPrefixDoesNotExit(t *testing.T) {
+	var out bytes.Buffer
+	previousLogger := logger
+	textLogger, _ := NewLogger(&out, "debug", "text")
+	SetLogger(textLogger)
+	defer SetLogger(previousLogger)
+
+	prefix = ""
+	IntervalMessageList = nil
+	client := RecordingChatClient{}
+	onMessage(&CommandHandler{}, &client, ChatMessage{Message: "!hello"})
+
+	if !strings.Contains(out.String(), "Ignoring message, no prefix defined") {
+		t.Error("Test Failed: Expected an error to be logged but was: " + out.String())
+	}
+}
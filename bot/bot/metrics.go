@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the bot can be disconnected from IRC before /healthz reports it as unhealthy
+const healthGracePeriod = 2 * time.Minute
+
+// Metrics records counters and gauges about the bot that are exposed in the Prometheus text format
+type Metrics struct {
+	mutex             sync.Mutex
+	messagesSeen      uint64
+	commandsInvoked   map[string]uint64
+	permissionDenials map[string]uint64
+	cooldownHits      map[string]uint64
+	parseErrors       uint64
+	reconnects        uint64
+	lastMessageTimes  map[string]time.Time
+	connected         bool
+	hasConnected      bool
+	disconnectedSince time.Time
+}
+
+var metrics = NewMetrics()
+
+// NewMetrics creates a Metrics with every counter at zero and the bot disconnected
+func NewMetrics() *Metrics {
+	return &Metrics{
+		commandsInvoked:   map[string]uint64{},
+		permissionDenials: map[string]uint64{},
+		cooldownHits:      map[string]uint64{},
+		lastMessageTimes:  map[string]time.Time{},
+		disconnectedSince: time.Now(),
+	}
+}
+
+// MessageSeen records a message being received in a channel
+func (m *Metrics) MessageSeen(channel string, at time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.messagesSeen++
+	m.lastMessageTimes[channel] = at
+}
+
+// CommandInvoked records a command being successfully invoked
+func (m *Metrics) CommandInvoked(invocation string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.commandsInvoked[invocation]++
+}
+
+// PermissionDenied records a user trying to invoke a command they do not have permission to use
+func (m *Metrics) PermissionDenied(invocation string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.permissionDenials[invocation]++
+}
+
+// CooldownHit records a user trying to invoke a command that is on cooldown
+func (m *Metrics) CooldownHit(invocation string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.cooldownHits[invocation]++
+}
+
+// ParseError records a message that could not be parsed as a command
+func (m *Metrics) ParseError() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.parseErrors++
+}
+
+// Connected records the bot connecting to IRC, counting it as a reconnect if it has connected before
+func (m *Metrics) Connected() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.hasConnected {
+		m.reconnects++
+	}
+	m.hasConnected = true
+	m.connected = true
+}
+
+// Disconnected records the bot losing its connection to IRC
+func (m *Metrics) Disconnected() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.connected {
+		m.disconnectedSince = time.Now()
+	}
+	m.connected = false
+}
+
+// IsConnected returns whether the bot is currently connected to IRC
+func (m *Metrics) IsConnected() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.connected
+}
+
+// IsHealthy returns false if the bot has been disconnected from IRC for longer than the grace period
+func (m *Metrics) IsHealthy() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.connected || time.Since(m.disconnectedSince) < healthGracePeriod
+}
+
+// WritePrometheus writes the metrics in the Prometheus text format, including the outgoing queue metrics of chatClient if it
+// is rate limited
+func (m *Metrics) WritePrometheus(writer io.Writer, chatClient ChatClient) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var output strings.Builder
+	writeMetric(&output, "goatbot_messages_seen_total", "counter", "Chat messages received")
+	writeSample(&output, "goatbot_messages_seen_total", "", float64(m.messagesSeen))
+	writeMetric(&output, "goatbot_commands_invoked_total", "counter", "Commands successfully invoked")
+	writeLabelledSamples(&output, "goatbot_commands_invoked_total", "command", m.commandsInvoked)
+	writeMetric(&output, "goatbot_permission_denials_total", "counter", "Commands invoked by users without permission to use them")
+	writeLabelledSamples(&output, "goatbot_permission_denials_total", "command", m.permissionDenials)
+	writeMetric(&output, "goatbot_cooldown_hits_total", "counter", "Commands invoked while they were on cooldown")
+	writeLabelledSamples(&output, "goatbot_cooldown_hits_total", "command", m.cooldownHits)
+	writeMetric(&output, "goatbot_parse_errors_total", "counter", "Messages that could not be parsed as a command")
+	writeSample(&output, "goatbot_parse_errors_total", "", float64(m.parseErrors))
+	writeMetric(&output, "goatbot_reconnects_total", "counter", "Times the bot has reconnected to IRC")
+	writeSample(&output, "goatbot_reconnects_total", "", float64(m.reconnects))
+	writeMetric(&output, "goatbot_connected", "gauge", "Whether the bot is connected to IRC")
+	writeSample(&output, "goatbot_connected", "", boolToFloat(m.connected))
+
+	writeMetric(&output, "goatbot_last_message_age_seconds", "gauge", "Seconds since the last chat message was received in a channel")
+	channels := make([]string, 0, len(m.lastMessageTimes))
+	for messageChannel := range m.lastMessageTimes {
+		channels = append(channels, messageChannel)
+	}
+	sort.Strings(channels)
+	for _, messageChannel := range channels {
+		writeSample(&output, "goatbot_last_message_age_seconds", labels("channel", messageChannel), time.Since(m.lastMessageTimes[messageChannel]).Seconds())
+	}
+
+	if rateLimitedClient, ok := chatClient.(*RateLimitedChatClient); ok {
+		writeMetric(&output, "goatbot_messages_sent_total", "counter", "Chat messages sent by the bot")
+		writeSample(&output, "goatbot_messages_sent_total", "", float64(rateLimitedClient.Sent()))
+		writeMetric(&output, "goatbot_messages_dropped_total", "counter", "Chat messages dropped because the outgoing queue was full")
+		writeSample(&output, "goatbot_messages_dropped_total", "", float64(rateLimitedClient.Dropped()))
+		writeMetric(&output, "goatbot_outgoing_queue_depth", "gauge", "Chat messages waiting to be sent")
+		writeSample(&output, "goatbot_outgoing_queue_depth", "", float64(rateLimitedClient.QueueDepth()))
+	}
+
+	_, _ = io.WriteString(writer, output.String())
+}
+
+func writeMetric(output *strings.Builder, name string, metricType string, help string) {
+	output.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType))
+}
+
+func writeSample(output *strings.Builder, name string, labels string, value float64) {
+	output.WriteString(fmt.Sprintf("%s%s %g\n", name, labels, value))
+}
+
+// Writes a sample for each label value in a consistent order
+func writeLabelledSamples(output *strings.Builder, name string, label string, values map[string]uint64) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeSample(output, name, labels(label, key), float64(values[key]))
+	}
+}
+
+func labels(name string, value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return fmt.Sprintf(`{%s="%s"}`, name, escaped)
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// NewMetricsHandler creates an http.Handler serving /metrics, /healthz and /readyz
+func NewMetricsHandler(m *Metrics, chatClient ChatClient) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.WritePrometheus(writer, chatClient)
+	})
+	mux.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
+		writeHealth(writer, m.IsHealthy(), "disconnected from IRC")
+	})
+	mux.HandleFunc("/readyz", func(writer http.ResponseWriter, request *http.Request) {
+		writeHealth(writer, m.IsConnected(), "not connected to IRC")
+	})
+	return mux
+}
+
+func writeHealth(writer http.ResponseWriter, ok bool, reason string) {
+	if ok {
+		writer.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(writer, "ok\n")
+	} else {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = io.WriteString(writer, reason+"\n")
+	}
+}
+
+// Starts the metrics and health endpoints in the background if METRICS_ADDRESS is set
+func startMetricsServer(address string, chatClient ChatClient) {
+	if address == "" {
+		return
+	}
+
+	go func() {
+		logger.Info("Metrics listening", "address", address)
+		err := http.ListenAndServe(address, NewMetricsHandler(metrics, chatClient))
+		if err != nil {
+			logger.Error("Metrics server stopped", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,104 @@
+package bot
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics_WritePrometheus(t *testing.T) {
+	m := NewMetrics()
+	m.MessageSeen("testchannel", time.Now())
+	m.MessageSeen("testchannel", time.Now())
+	m.CommandInvoked("hello")
+	m.CommandInvoked("hello")
+	m.CommandInvoked("lurk")
+	m.PermissionDenied("ping")
+	m.ParseError()
+
+	var out bytes.Buffer
+	m.WritePrometheus(&out, &RecordingChatClient{})
+	output := out.String()
+
+	expectedLines := []string{
+		"# TYPE goatbot_messages_seen_total counter",
+		"goatbot_messages_seen_total 2",
+		`goatbot_commands_invoked_total{command="hello"} 2`,
+		`goatbot_commands_invoked_total{command="lurk"} 1`,
+		`goatbot_permission_denials_total{command="ping"} 1`,
+		"goatbot_parse_errors_total 1",
+		"goatbot_connected 0",
+		`goatbot_last_message_age_seconds{channel="testchannel"} `,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(output, line) {
+			t.Error("Test Failed: Expected metrics to contain '" + line + "' but was:\n" + output)
+		}
+	}
+	if strings.Contains(output, "goatbot_outgoing_queue_depth") {
+		t.Error("Test Failed: Expected no queue metrics for a client that is not rate limited")
+	}
+}
+
+func TestMetrics_WritePrometheusQueueMetrics(t *testing.T) {
+	chatClient := NewRateLimitedChatClient(&RecordingChatClient{}, 1, time.Hour, 1)
+	chatClient.Say("testchannel", "queued")
+	chatClient.Say("testchannel", "dropped")
+
+	var out bytes.Buffer
+	NewMetrics().WritePrometheus(&out, chatClient)
+	output := out.String()
+
+	for _, line := range []string{"goatbot_outgoing_queue_depth 1", "goatbot_messages_dropped_total 1", "goatbot_messages_sent_total 0"} {
+		if !strings.Contains(output, line) {
+			t.Error("Test Failed: Expected metrics to contain '" + line + "' but was:\n" + output)
+		}
+	}
+}
+
+func TestMetrics_Reconnects(t *testing.T) {
+	m := NewMetrics()
+	m.Connected()
+	m.Disconnected()
+	m.Connected()
+
+	var out bytes.Buffer
+	m.WritePrometheus(&out, nil)
+	if !strings.Contains(out.String(), "goatbot_reconnects_total 1") {
+		t.Error("Test Failed: Expected 1 reconnect but was:\n" + out.String())
+	}
+}
+
+func TestMetrics_HealthEndpoints(t *testing.T) {
+	m := NewMetrics()
+	handler := NewMetricsHandler(m, nil)
+
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Test Failed: Expected /readyz to be 503 before connecting but was %d", response.Code)
+	}
+
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if response.Code != http.StatusOK {
+		t.Errorf("Test Failed: Expected /healthz to be 200 within the grace period but was %d", response.Code)
+	}
+
+	m.disconnectedSince = time.Now().Add(-healthGracePeriod)
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Test Failed: Expected /healthz to be 503 after the grace period but was %d", response.Code)
+	}
+
+	m.Connected()
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if response.Code != http.StatusOK {
+		t.Errorf("Test Failed: Expected /readyz to be 200 once connected but was %d", response.Code)
+	}
+}
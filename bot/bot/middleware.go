@@ -0,0 +1,217 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the stages every message goes through, in order, which other middleware can be inserted around
+const (
+	MiddlewareMetrics   = "metrics"
+	MiddlewareArchive   = "archive"
+	MiddlewareUsers     = "users"
+	MiddlewareIntervals = "intervals"
+	MiddlewareListeners = "listeners"
+	MiddlewareParse     = "parse"
+	MiddlewareCommands  = "commands"
+	MiddlewareTriggers  = "triggers"
+)
+
+// Middleware is a stage of the chain every message goes through. It calls next to pass the message on to the next
+// stage, or returns without calling it to stop the message there
+type Middleware func(context *MessageContext, next func())
+
+// MessageContext is a message going through the middleware chain. Stages can change the message and add values for
+// later stages to use
+type MessageContext struct {
+	Message ChatMessage
+	Client  ChatClient
+	Handler CommandProcessor
+	// The command the message invokes, set by the parse stage, or empty if the message is not a command
+	CommandString string
+	values        map[string]interface{}
+}
+
+// Set adds a value to the message for later stages to use
+func (c *MessageContext) Set(key string, value interface{}) {
+	if c.values == nil {
+		c.values = map[string]interface{}{}
+	}
+	c.values[key] = value
+}
+
+// Get returns a value an earlier stage added to the message
+func (c *MessageContext) Get(key string) (interface{}, bool) {
+	value, ok := c.values[key]
+	return value, ok
+}
+
+type namedMiddleware struct {
+	name       string
+	middleware Middleware
+}
+
+var middlewareChain = defaultMiddlewareChain()
+
+// Guards middlewareChain, which can change while messages are handled
+var middlewareMutex sync.RWMutex
+
+// Returns the stages the bot itself runs every message through
+func defaultMiddlewareChain() []namedMiddleware {
+	return []namedMiddleware{
+		{MiddlewareMetrics, metricsMiddleware},
+		{MiddlewareArchive, archiveMiddleware},
+		{MiddlewareUsers, usersMiddleware},
+		{MiddlewareIntervals, intervalsMiddleware},
+		{MiddlewareListeners, listenersMiddleware},
+		{MiddlewareParse, parseMiddleware},
+		{MiddlewareCommands, commandsMiddleware},
+		{MiddlewareTriggers, triggersMiddleware},
+	}
+}
+
+// UseMiddleware adds a stage to the end of the chain, after the commands are run. Any existing stage with the same name
+// is replaced
+func UseMiddleware(name string, middleware Middleware) {
+	middlewareMutex.Lock()
+	defer middlewareMutex.Unlock()
+	removeMiddleware(name)
+	middlewareChain = append(middlewareChain, namedMiddleware{name, middleware})
+}
+
+// InsertMiddlewareBefore adds a stage to the chain just before the named stage, e.g. MiddlewareCommands. Any existing
+// stage with the same name is replaced
+func InsertMiddlewareBefore(stage string, name string, middleware Middleware) error {
+	return insertMiddleware(stage, 0, name, middleware)
+}
+
+// InsertMiddlewareAfter adds a stage to the chain just after the named stage, e.g. MiddlewareParse. Any existing stage
+// with the same name is replaced
+func InsertMiddlewareAfter(stage string, name string, middleware Middleware) error {
+	return insertMiddleware(stage, 1, name, middleware)
+}
+
+func insertMiddleware(stage string, offset int, name string, middleware Middleware) error {
+	middlewareMutex.Lock()
+	defer middlewareMutex.Unlock()
+	if name != stage {
+		removeMiddleware(name)
+	}
+	for i, existing := range middlewareChain {
+		if existing.name != stage {
+			continue
+		}
+		if name == stage {
+			middlewareChain[i].middleware = middleware
+			return nil
+		}
+		position := i + offset
+		chain := append([]namedMiddleware(nil), middlewareChain[:position]...)
+		chain = append(chain, namedMiddleware{name, middleware})
+		middlewareChain = append(chain, middlewareChain[position:]...)
+		return nil
+	}
+	return fmt.Errorf("there is no middleware called %s", stage)
+}
+
+// RemoveMiddleware removes the named stage from the chain, including the bot's own stages
+func RemoveMiddleware(name string) {
+	middlewareMutex.Lock()
+	defer middlewareMutex.Unlock()
+	removeMiddleware(name)
+}
+
+func removeMiddleware(name string) {
+	var chain []namedMiddleware
+	for _, existing := range middlewareChain {
+		if existing.name != name {
+			chain = append(chain, existing)
+		}
+	}
+	middlewareChain = chain
+}
+
+// Runs the message through each stage of the chain in turn, until a stage does not call next
+func runMiddleware(chain []namedMiddleware, context *MessageContext) {
+	if len(chain) == 0 {
+		return
+	}
+	chain[0].middleware(context, func() {
+		runMiddleware(chain[1:], context)
+	})
+}
+
+func metricsMiddleware(context *MessageContext, next func()) {
+	metrics.MessageSeen(context.Message.Channel, time.Now())
+	next()
+}
+
+func archiveMiddleware(context *MessageContext, next func()) {
+	if chatArchive != nil {
+		err := chatArchive.Write(context.Message)
+		if err != nil {
+			messageLogger(context.Message).Error("Error writing message to chat log", "error", err)
+		}
+	}
+	next()
+}
+
+func usersMiddleware(context *MessageContext, next func()) {
+	if userTracker != nil && context.Message.User.Name != nickname {
+		userTracker.RecordMessage(context.Message)
+	}
+	next()
+}
+
+func intervalsMiddleware(context *MessageContext, next func()) {
+	context.Handler.IncrementMessageCount(context.Message)
+	context.Handler.HandleIntervalMessage(context.Client)
+	next()
+}
+
+func listenersMiddleware(context *MessageContext, next func()) {
+	for _, listener := range messageListeners {
+		listener(context.Client, context.Message)
+	}
+	next()
+}
+
+// Sets the command string if the message starts with a prefix or mentions the bot
+func parseMiddleware(context *MessageContext, next func()) {
+	if prefix == "" {
+		messageLogger(context.Message).Error("Ignoring message, no prefix defined")
+		return
+	}
+
+	if _, addressed := commandText(context.Message); addressed {
+		err, commandString := context.Handler.GetCommandStringFromMessage(context.Message)
+		if err != nil {
+			metrics.ParseError()
+			messageLogger(context.Message).Debug("Error parsing command from message", "error", err)
+		} else {
+			context.CommandString = commandString
+		}
+	}
+	next()
+}
+
+// Runs the chat triggers a message that isn't a command sets off
+func triggersMiddleware(context *MessageContext, next func()) {
+	if context.CommandString == "" {
+		runChatTriggers(context.Handler, context.Client, context.Message)
+	}
+	next()
+}
+
+// Runs the built-in command or the commands from files the message invokes, or the keyword commands the first word of a
+// message that isn't a command invokes
+func commandsMiddleware(context *MessageContext, next func()) {
+	if context.CommandString == "" {
+		runFileCommands(context.Handler, context.Client, context.Message, strings.SplitN(context.Message.Message, " ", 2)[0])
+	} else if !handleBuiltInCommand(context.Handler, context.Client, context.Message, context.CommandString) {
+		runFileCommands(context.Handler, context.Client, context.Message, context.CommandString)
+	}
+	next()
+}
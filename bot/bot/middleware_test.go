@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+)
+
+// Sets up empty commands and data folders, restoring the bot's own middleware afterwards
+func setUpMiddleware(t *testing.T) func() {
+	cleanUp := setUpScripts(t)
+	cooldowns = NewCooldownTracker()
+	InvokableCommandList = []InvokableCommand{{Invocation: "hello", Message: "Hello!"}}
+	return func() {
+		middlewareChain = defaultMiddlewareChain()
+		cleanUp()
+	}
+}
+
+func TestMiddleware_ShortCircuit(t *testing.T) {
+	cleanUp := setUpMiddleware(t)
+	defer cleanUp()
+
+	err := InsertMiddlewareBefore(MiddlewareCommands, "automod", func(context *MessageContext, next func()) {
+		if strings.Contains(context.Message.Message, "badword") {
+			context.Client.Say(context.Message.Channel, "@"+context.Message.User.DisplayName+" watch your language")
+			return
+		}
+		next()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!hello badword"},
+		testMessage{user: "viewer", text: "!hello"},
+	)
+	expectMessages(t, []string{"@viewer watch your language", "Hello!"}, client.messages)
+}
+
+func TestMiddleware_Annotate(t *testing.T) {
+	cleanUp := setUpMiddleware(t)
+	defer cleanUp()
+
+	err := InsertMiddlewareAfter(MiddlewareUsers, "alias", func(context *MessageContext, next func()) {
+		if context.Message.Message == "hi" {
+			context.Message.Message = "!hello"
+			context.Set("rewritten", true)
+		}
+		next()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var commands []string
+	var rewritten []bool
+	UseMiddleware("log", func(context *MessageContext, next func()) {
+		value, _ := context.Get("rewritten")
+		commands = append(commands, context.CommandString)
+		rewritten = append(rewritten, value == true)
+		next()
+	})
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "hi"},
+		testMessage{user: "viewer", text: "hello"},
+	)
+	expectMessages(t, []string{"Hello!"}, client.messages)
+	if len(commands) != 2 || commands[0] != "hello" || commands[1] != "" {
+		t.Errorf("Test Failed: Expected the parsed commands to be [hello ] but were %v", commands)
+	}
+	if len(rewritten) != 2 || !rewritten[0] || rewritten[1] {
+		t.Errorf("Test Failed: Expected only the first message to be annotated but was %v", rewritten)
+	}
+}
+
+func TestMiddleware_Order(t *testing.T) {
+	cleanUp := setUpMiddleware(t)
+	defer cleanUp()
+
+	var order []string
+	record := func(name string) Middleware {
+		return func(context *MessageContext, next func()) {
+			order = append(order, name)
+			next()
+		}
+	}
+	_ = InsertMiddlewareBefore(MiddlewareParse, "second", record("second"))
+	_ = InsertMiddlewareBefore("second", "first", record("first"))
+	_ = InsertMiddlewareAfter("second", "third", record("third"))
+	UseMiddleware("last", record("last"))
+	_ = InsertMiddlewareBefore(MiddlewareMetrics, "first", record("first"))
+
+	sendMessages(&syncRecordingChatClient{}, testMessage{user: "viewer", text: "hello"})
+	if strings.Join(order, ",") != "first,second,third,last" {
+		t.Errorf("Test Failed: Expected the middleware to run in order but was %v", order)
+	}
+
+	if InsertMiddlewareAfter("missing", "other", record("other")) == nil {
+		t.Error("Test Failed: Expected an error inserting next to a stage that doesn't exist")
+	}
+}
+
+func TestMiddleware_Remove(t *testing.T) {
+	cleanUp := setUpMiddleware(t)
+	defer cleanUp()
+
+	RemoveMiddleware(MiddlewareCommands)
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: "!hello"})
+	expectMessages(t, nil, client.messages)
+}
@@ -0,0 +1,165 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often point balances are written to disk while they are changing
+const pointsSaveInterval = 10 * time.Second
+
+var errNotEnoughPoints = errors.New("not enough points")
+
+// PointsStore keeps the point balance of every user, stored in a file per channel
+type PointsStore struct {
+	mutex    sync.Mutex
+	channels map[string]map[string]int64
+	changed  map[string]bool
+	lastSave time.Time
+}
+
+var pointsStore *PointsStore
+var pointsPerMessage int64 = 1
+
+// NewPointsStore creates a PointsStore that loads and saves the balances of each channel in the data folder
+func NewPointsStore() *PointsStore {
+	return &PointsStore{
+		channels: map[string]map[string]int64{},
+		changed:  map[string]bool{},
+		lastSave: time.Now(),
+	}
+}
+
+// Returns the balances of a channel, loading them from disk the first time the channel is used
+func (p *PointsStore) channelBalances(channelName string) map[string]int64 {
+	channelName = strings.ToLower(channelName)
+	balances, ok := p.channels[channelName]
+	if !ok {
+		balances = map[string]int64{}
+		err := readJSONFile(channelDataFile("points", channelName), &balances)
+		if err != nil {
+			logger.Error("Error loading points", "channel", channelName, "error", err)
+		}
+		p.channels[channelName] = balances
+	}
+	return balances
+}
+
+// Balance returns the number of points a user has
+func (p *PointsStore) Balance(channelName string, user string) int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.channelBalances(channelName)[strings.ToLower(user)]
+}
+
+// Add gives a user points, or takes them away if amount is negative, without letting the balance go below zero
+func (p *PointsStore) Add(channelName string, user string, amount int64) int64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	balances := p.channelBalances(channelName)
+	user = strings.ToLower(user)
+	balances[user] += amount
+	if balances[user] < 0 {
+		balances[user] = 0
+	}
+	p.changed[strings.ToLower(channelName)] = true
+	p.saveIfDue()
+	return balances[user]
+}
+
+// Spend takes points from a user, returning errNotEnoughPoints and leaving the balance unchanged if they do not have
+// enough
+func (p *PointsStore) Spend(channelName string, user string, amount int64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	balances := p.channelBalances(channelName)
+	user = strings.ToLower(user)
+	if balances[user] < amount {
+		return errNotEnoughPoints
+	}
+	balances[user] -= amount
+	p.changed[strings.ToLower(channelName)] = true
+	p.saveIfDue()
+	return nil
+}
+
+// Save writes the balances of every channel that has changed to disk
+func (p *PointsStore) Save() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.save()
+}
+
+func (p *PointsStore) saveIfDue() {
+	if time.Since(p.lastSave) > pointsSaveInterval {
+		p.save()
+	}
+}
+
+func (p *PointsStore) save() {
+	for channelName := range p.changed {
+		err := writeJSONFile(channelDataFile("points", channelName), p.channels[channelName])
+		if err != nil {
+			logger.Error("Error saving points", "channel", channelName, "error", err)
+			continue
+		}
+		delete(p.changed, channelName)
+	}
+	p.lastSave = time.Now()
+}
+
+// Sets up points and the points commands, giving perMessage points for every message sent in chat
+func initPoints(perMessage string) error {
+	if perMessage != "" {
+		var err error
+		pointsPerMessage, err = strconv.ParseInt(perMessage, 10, 64)
+		if err != nil || pointsPerMessage < 0 {
+			return errors.New("POINTS_PER_MESSAGE must be a number of points")
+		}
+	}
+
+	pointsStore = NewPointsStore()
+	registerMessageListener(earnPoints)
+	registerBuiltInCommand(builtInCommand{invocation: "points", handler: pointsCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "givepoints", modOnly: true, handler: givePointsCommand})
+	return nil
+}
+
+// Gives the sender of every message points
+func earnPoints(client ChatClient, message ChatMessage) {
+	if pointsPerMessage > 0 && message.User.Name != nickname {
+		pointsStore.Add(message.Channel, message.User.Name, pointsPerMessage)
+	}
+}
+
+// !points [user] sends the number of points the user (or the user invoking it) has
+func pointsCommand(client ChatClient, message ChatMessage, arguments []string) {
+	user := message.User.Name
+	if len(arguments) > 0 {
+		user = strings.TrimPrefix(arguments[0], "@")
+	}
+	client.Say(message.Channel, fmt.Sprintf("%s has %d points", user, pointsStore.Balance(message.Channel, user)))
+}
+
+// !givepoints <user> <amount> gives the user points, or takes them away if the amount is negative
+func givePointsCommand(client ChatClient, message ChatMessage, arguments []string) {
+	if len(arguments) < 2 {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"givepoints <user> <amount>")
+		return
+	}
+	amount, err := strconv.ParseInt(arguments[1], 10, 64)
+	if err != nil {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"givepoints <user> <amount>")
+		return
+	}
+
+	user := strings.TrimPrefix(arguments[0], "@")
+	balance := pointsStore.Add(message.Channel, user, amount)
+	client.Say(message.Channel, fmt.Sprintf("%s now has %d points", user, balance))
+}
@@ -0,0 +1,95 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Sets up an empty data folder and points store with the points commands registered
+func setUpPoints(t *testing.T) func() {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDirectory = directory
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "goatbot"
+	IntervalMessageList = nil
+	InvokableCommandList = nil
+	builtInCommands = nil
+	messageListeners = nil
+	err = initPoints("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		pointsStore = nil
+		builtInCommands = nil
+		messageListeners = nil
+		dataDirectory = "data/"
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func TestPointsStore_AddAndSpend(t *testing.T) {
+	cleanUp := setUpPoints(t)
+	defer cleanUp()
+
+	pointsStore.Add("testchannel", "Viewer", 10)
+	if pointsStore.Spend("testchannel", "viewer", 15) != errNotEnoughPoints {
+		t.Error("Test Failed: Expected spending more points than the balance to fail")
+	}
+	if pointsStore.Spend("testchannel", "viewer", 4) != nil {
+		t.Error("Test Failed: Expected spending less points than the balance to succeed")
+	}
+	if balance := pointsStore.Add("testchannel", "viewer", -100); balance != 0 {
+		t.Errorf("Test Failed: Expected balance to stop at 0 but was %d", balance)
+	}
+}
+
+func TestPointsStore_SaveAndLoad(t *testing.T) {
+	cleanUp := setUpPoints(t)
+	defer cleanUp()
+
+	pointsStore.Add("TestChannel", "viewer", 42)
+	pointsStore.Save()
+
+	loaded := NewPointsStore()
+	if balance := loaded.Balance("testchannel", "viewer"); balance != 42 {
+		t.Errorf("Test Failed: Expected loaded balance to be 42 but was %d", balance)
+	}
+}
+
+func TestInitPoints_InvalidPerMessage(t *testing.T) {
+	defer func() {
+		pointsPerMessage = 1
+	}()
+	if initPoints("lots") == nil {
+		t.Error("Test Failed: Expected an error for a non-numeric POINTS_PER_MESSAGE")
+	}
+}
+
+func TestPointsCommands(t *testing.T) {
+	cleanUp := setUpPoints(t)
+	defer cleanUp()
+
+	client := RecordingChatClient{}
+	handler := CommandHandler{}
+	onMessage(&handler, &client, chatMessage("viewer", "hello", "1", time.Now()))
+	onMessage(&handler, &client, chatMessage("viewer", "!points", "2", time.Now()))
+	onMessage(&handler, &client, chatMessage("viewer", "!givepoints viewer 100", "3", time.Now()))
+	onMessage(&handler, &client, newChannelMessage("mod", map[string]int{"moderator": 1}, "!givepoints @viewer 100", "4"))
+
+	expected := []string{"viewer has 2 points", "viewer now has 103 points"}
+	if len(client.Messages) != len(expected) {
+		t.Fatalf("Test Failed: Expected %v but was %v", expected, client.Messages)
+	}
+	for i := range expected {
+		if client.Messages[i] != expected[i] {
+			t.Errorf("Test Failed: Expected '%s' but was '%s'", expected[i], client.Messages[i])
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollDuration = 60 * time.Second
+	minimumPollOptions  = 2
+	maximumPollOptions  = 10
+)
+
+// PollVote is a single user's vote in a poll
+type PollVote struct {
+	Option int   `json:"option"`
+	Weight int64 `json:"weight"`
+}
+
+// Poll is a question that users vote on by choosing one of its options, saved so it survives a restart
+type Poll struct {
+	Question         string              `json:"question"`
+	Options          []string            `json:"options"`
+	Votes            map[string]PollVote `json:"votes"`
+	SubscriberWeight int64               `json:"subscriber_weight"`
+	StartedAt        time.Time           `json:"started_at"`
+	EndsAt           time.Time           `json:"ends_at"`
+	Closed           bool                `json:"closed"`
+}
+
+// Tallies returns the total weight of the votes for each option
+func (p *Poll) Tallies() []int64 {
+	tallies := make([]int64, len(p.Options))
+	for _, vote := range p.Votes {
+		if vote.Option >= 0 && vote.Option < len(tallies) {
+			tallies[vote.Option] += vote.Weight
+		}
+	}
+	return tallies
+}
+
+// Formats the tally of every option, e.g. "1) Yes: 3, 2) No: 1"
+func (p *Poll) formatTallies() string {
+	tallies := p.Tallies()
+	results := make([]string, len(p.Options))
+	for i, option := range p.Options {
+		results[i] = fmt.Sprintf("%d) %s: %d", i+1, option, tallies[i])
+	}
+	return strings.Join(results, ", ")
+}
+
+// Formats the winning option, or every option that tied for the most votes
+func (p *Poll) formatWinner() string {
+	tallies := p.Tallies()
+	var most int64
+	for _, tally := range tallies {
+		if tally > most {
+			most = tally
+		}
+	}
+	if most == 0 {
+		return "Nobody voted"
+	}
+
+	var winners []string
+	for i, tally := range tallies {
+		if tally == most {
+			winners = append(winners, p.Options[i])
+		}
+	}
+	if len(winners) > 1 {
+		return fmt.Sprintf("It's a tie between %s with %s each", strings.Join(winners, " and "), pluralise(int(most), "vote"))
+	}
+	return fmt.Sprintf("%s wins with %s", winners[0], pluralise(int(most), "vote"))
+}
+
+// PollManager runs polls, at most one per channel at a time
+type PollManager struct {
+	mutex      sync.Mutex
+	polls      map[string]*Poll
+	closeTimer map[string]*time.Timer
+	// Channels with votes that haven't been saved yet
+	changed map[string]bool
+}
+
+var polls *PollManager
+
+// NewPollManager creates a PollManager with no polls running
+func NewPollManager() *PollManager {
+	return &PollManager{
+		polls:      map[string]*Poll{},
+		closeTimer: map[string]*time.Timer{},
+		changed:    map[string]bool{},
+	}
+}
+
+// Sets up polls and the poll commands
+func initPolls() {
+	polls = NewPollManager()
+	registerMessageListener(polls.handleMessage)
+	registerBuiltInCommand(builtInCommand{invocation: "poll", modOnly: true, handler: polls.pollCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "vote", handler: polls.voteCommand})
+}
+
+// Resume loads the channel's saved poll and schedules it to close, closing it straight away if it ended while the bot
+// was not running
+func (p *PollManager) Resume(client ChatClient, channelName string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	poll, err := p.channelPoll(channelName)
+	if err != nil {
+		logger.Error("Error loading poll", "channel", channelName, "error", err)
+		return
+	}
+	if poll == nil || poll.Closed {
+		return
+	}
+	p.scheduleClose(client, channelName, poll)
+}
+
+// Returns the channel's current or most recent poll, loading it from disk the first time the channel is used
+func (p *PollManager) channelPoll(channelName string) (*Poll, error) {
+	channelName = strings.ToLower(channelName)
+	if poll, ok := p.polls[channelName]; ok {
+		return poll, nil
+	}
+
+	var poll *Poll
+	err := readJSONFile(channelDataFile("polls", channelName), &poll)
+	if err != nil {
+		return nil, err
+	}
+	if poll != nil && poll.Votes == nil {
+		poll.Votes = map[string]PollVote{}
+	}
+	p.polls[channelName] = poll
+	return poll, nil
+}
+
+func (p *PollManager) save(channelName string, poll *Poll) {
+	delete(p.changed, strings.ToLower(channelName))
+	err := writeJSONFile(channelDataFile("polls", channelName), poll)
+	if err != nil {
+		logger.Error("Error saving poll", "channel", channelName, "error", err)
+	}
+}
+
+// Save writes the polls with votes that haven't been saved yet. Votes are saved this way rather than one at a time, so
+// a busy poll doesn't rewrite its file for every vote
+func (p *PollManager) Save() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for channelName := range p.changed {
+		p.save(channelName, p.polls[channelName])
+	}
+}
+
+// Closes the poll when it ends
+func (p *PollManager) scheduleClose(client ChatClient, channelName string, poll *Poll) {
+	key := strings.ToLower(channelName)
+	if timer, ok := p.closeTimer[key]; ok {
+		timer.Stop()
+	}
+	p.closeTimer[key] = time.AfterFunc(time.Until(poll.EndsAt), func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if p.polls[key] == poll && !poll.Closed {
+			p.close(client, channelName, poll)
+		}
+	})
+}
+
+// Closes the poll and announces the results
+func (p *PollManager) close(client ChatClient, channelName string, poll *Poll) {
+	key := strings.ToLower(channelName)
+	if timer, ok := p.closeTimer[key]; ok {
+		timer.Stop()
+		delete(p.closeTimer, key)
+	}
+	poll.Closed = true
+	p.save(channelName, poll)
+	client.Say(channelName, fmt.Sprintf("Poll closed: %s %s! Results: %s", poll.Question, poll.formatWinner(), poll.formatTallies()))
+}
+
+// !poll "Question?" option1 | option2 [duration] [subs=<weight>], !poll results, !poll end
+func (p *PollManager) pollCommand(client ChatClient, message ChatMessage, arguments []string) {
+	if len(arguments) == 0 {
+		channelPrefix := commandPrefix(message.Channel)
+		client.Say(message.Channel, "Usage: "+channelPrefix+"poll \"Question?\" option 1 | option 2 [duration] [subs=<weight>], "+channelPrefix+"poll results, "+channelPrefix+"poll end")
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	poll, err := p.channelPoll(message.Channel)
+	if err != nil {
+		messageLogger(message).Error("Error loading poll", "error", err)
+		client.Say(message.Channel, "Could not load the poll")
+		return
+	}
+
+	switch arguments[0] {
+	case "results":
+		if poll == nil {
+			client.Say(message.Channel, "There hasn't been a poll yet")
+		} else if poll.Closed {
+			client.Say(message.Channel, fmt.Sprintf("Last poll: %s %s! Results: %s", poll.Question, poll.formatWinner(), poll.formatTallies()))
+		} else {
+			client.Say(message.Channel, fmt.Sprintf("%s %s (%s left)", poll.Question, poll.formatTallies(), time.Until(poll.EndsAt).Round(time.Second)))
+		}
+	case "end", "stop", "close":
+		if poll == nil || poll.Closed {
+			client.Say(message.Channel, "There is no poll running")
+			return
+		}
+		p.close(client, message.Channel, poll)
+	default:
+		if poll != nil && !poll.Closed {
+			client.Say(message.Channel, "A poll is already running, end it with "+commandPrefix(message.Channel)+"poll end")
+			return
+		}
+		p.start(client, message)
+	}
+}
+
+// Starts a poll from a message in the form !poll "Question?" option1 | option2 [duration] [subs=<weight>], keeping the
+// case of the question and options
+func (p *PollManager) start(client ChatClient, message ChatMessage) {
+	usage := "Usage: " + commandPrefix(message.Channel) + "poll \"Question?\" option 1 | option 2 [duration] [subs=<weight>]"
+	text := getArgumentTextFromMessage(message)
+
+	if !strings.HasPrefix(text, "\"") || strings.Count(text, "\"") < 2 {
+		client.Say(message.Channel, usage)
+		return
+	}
+	closingQuote := strings.Index(text[1:], "\"") + 1
+	question := strings.TrimSpace(text[1:closingQuote])
+	words := strings.Fields(text[closingQuote+1:])
+
+	poll := &Poll{
+		Question:         question,
+		Votes:            map[string]PollVote{},
+		SubscriberWeight: 1,
+		StartedAt:        time.Now(),
+	}
+	duration := defaultPollDuration
+	for len(words) > 0 {
+		last := words[len(words)-1]
+		if strings.HasPrefix(last, "subs=") {
+			weight, err := strconv.ParseInt(strings.TrimPrefix(last, "subs="), 10, 64)
+			if err != nil || weight < 1 {
+				client.Say(message.Channel, "Invalid poll option '"+last+"'")
+				return
+			}
+			poll.SubscriberWeight = weight
+		} else if parsed, err := time.ParseDuration(last); err == nil && parsed > 0 {
+			duration = parsed
+		} else {
+			break
+		}
+		words = words[:len(words)-1]
+	}
+
+	for _, option := range strings.Split(strings.Join(words, " "), "|") {
+		if option = strings.TrimSpace(option); option != "" {
+			poll.Options = append(poll.Options, option)
+		}
+	}
+	if question == "" || len(poll.Options) < minimumPollOptions || len(poll.Options) > maximumPollOptions {
+		client.Say(message.Channel, usage)
+		return
+	}
+	poll.EndsAt = poll.StartedAt.Add(duration)
+
+	p.polls[strings.ToLower(message.Channel)] = poll
+	p.save(message.Channel, poll)
+	p.scheduleClose(client, message.Channel, poll)
+
+	options := make([]string, len(poll.Options))
+	for i, option := range poll.Options {
+		options[i] = fmt.Sprintf("%d) %s", i+1, option)
+	}
+	client.Say(message.Channel, fmt.Sprintf("Poll: %s %s - vote with %svote <number> or type the number, closes in %s", question, strings.Join(options, ", "), commandPrefix(message.Channel), duration))
+}
+
+// !vote <number>
+func (p *PollManager) voteCommand(client ChatClient, message ChatMessage, arguments []string) {
+	if len(arguments) > 0 {
+		p.vote(message, arguments[0])
+	}
+}
+
+// Counts messages that are just an option number as a vote
+func (p *PollManager) handleMessage(client ChatClient, message ChatMessage) {
+	text := strings.TrimSpace(message.Message)
+	if _, err := strconv.Atoi(text); err == nil {
+		p.vote(message, text)
+	}
+}
+
+// Records the user's vote for the numbered option if a poll is running and they have not already voted
+func (p *PollManager) vote(message ChatMessage, option string) {
+	number, err := strconv.Atoi(option)
+	if err != nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	poll, err := p.channelPoll(message.Channel)
+	if err != nil {
+		messageLogger(message).Error("Error loading poll", "error", err)
+		return
+	}
+	user := strings.ToLower(message.User.Name)
+	if poll == nil || poll.Closed || number < 1 || number > len(poll.Options) || user == strings.ToLower(nickname) {
+		return
+	}
+	if _, voted := poll.Votes[user]; voted {
+		return
+	}
+
+	weight := int64(1)
+	if message.User.Badges["subscriber"] > 0 || message.User.Badges["founder"] > 0 {
+		weight = poll.SubscriberWeight
+	}
+	poll.Votes[user] = PollVote{Option: number - 1, Weight: weight}
+	p.changed[strings.ToLower(message.Channel)] = true
+}
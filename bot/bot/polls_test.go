@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// Sets up an empty data folder and poll manager with the poll commands registered
+func setUpPolls(t *testing.T) func() {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDirectory = directory
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "goatbot"
+	IntervalMessageList = nil
+	InvokableCommandList = nil
+	builtInCommands = nil
+	messageListeners = nil
+	initPolls()
+	return func() {
+		polls = nil
+		builtInCommands = nil
+		messageListeners = nil
+		dataDirectory = "data/"
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func TestPoll_VotesAndResults(t *testing.T) {
+	cleanUp := setUpPolls(t)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		modMessage("!poll \"Best Goat?\" Alpine | Pygmy | Boer 1h subs=3"),
+		testMessage{user: "viewer", text: "!vote 2"},
+		testMessage{user: "viewer", text: "1"},
+		testMessage{user: "subscriber", badges: map[string]int{"subscriber": 1}, text: "3"},
+		testMessage{user: "other", text: "!vote 7"},
+		modMessage("!poll results"),
+		modMessage("!poll end"),
+	)
+
+	expected := []string{
+		"Poll: Best Goat? 1) Alpine, 2) Pygmy, 3) Boer - vote with !vote <number> or type the number, closes in 1h0m0s",
+		"Best Goat? 1) Alpine: 0, 2) Pygmy: 1, 3) Boer: 3 (1h0m0s left)",
+		"Poll closed: Best Goat? Boer wins with 3 votes! Results: 1) Alpine: 0, 2) Pygmy: 1, 3) Boer: 3",
+	}
+	if len(client.messages) != len(expected) {
+		t.Fatalf("Test Failed: Expected %v but was %v", expected, client.messages)
+	}
+	for i := range expected {
+		if client.messages[i] != expected[i] {
+			t.Errorf("Test Failed: Expected '%s' but was '%s'", expected[i], client.messages[i])
+		}
+	}
+}
+
+func TestPoll_ClosesAfterDuration(t *testing.T) {
+	cleanUp := setUpPolls(t)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, modMessage("!poll \"Yes or no?\" yes | no 10ms"), testMessage{user: "viewer", text: "1"})
+
+	deadline := time.Now().Add(time.Second)
+	for client.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if client.last() != "Poll closed: Yes or no? yes wins with 1 vote! Results: 1) yes: 1, 2) no: 0" {
+		t.Errorf("Test Failed: Expected the poll to close with results but was '%s'", client.last())
+	}
+}
+
+func TestPoll_InvalidPolls(t *testing.T) {
+	cleanUp := setUpPolls(t)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		modMessage("!poll no quotes | here"),
+		modMessage("!poll \"Only one option?\" yes"),
+		modMessage("!poll \"Bad weight?\" yes | no subs=0"),
+	)
+
+	for _, response := range client.messages[:2] {
+		if response != "Usage: !poll \"Question?\" option 1 | option 2 [duration] [subs=<weight>]" {
+			t.Errorf("Test Failed: Expected usage but was '%s'", response)
+		}
+	}
+	if client.last() != "Invalid poll option 'subs=0'" {
+		t.Errorf("Test Failed: Expected the weight to be rejected but was '%s'", client.last())
+	}
+}
+
+func TestPoll_SurvivesRestart(t *testing.T) {
+	cleanUp := setUpPolls(t)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, modMessage("!poll \"Still here?\" yes | no 1h"), testMessage{user: "viewer", text: "2"})
+
+	var saved Poll
+	if err := readJSONFile(channelDataFile("polls", "testchannel"), &saved); err != nil || len(saved.Votes) != 0 {
+		t.Errorf("Test Failed: Expected the vote not to be saved until the data is saved but was %v, %v", saved.Votes, err)
+	}
+	saveData()
+
+	polls = NewPollManager()
+	polls.Resume(client, "testchannel")
+	sendMessages(client, testMessage{user: "viewer", text: "1"}, testMessage{user: "other", text: "2"}, modMessage("!poll end"))
+
+	if client.last() != "Poll closed: Still here? no wins with 2 votes! Results: 1) yes: 0, 2) no: 2" {
+		t.Errorf("Test Failed: Expected the votes from before the restart to be kept but was '%s'", client.last())
+	}
+}
+
+func TestPoll_ClosesOnResumeIfEnded(t *testing.T) {
+	cleanUp := setUpPolls(t)
+	defer cleanUp()
+
+	err := writeJSONFile(channelDataFile("polls", "testchannel"), Poll{
+		Question: "Over?",
+		Options:  []string{"yes", "no"},
+		Votes:    map[string]PollVote{"viewer": {Option: 0, Weight: 1}},
+		EndsAt:   time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &syncRecordingChatClient{}
+	polls.Resume(client, "testchannel")
+	deadline := time.Now().Add(time.Second)
+	for client.count() < 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if client.last() != "Poll closed: Over? yes wins with 1 vote! Results: 1) yes: 1, 2) no: 0" {
+		t.Errorf("Test Failed: Expected the ended poll to close on resume but was '%s'", client.last())
+	}
+}
@@ -0,0 +1,199 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+)
+
+// Prefixes from PREFIX after the first, which is kept in prefix
+var additionalPrefixes []string
+
+var channelPrefixes = NewPrefixStore()
+
+// PrefixStore keeps the prefixes each channel has set with the prefix command, saving them in the data folder. Channels
+// that haven't set any use the prefixes from PREFIX
+type PrefixStore struct {
+	mutex    sync.Mutex
+	channels map[string][]string
+}
+
+// NewPrefixStore creates a PrefixStore that loads each channel's prefixes from the data folder the first time they're used
+func NewPrefixStore() *PrefixStore {
+	return &PrefixStore{channels: map[string][]string{}}
+}
+
+// Splits the PREFIX setting, a comma separated list of prefixes, keeping the first in prefix
+func setPrefixes(setting string) {
+	prefix = ""
+	additionalPrefixes = nil
+	for _, value := range strings.Split(setting, ",") {
+		value = strings.TrimLeft(value, " ")
+		if value == "" {
+			continue
+		}
+		if prefix == "" {
+			prefix = value
+		} else {
+			additionalPrefixes = append(additionalPrefixes, value)
+		}
+	}
+}
+
+// Returns the prefixes from PREFIX
+func defaultPrefixes() []string {
+	if prefix == "" {
+		return nil
+	}
+	return append([]string{prefix}, additionalPrefixes...)
+}
+
+// Returns the prefixes the channel has set, loading them from disk the first time the channel is used
+func (s *PrefixStore) channelValues(channelName string) []string {
+	channelName = strings.ToLower(channelName)
+	values, ok := s.channels[channelName]
+	if !ok {
+		err := readJSONFile(channelDataFile("prefixes", channelName), &values)
+		if err != nil {
+			logger.Error("Error loading prefixes", "channel", channelName, "error", err)
+		}
+		s.channels[channelName] = values
+	}
+	return values
+}
+
+// Prefixes returns the prefixes that invoke commands in the channel
+func (s *PrefixStore) Prefixes(channelName string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if values := s.channelValues(channelName); len(values) != 0 {
+		return append([]string(nil), values...)
+	}
+	return defaultPrefixes()
+}
+
+// Set saves the prefixes for the channel, going back to the prefixes from PREFIX if there are none
+func (s *PrefixStore) Set(channelName string, values []string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	channelName = strings.ToLower(channelName)
+	s.channels[channelName] = values
+	return writeJSONFile(channelDataFile("prefixes", channelName), values)
+}
+
+// Returns the prefix the bot uses when telling users how to invoke a command in the channel
+func commandPrefix(channelName string) string {
+	prefixes := channelPrefixes.Prefixes(channelName)
+	if len(prefixes) == 0 {
+		return prefix
+	}
+	return prefixes[0]
+}
+
+// Returns the text of the message after the prefix or mention of the bot that it starts with, and whether the message
+// invokes a command that way. Replies to the bot's messages invoke commands without a prefix. Other messages are
+// returned unchanged, since they can only invoke keyword commands
+func commandText(message ChatMessage) (string, bool) {
+	text := message.Message
+	addressed := nickname != "" && strings.EqualFold(message.ReplyTo, nickname)
+	if rest, mentioned := stripMention(text); mentioned {
+		text = rest
+		addressed = true
+	}
+
+	longest := ""
+	for _, value := range channelPrefixes.Prefixes(message.Channel) {
+		if strings.HasPrefix(text, value) && len(value) > len(longest) {
+			longest = value
+		}
+	}
+	if longest != "" {
+		return text[len(longest):], true
+	}
+	return text, addressed
+}
+
+// Removes a mention of the bot from the start of the text, either `@name` or `name:` and `name,` as is usual on IRC
+func stripMention(text string) (string, bool) {
+	if nickname == "" {
+		return text, false
+	}
+
+	rest := text
+	mentioned := false
+	if strings.HasPrefix(rest, "@") && len(rest) > len(nickname) && strings.EqualFold(rest[1:len(nickname)+1], nickname) {
+		rest = rest[len(nickname)+1:]
+		mentioned = true
+	} else if len(rest) >= len(nickname) && strings.EqualFold(rest[:len(nickname)], nickname) {
+		rest = rest[len(nickname):]
+	} else {
+		return text, false
+	}
+
+	if strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, ",") {
+		rest = rest[1:]
+		mentioned = true
+	}
+	if !mentioned || (rest != "" && rest[0] != ' ') {
+		return text, false
+	}
+	return strings.TrimLeft(rest, " "), true
+}
+
+// Shows, adds or removes the channel's prefixes
+func prefixCommand(client ChatClient, message ChatMessage, args []string) {
+	usage := "Usage: " + commandPrefix(message.Channel) + "prefix [add <prefix>|remove <prefix>|reset]"
+	prefixes := channelPrefixes.Prefixes(message.Channel)
+	if len(args) == 0 {
+		client.Say(message.Channel, "Commands can be used with "+strings.Join(prefixes, " ")+" or by mentioning @"+nickname)
+		return
+	}
+
+	words := strings.Fields(getArgumentTextFromMessage(message))
+	switch args[0] {
+	case "add":
+		if len(words) != 2 {
+			client.Say(message.Channel, usage)
+			return
+		}
+		for _, value := range prefixes {
+			if value == words[1] {
+				client.Say(message.Channel, words[1]+" is already a prefix")
+				return
+			}
+		}
+		prefixes = append(prefixes, words[1])
+	case "remove":
+		if len(words) != 2 {
+			client.Say(message.Channel, usage)
+			return
+		}
+		var remaining []string
+		for _, value := range prefixes {
+			if value != words[1] {
+				remaining = append(remaining, value)
+			}
+		}
+		if len(remaining) == len(prefixes) {
+			client.Say(message.Channel, words[1]+" is not a prefix")
+			return
+		}
+		if len(remaining) == 0 {
+			client.Say(message.Channel, "The last prefix can't be removed")
+			return
+		}
+		prefixes = remaining
+	case "reset":
+		prefixes = nil
+	default:
+		client.Say(message.Channel, usage)
+		return
+	}
+
+	err := channelPrefixes.Set(message.Channel, prefixes)
+	if err != nil {
+		logger.Error("Error saving prefixes", "channel", message.Channel, "error", err)
+		client.Say(message.Channel, "Couldn't save the prefixes")
+		return
+	}
+	client.Say(message.Channel, "Commands can now be used with "+strings.Join(channelPrefixes.Prefixes(message.Channel), " "))
+}
@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"testing"
+)
+
+func TestCommandText_PrefixesAndMentions(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	setPrefixes("!, ?,!!")
+
+	cases := []struct {
+		message   ChatMessage
+		text      string
+		addressed bool
+	}{
+		{ChatMessage{Message: "!hello there"}, "hello there", true},
+		{ChatMessage{Message: "?hello"}, "hello", true},
+		{ChatMessage{Message: "!!hello"}, "hello", true},
+		{ChatMessage{Message: "@GoatBot hello"}, "hello", true},
+		{ChatMessage{Message: "@goatbot, !hello"}, "hello", true},
+		{ChatMessage{Message: "goatbot: hello"}, "hello", true},
+		{ChatMessage{Message: "hello", ReplyTo: "GoatBot"}, "hello", true},
+		{ChatMessage{Message: "@goatbotfan hello"}, "@goatbotfan hello", false},
+		{ChatMessage{Message: "goatbot hello"}, "goatbot hello", false},
+		{ChatMessage{Message: "hello", ReplyTo: "viewer"}, "hello", false},
+	}
+	for _, testCase := range cases {
+		text, addressed := commandText(testCase.message)
+		if text != testCase.text || addressed != testCase.addressed {
+			t.Errorf("Test Failed: Expected '%s' to be ('%s', %v) but was ('%s', %v)", testCase.message.Message, testCase.text,
+				testCase.addressed, text, addressed)
+		}
+	}
+}
+
+func TestPrefixCommand_SetsPrefixesPerChannel(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	registerBuiltInCommand(builtInCommand{invocation: "prefix", modOnly: true, handler: prefixCommand})
+	InvokableCommandList = []InvokableCommand{{Invocation: "hello", Message: "Hello!"}}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!prefix add ?"},
+		modMessage("!prefix add ?"),
+		testMessage{user: "viewer", text: "?hello"},
+		modMessage("?prefix remove !"),
+		testMessage{user: "viewer", text: "!hello"},
+		modMessage("?prefix remove ?"),
+		modMessage("?prefix"),
+	)
+	expectMessages(t, []string{
+		"Commands can now be used with ! ?",
+		"Hello!",
+		"Commands can now be used with ?",
+		"The last prefix can't be removed",
+		"Commands can be used with ? or by mentioning @goatbot",
+	}, client.messages)
+
+	channelPrefixes = NewPrefixStore()
+	if prefixes := channelPrefixes.Prefixes("TestChannel"); len(prefixes) != 1 || prefixes[0] != "?" {
+		t.Errorf("Test Failed: Expected the prefixes to be saved but were %v", prefixes)
+	}
+	if prefixes := channelPrefixes.Prefixes("otherchannel"); len(prefixes) != 1 || prefixes[0] != "!" {
+		t.Errorf("Test Failed: Expected other channels to use the default prefix but were %v", prefixes)
+	}
+
+	client = &syncRecordingChatClient{}
+	sendMessages(client, modMessage("?prefix reset"), testMessage{user: "viewer", text: "!hello"})
+	expectMessages(t, []string{"Commands can now be used with !", "Hello!"}, client.messages)
+}
+
+func TestKeywordCommands_InvokedWithoutPrefix(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	InvokableCommandList = []InvokableCommand{
+		{Invocation: "hello", Message: "Hello!"},
+		{Invocation: "gg", Message: "GG $player!", Keyword: true, Parameters: []CommandParameter{{Name: "player"}}},
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "hello"},
+		testMessage{user: "viewer", text: "GG Streamer"},
+		testMessage{user: "viewer", text: "!gg Chat"},
+		testMessage{user: "viewer", text: "@goatbot hello"},
+		testMessage{user: "viewer", text: "what a gg"},
+	)
+	expectMessages(t, []string{"GG Streamer!", "GG Chat!", "Hello!"}, client.messages)
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type outgoingMessage struct {
+	channel, text string
+}
+
+// RateLimitedChatClient is a ChatClient that sends no more than limit messages in any period, queueing messages that
+// are over the limit and dropping messages once the queue is full
+type RateLimitedChatClient struct {
+	client    ChatClient
+	limit     int
+	period    time.Duration
+	queue     chan outgoingMessage
+	sentTimes []time.Time
+	sent      uint64
+	dropped   uint64
+	closeOnce sync.Once
+}
+
+// NewRateLimitedChatClient creates a RateLimitedChatClient that sends messages using the given client. Run must be
+// called for any messages to be sent
+func NewRateLimitedChatClient(client ChatClient, limit int, period time.Duration, queueSize int) *RateLimitedChatClient {
+	return &RateLimitedChatClient{
+		client: client,
+		limit:  limit,
+		period: period,
+		queue:  make(chan outgoingMessage, queueSize),
+	}
+}
+
+// Say queues a message to be sent, dropping it if the queue is full
+func (c *RateLimitedChatClient) Say(channel string, text string) {
+	select {
+	case c.queue <- outgoingMessage{channel: channel, text: text}:
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+		logger.Warn("Outgoing message queue is full, dropping message", "channel", channel, "text", text)
+	}
+}
+
+// Run sends the queued messages as quickly as the rate limit allows until Close is called
+func (c *RateLimitedChatClient) Run() {
+	for message := range c.queue {
+		c.waitForCapacity()
+		c.client.Say(message.channel, message.text)
+		atomic.AddUint64(&c.sent, 1)
+	}
+}
+
+// Close stops Run once the messages already in the queue have been sent
+func (c *RateLimitedChatClient) Close() {
+	c.closeOnce.Do(func() {
+		close(c.queue)
+	})
+}
+
+// QueueDepth returns the number of messages waiting to be sent
+func (c *RateLimitedChatClient) QueueDepth() int {
+	return len(c.queue)
+}
+
+// Sent returns the number of messages that have been sent
+func (c *RateLimitedChatClient) Sent() uint64 {
+	return atomic.LoadUint64(&c.sent)
+}
+
+// Dropped returns the number of messages that were dropped because the queue was full
+func (c *RateLimitedChatClient) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Blocks until sending another message would not go over the rate limit
+func (c *RateLimitedChatClient) waitForCapacity() {
+	if len(c.sentTimes) == c.limit {
+		wait := time.Until(c.sentTimes[0].Add(c.period))
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+		c.sentTimes = c.sentTimes[1:]
+	}
+	c.sentTimes = append(c.sentTimes, time.Now())
+}
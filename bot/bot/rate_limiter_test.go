@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncRecordingChatClient struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (c *syncRecordingChatClient) Say(channel string, text string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.messages = append(c.messages, text)
+}
+
+func (c *syncRecordingChatClient) count() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.messages)
+}
+
+func (c *syncRecordingChatClient) last() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.messages) == 0 {
+		return ""
+	}
+	return c.messages[len(c.messages)-1]
+}
+
+func TestRateLimitedChatClient_SendsUpToLimit(t *testing.T) {
+	recorder := syncRecordingChatClient{}
+	client := NewRateLimitedChatClient(&recorder, 2, time.Hour, 10)
+	go client.Run()
+	defer client.Close()
+
+	client.Say("channel", "one")
+	client.Say("channel", "two")
+	client.Say("channel", "three")
+
+	deadline := time.Now().Add(time.Second)
+	for recorder.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if recorder.count() != 2 {
+		t.Errorf("Test Failed: Expected 2 messages to be sent but was %d", recorder.count())
+	}
+	if client.Sent() != 2 {
+		t.Errorf("Test Failed: Expected sent count to be 2 but was %d", client.Sent())
+	}
+}
+
+func TestRateLimitedChatClient_SendsQueuedMessagesAfterPeriod(t *testing.T) {
+	recorder := syncRecordingChatClient{}
+	client := NewRateLimitedChatClient(&recorder, 1, 50*time.Millisecond, 10)
+	go client.Run()
+	defer client.Close()
+
+	start := time.Now()
+	client.Say("channel", "one")
+	client.Say("channel", "two")
+
+	for recorder.count() < 2 && time.Since(start) < time.Second {
+		time.Sleep(time.Millisecond)
+	}
+
+	if recorder.count() != 2 {
+		t.Errorf("Test Failed: Expected 2 messages to be sent but was %d", recorder.count())
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("Test Failed: Expected second message to wait for the rate limit period")
+	}
+}
+
+func TestRateLimitedChatClient_DropsWhenQueueFull(t *testing.T) {
+	recorder := syncRecordingChatClient{}
+	client := NewRateLimitedChatClient(&recorder, 1, time.Hour, 1)
+
+	client.Say("channel", "one")
+	client.Say("channel", "two")
+
+	if client.QueueDepth() != 1 {
+		t.Errorf("Test Failed: Expected queue depth to be 1 but was %d", client.QueueDepth())
+	}
+	if client.Dropped() != 1 {
+		t.Errorf("Test Failed: Expected dropped count to be 1 but was %d", client.Dropped())
+	}
+}
@@ -0,0 +1,236 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HandlerFunc runs a command registered with RegisterCommand
+type HandlerFunc func(context *CommandContext)
+
+// CommandContext is everything a command registered with RegisterCommand needs to respond to the message invoking it
+type CommandContext struct {
+	// The message that invoked the command
+	Message ChatMessage
+	// The lowercase words after the command
+	Arguments []string
+	// The text after the command, keeping its case
+	ArgumentText string
+	// Values kept between invocations of the command in the channel
+	Storage *ChannelStorage
+	client  ChatClient
+}
+
+// Say sends a message in the channel the command was invoked in
+func (c *CommandContext) Say(text string) {
+	c.client.Say(c.Message.Channel, text)
+}
+
+// Reply sends a message in the channel the command was invoked in, mentioning the user who invoked it
+func (c *CommandContext) Reply(text string) {
+	c.client.Say(c.Message.Channel, fmt.Sprintf("@%s %s", c.Message.User.DisplayName, text))
+}
+
+// ChannelStorage is the storage of a single command in a single channel
+type ChannelStorage struct {
+	channel string
+	command string
+}
+
+// Get returns the value stored with the key
+func (s *ChannelStorage) Get(key string) (interface{}, bool) {
+	return commandStorage.Get(s.channel, s.command, key)
+}
+
+// Set stores a value with the key, which must be able to be saved as JSON, or removes it if the value is nil. It returns
+// an error if the command already has the most values it can store
+func (s *ChannelStorage) Set(key string, value interface{}) error {
+	return commandStorage.Set(s.channel, s.command, key, value)
+}
+
+// CommandOption changes a setting of a command registered with RegisterCommand
+type CommandOption func(command *builtInCommand)
+
+// ModOnly only lets mods and the broadcaster invoke the command
+func ModOnly() CommandOption {
+	return func(command *builtInCommand) {
+		command.modOnly = true
+	}
+}
+
+// Aliases lets the command also be invoked with the given names
+func Aliases(aliases ...string) CommandOption {
+	return func(command *builtInCommand) {
+		for _, alias := range aliases {
+			command.aliases = append(command.aliases, strings.ToLower(alias))
+		}
+	}
+}
+
+// Cooldown stops the command being invoked again in a channel until the duration has passed
+func Cooldown(duration time.Duration) CommandOption {
+	return func(command *builtInCommand) {
+		command.cooldown = duration
+	}
+}
+
+// UserCooldown stops each user invoking the command again until the duration has passed
+func UserCooldown(duration time.Duration) CommandOption {
+	return func(command *builtInCommand) {
+		command.userCooldown = duration
+	}
+}
+
+// RegisterCommand adds a command implemented in Go, replacing any command already registered with the same name.
+// Registered commands take priority over commands loaded from the commands folder, and go through the same permission
+// and cooldown checks
+func RegisterCommand(name string, handler HandlerFunc, options ...CommandOption) {
+	command := builtInCommand{invocation: strings.ToLower(name)}
+	for _, option := range options {
+		option(&command)
+	}
+	command.handler = func(client ChatClient, message ChatMessage, arguments []string) {
+		handler(&CommandContext{
+			Message:      message,
+			Arguments:    arguments,
+			ArgumentText: getArgumentTextFromMessage(message),
+			Storage:      &ChannelStorage{channel: message.Channel, command: command.invocation},
+			client:       client,
+		})
+	}
+	registerBuiltInCommand(command)
+}
+
+// UnregisterCommand removes a command added with RegisterCommand
+func UnregisterCommand(name string) {
+	unregisterBuiltInCommand(strings.ToLower(name))
+}
+
+// Checks whether the user can invoke the command, counting it towards the command's cooldowns if they can. Every kind of
+// command goes through this check before it runs
+func canInvoke(handler CommandProcessor, command InvokableCommand, message ChatMessage) bool {
+	messageLog := messageLogger(message).With("command", command.Invocation)
+	if !handler.HasPermissionToInvoke(command, message) {
+		metrics.PermissionDenied(command.Invocation)
+		messageLog.Debug("User does not have permission to invoke command")
+		return false
+	}
+
+	cooldown := time.Duration(command.Cooldown) * time.Second
+	userCooldown := time.Duration(command.UserCooldown) * time.Second
+	if remaining := cooldowns.Use(message, command.Invocation, cooldown, userCooldown); remaining > 0 {
+		metrics.CooldownHit(command.Invocation)
+		messageLog.Debug("Command is on cooldown", "remaining", remaining.String())
+		return false
+	}
+	return true
+}
+
+// CooldownTracker records when commands were last used in each channel and by each user
+type CooldownTracker struct {
+	mutex    sync.Mutex
+	lastUsed map[string]time.Time
+}
+
+var cooldowns = NewCooldownTracker()
+
+// NewCooldownTracker creates a CooldownTracker where no commands have been used
+func NewCooldownTracker() *CooldownTracker {
+	return &CooldownTracker{lastUsed: map[string]time.Time{}}
+}
+
+// Use returns how long is left before the message's user can use the command, or records the use and returns 0 if they
+// can use it now. Mods and the broadcaster skip cooldowns
+func (c *CooldownTracker) Use(message ChatMessage, invocation string, cooldown time.Duration, userCooldown time.Duration) time.Duration {
+	if isModerator(message) || (cooldown == 0 && userCooldown == 0) {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	channelKey := strings.ToLower(message.Channel) + ":" + invocation
+	userKey := channelKey + ":" + strings.ToLower(message.User.Name)
+	remaining := cooldown - now.Sub(c.lastUsed[channelKey])
+	if userRemaining := userCooldown - now.Sub(c.lastUsed[userKey]); userRemaining > remaining {
+		remaining = userRemaining
+	}
+	if remaining > 0 {
+		return remaining
+	}
+
+	c.lastUsed[channelKey] = now
+	c.lastUsed[userKey] = now
+	return 0
+}
+
+// CommandStorage keeps the values that script commands and registered commands store, in a file per channel with the
+// values of each command kept separate
+type CommandStorage struct {
+	mutex    sync.Mutex
+	channels map[string]map[string]map[string]interface{}
+}
+
+var commandStorage = NewCommandStorage()
+
+// The most keys a command can store values with in each channel, since every change rewrites the channel's file
+var commandStorageMaxKeys = 100
+
+var errCommandStorageFull = fmt.Errorf("commands can only store %d values", commandStorageMaxKeys)
+
+// NewCommandStorage creates a CommandStorage that loads and saves the values of each channel in the data folder
+func NewCommandStorage() *CommandStorage {
+	return &CommandStorage{channels: map[string]map[string]map[string]interface{}{}}
+}
+
+// Returns the values of a channel, loading them from disk the first time the channel is used
+func (s *CommandStorage) channelValues(channelName string) map[string]map[string]interface{} {
+	channelName = strings.ToLower(channelName)
+	values, ok := s.channels[channelName]
+	if !ok {
+		values = map[string]map[string]interface{}{}
+		err := readJSONFile(channelDataFile("storage", channelName), &values)
+		if err != nil {
+			logger.Error("Error loading command storage", "channel", channelName, "error", err)
+		}
+		s.channels[channelName] = values
+	}
+	return values
+}
+
+// Get returns the value the command stored with the key
+func (s *CommandStorage) Get(channelName string, command string, key string) (interface{}, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, ok := s.channelValues(channelName)[command][key]
+	return value, ok
+}
+
+// Set stores a value for the command with the key, removing it if the value is nil, and saves the channel's values. It
+// returns an error if the command already has the most values it can store
+func (s *CommandStorage) Set(channelName string, command string, key string, value interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	values := s.channelValues(channelName)
+	if values[command] == nil {
+		values[command] = map[string]interface{}{}
+	}
+	if value == nil {
+		delete(values[command], key)
+	} else {
+		if _, exists := values[command][key]; !exists && len(values[command]) >= commandStorageMaxKeys {
+			return errCommandStorageFull
+		}
+		values[command][key] = value
+	}
+
+	err := writeJSONFile(channelDataFile("storage", channelName), values)
+	if err != nil {
+		logger.Error("Error saving command storage", "channel", channelName, "error", err)
+	}
+	return nil
+}
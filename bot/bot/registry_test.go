@@ -0,0 +1,148 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+// Sets up empty commands and data folders with no commands on cooldown
+func setUpRegistry(t *testing.T) func() {
+	cleanUp := setUpScripts(t)
+	cooldowns = NewCooldownTracker()
+	return cleanUp
+}
+
+func TestRegisterCommand(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+
+	RegisterCommand("Hug", func(context *CommandContext) {
+		hugs, _ := context.Storage.Get("hugs")
+		count, _ := hugs.(float64)
+		context.Storage.Set("hugs", count+1)
+		context.Reply("hugged " + context.ArgumentText)
+		context.Say(context.Arguments[0])
+	}, Aliases("Cuddle"))
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!hug Goat"},
+		testMessage{user: "viewer", text: "!cuddle Sheep"},
+	)
+	expectMessages(t, []string{"@viewer hugged Goat", "goat", "@viewer hugged Sheep", "sheep"}, client.messages)
+
+	if hugs, _ := commandStorage.Get("testchannel", "hug", "hugs"); hugs != float64(2) {
+		t.Errorf("Test Failed: Expected 2 hugs to be stored but was %v", hugs)
+	}
+
+	if !hasBuiltInCommand("cuddle") {
+		t.Error("Test Failed: Expected the alias to be found")
+	}
+	UnregisterCommand("hug")
+	if hasBuiltInCommand("hug") {
+		t.Error("Test Failed: Expected the command to be unregistered")
+	}
+}
+
+func TestRegisterCommand_ModOnly(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+
+	RegisterCommand("secret", func(context *CommandContext) {
+		context.Say("secret")
+	}, ModOnly())
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: "!secret"}, modMessage("!secret"))
+	expectMessages(t, []string{"secret"}, client.messages)
+}
+
+func TestRegisterCommand_Cooldowns(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+
+	RegisterCommand("wave", func(context *CommandContext) {
+		context.Reply("waved")
+	}, UserCooldown(time.Minute))
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!wave"},
+		testMessage{user: "viewer", text: "!wave"},
+		testMessage{user: "other", text: "!wave"},
+		modMessage("!wave"),
+		modMessage("!wave"),
+	)
+	expectMessages(t, []string{"@viewer waved", "@other waved", "@mod waved", "@mod waved"}, client.messages)
+}
+
+func TestFileCommand_Cooldown(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "hello",
+		Message:    "Hello!",
+		Cooldown:   30,
+	}}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!hello"},
+		testMessage{user: "other", text: "!hello"},
+	)
+	expectMessages(t, []string{"Hello!"}, client.messages)
+}
+
+func TestScriptCommand_Cooldown(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+
+	err := loadTestScript(t, "roll", "-- cooldown: 30\nsay(\"rolled\")")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!roll"},
+		testMessage{user: "other", text: "!roll"},
+	)
+	expectMessages(t, []string{"rolled"}, client.messages)
+}
+
+func TestCooldownTracker_Use(t *testing.T) {
+	tracker := NewCooldownTracker()
+	message := newChannelMessage("viewer", nil, "!hello", "a")
+
+	if remaining := tracker.Use(message, "hello", time.Minute, 0); remaining != 0 {
+		t.Errorf("Test Failed: Expected the first use not to be on cooldown but %s was left", remaining)
+	}
+	if remaining := tracker.Use(message, "hello", time.Minute, 0); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("Test Failed: Expected the second use to be on cooldown but %s was left", remaining)
+	}
+	if remaining := tracker.Use(message, "other", time.Minute, 0); remaining != 0 {
+		t.Errorf("Test Failed: Expected other commands not to be on cooldown but %s was left", remaining)
+	}
+}
+
+func TestCommandStorage_LimitsKeys(t *testing.T) {
+	cleanUp := setUpRegistry(t)
+	defer cleanUp()
+
+	storage := &ChannelStorage{channel: "testchannel", command: "hug"}
+	for i := 0; i < commandStorageMaxKeys; i++ {
+		if err := storage.Set(string(rune('a'+i%26))+string(rune('0'+i/26)), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storage.Set("one too many", 1); err != errCommandStorageFull {
+		t.Errorf("Test Failed: Expected the storage to be full but was %v", err)
+	}
+	if err := storage.Set("a0", 2); err != nil {
+		t.Errorf("Test Failed: Expected an existing key to still be changed but was %v", err)
+	}
+	if err := storage.Set("a0", nil); err != nil || storage.Set("one more", 1) != nil {
+		t.Error("Test Failed: Expected removing a key to make room for another")
+	}
+}
@@ -0,0 +1,521 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits that stop a bad script from freezing message handling or using up the bot's memory
+var (
+	scriptTimeout       = 250 * time.Millisecond
+	scriptMemoryLimit   = uint64(16 * 1024 * 1024)
+	scriptCallStackSize = 64
+	scriptRegistrySize  = 64 * 1024
+	scriptMaxMessages   = 3
+	scriptMaxMessageLen = 500
+	scriptMaxStringLen  = 10000
+	scriptMaxKeyLen     = 100
+	// How often the heap is checked while a script runs
+	scriptMemoryCheckInterval = 50 * time.Millisecond
+)
+
+var errScriptMemoryLimit = errors.New("script used too much memory")
+
+// The global that every `..` in a script is rewritten to call. It isn't a valid Lua name, so a script can't hide it
+// with a local variable
+const scriptConcatFunction = "(concat)"
+
+// Functions from the Lua base library that scripts cannot use because they reach outside the sandbox
+var unsafeLuaFunctions = []string{"collectgarbage", "dofile", "getfenv", "load", "loadfile", "loadstring", "module",
+	"newproxy", "print", "require", "setfenv", "_printregs"}
+
+// A compiled `.command.lua` file
+type scriptCommand struct {
+	proto *lua.FunctionProto
+}
+
+// Guards scriptRandom, which is shared by every script
+var scriptRandomMutex sync.Mutex
+var scriptRandom = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Loads a `.command.lua` file as a command named after the file. Lines at the top of the file in the form
+// `-- mod_only: true` and `-- aliases: roll, dice` set the command's other settings
+func loadScriptCommand(filePath string, fileData []byte) error {
+	chunk, err := parse.Parse(strings.NewReader(string(fileData)), filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+	limitScriptConcat(chunk)
+	proto, err := lua.Compile(chunk, filepath.Base(filePath))
+	if err != nil {
+		return err
+	}
+
+	command := InvokableCommand{
+		Invocation: strings.ToLower(strings.TrimSuffix(filepath.Base(filePath), ".command.lua")),
+		script:     &scriptCommand{proto: proto},
+		filePath:   filePath,
+	}
+	for _, line := range strings.Split(string(fileData), "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "--") {
+			break
+		}
+		setting := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "--")), ":", 2)
+		if len(setting) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(setting[1])
+		switch strings.TrimSpace(setting[0]) {
+		case "mod_only":
+			command.ModOnly = value == "true"
+		case "aliases":
+			for _, alias := range strings.Split(value, ",") {
+				if alias = strings.ToLower(strings.TrimSpace(alias)); alias != "" {
+					command.Aliases = append(command.Aliases, alias)
+				}
+			}
+		case "disabled":
+			command.Disabled = value == "true"
+		case "cooldown":
+			command.Cooldown, _ = strconv.Atoi(value)
+		case "user_cooldown":
+			command.UserCooldown, _ = strconv.Atoi(value)
+		case "keyword":
+			command.Keyword = value == "true"
+		}
+	}
+
+	warnIfHiddenByBuiltIn(command)
+	commandsMutex.Lock()
+	InvokableCommandList = append(InvokableCommandList, command)
+	commandsMutex.Unlock()
+	return nil
+}
+
+// Runs a script command in a new sandboxed interpreter, sending anything it says once it has finished
+func runScriptCommand(client ChatClient, message ChatMessage, command InvokableCommand) error {
+	messages, err := runScript(command.script, command.Invocation, message)
+	for _, text := range messages {
+		client.Say(message.Channel, text)
+	}
+	return err
+}
+
+// Runs the script for the message, returning the messages it said
+func runScript(script *scriptCommand, invocation string, message ChatMessage) ([]string, error) {
+	state := lua.NewState(lua.Options{
+		SkipOpenLibs:        true,
+		CallStackSize:       scriptCallStackSize,
+		RegistrySize:        1024,
+		RegistryMaxSize:     scriptRegistrySize,
+		MinimizeStackMemory: true,
+	})
+	defer state.Close()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	ctx, cancelTimeout := context.WithTimeout(ctx, scriptTimeout)
+	defer cancelTimeout()
+	state.SetContext(ctx)
+	stopWatching := watchScriptMemory(cancel)
+	defer stopWatching()
+
+	openSandboxedLibraries(state)
+	var messages []string
+	say := func(text string) {
+		if len(messages) >= scriptMaxMessages {
+			state.RaiseError("scripts can only send %d messages", scriptMaxMessages)
+		}
+		if len(text) > scriptMaxMessageLen {
+			text = text[:scriptMaxMessageLen]
+		}
+		messages = append(messages, text)
+	}
+	setScriptAPI(state, invocation, message, say)
+
+	state.Push(state.NewFunctionFromProto(script.proto))
+	err := state.PCall(0, lua.MultRet, nil)
+	if cause := context.Cause(ctx); cause != nil && cause != context.Canceled {
+		if cause == context.DeadlineExceeded {
+			return messages, fmt.Errorf("script took longer than %s", scriptTimeout)
+		}
+		return messages, cause
+	}
+	return messages, err
+}
+
+// Cancels the script if the heap grows by more than the memory limit while it runs, returning a function to stop
+// watching once the script has finished. This is only a heuristic: the heap belongs to the whole process, so other
+// goroutines allocating at the same time count towards the script's limit, and a script can allocate a lot between
+// checks. The string library wrappers in openSandboxedLibraries are what stop single large allocations
+func watchScriptMemory(cancel context.CancelCauseFunc) func() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	start := stats.HeapAlloc
+	done := make(chan struct{})
+
+	go func() {
+		// Reading the memory stats stops the world, so the heap isn't checked too often
+		ticker := time.NewTicker(scriptMemoryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				runtime.ReadMemStats(&stats)
+				if stats.HeapAlloc > start && stats.HeapAlloc-start > scriptMemoryLimit {
+					cancel(errScriptMemoryLimit)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// Opens the base, table, string and math libraries without the functions that could reach outside the sandbox
+func openSandboxedLibraries(state *lua.LState) {
+	for _, library := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		state.Push(state.NewFunction(library.open))
+		state.Push(lua.LString(library.name))
+		state.Call(1, 0)
+	}
+
+	for _, name := range unsafeLuaFunctions {
+		state.SetGlobal(name, lua.LNil)
+	}
+
+	// string.rep, string.format, table.concat and `..` can build a huge string in one step without the interpreter
+	// noticing the time or memory limit
+	state.SetGlobal(scriptConcatFunction, state.NewFunction(luaConcat))
+	tableLibrary := state.GetGlobal(lua.TabLibName).(*lua.LTable)
+	concat := tableLibrary.RawGetString("concat").(*lua.LFunction).GFunction
+	tableLibrary.RawSetString("concat", state.NewFunction(func(state *lua.LState) int {
+		table, separator := state.CheckTable(1), state.OptString(2, "")
+		// Clamped to the table the same way table.concat does
+		first, last := state.OptInt(3, 1), state.OptInt(4, table.Len())
+		if first < 1 {
+			first = 1
+		}
+		if last > table.Len() {
+			last = table.Len()
+		}
+		length := 0
+		for i := first; i <= last; i++ {
+			value := table.RawGetInt(i)
+			if !lua.LVCanConvToString(value) {
+				// table.concat raises its own error for the value
+				break
+			}
+			length += len(lua.LVAsString(value))
+			if i > first {
+				length += len(separator)
+			}
+			if length > scriptMaxStringLen {
+				state.RaiseError("table.concat result is longer than %d characters", scriptMaxStringLen)
+			}
+		}
+		return concat(state)
+	}))
+	stringLibrary := state.GetGlobal(lua.StringLibName).(*lua.LTable)
+	rep := stringLibrary.RawGetString("rep").(*lua.LFunction).GFunction
+	stringLibrary.RawSetString("rep", state.NewFunction(func(state *lua.LState) int {
+		text, count := state.CheckString(1), state.CheckInt(2)
+		// Divided rather than multiplied so a huge count can't overflow past the check
+		if len(text) > 0 && count > scriptMaxStringLen/len(text) {
+			state.RaiseError("string.rep result is longer than %d characters", scriptMaxStringLen)
+		}
+		return rep(state)
+	}))
+	format := stringLibrary.RawGetString("format").(*lua.LFunction).GFunction
+	stringLibrary.RawSetString("format", state.NewFunction(func(state *lua.LState) int {
+		if !validLuaFormat(state.CheckString(1)) {
+			state.RaiseError("invalid format (width or precision too long)")
+		}
+		return format(state)
+	}))
+	mathLibrary := state.GetGlobal(lua.MathLibName).(*lua.LTable)
+	mathLibrary.RawSetString("random", state.NewFunction(luaRandom))
+	mathLibrary.RawSetString("randomseed", lua.LNil)
+}
+
+// Joins the two values like `..`, raising an error instead if the result would be longer than scriptMaxStringLen
+func luaConcat(state *lua.LState) int {
+	lhs, rhs := state.Get(1), state.Get(2)
+	if lua.LVCanConvToString(lhs) && lua.LVCanConvToString(rhs) {
+		left, right := lua.LVAsString(lhs), lua.LVAsString(rhs)
+		if len(left)+len(right) > scriptMaxStringLen {
+			state.RaiseError("string is longer than %d characters", scriptMaxStringLen)
+		}
+		state.Push(lua.LString(left + right))
+		return 1
+	}
+
+	for _, operand := range []lua.LValue{lhs, rhs} {
+		if method := state.GetMetaField(operand, "__concat"); method.Type() == lua.LTFunction {
+			state.Push(method)
+			state.Push(lhs)
+			state.Push(rhs)
+			state.Call(2, 1)
+			return 1
+		}
+	}
+	state.RaiseError("cannot perform concat operation between %v and %v", lhs.Type().String(), rhs.Type().String())
+	return 0
+}
+
+// Rewrites every `..` in the statements into a call to scriptConcatFunction, so the length of the result is checked
+// before it's built. Otherwise a script repeatedly doubling a string could use up the bot's memory between checks of
+// the heap
+func limitScriptConcat(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.AssignStmt:
+			limitConcatExprs(stmt.Lhs)
+			limitConcatExprs(stmt.Rhs)
+		case *ast.LocalAssignStmt:
+			limitConcatExprs(stmt.Exprs)
+		case *ast.FuncCallStmt:
+			stmt.Expr = limitConcat(stmt.Expr)
+		case *ast.DoBlockStmt:
+			limitScriptConcat(stmt.Stmts)
+		case *ast.WhileStmt:
+			stmt.Condition = limitConcat(stmt.Condition)
+			limitScriptConcat(stmt.Stmts)
+		case *ast.RepeatStmt:
+			stmt.Condition = limitConcat(stmt.Condition)
+			limitScriptConcat(stmt.Stmts)
+		case *ast.IfStmt:
+			stmt.Condition = limitConcat(stmt.Condition)
+			limitScriptConcat(stmt.Then)
+			limitScriptConcat(stmt.Else)
+		case *ast.NumberForStmt:
+			stmt.Init = limitConcat(stmt.Init)
+			stmt.Limit = limitConcat(stmt.Limit)
+			stmt.Step = limitConcat(stmt.Step)
+			limitScriptConcat(stmt.Stmts)
+		case *ast.GenericForStmt:
+			limitConcatExprs(stmt.Exprs)
+			limitScriptConcat(stmt.Stmts)
+		case *ast.FuncDefStmt:
+			limitScriptConcat(stmt.Func.Stmts)
+		case *ast.ReturnStmt:
+			limitConcatExprs(stmt.Exprs)
+		}
+	}
+}
+
+func limitConcatExprs(exprs []ast.Expr) {
+	for i := range exprs {
+		exprs[i] = limitConcat(exprs[i])
+	}
+}
+
+// Returns the expression with every `..` in it rewritten into a call to scriptConcatFunction
+func limitConcat(expr ast.Expr) ast.Expr {
+	switch expr := expr.(type) {
+	case *ast.StringConcatOpExpr:
+		function := &ast.IdentExpr{Value: scriptConcatFunction}
+		function.SetLine(expr.Line())
+		function.SetLastLine(expr.LastLine())
+		call := &ast.FuncCallExpr{Func: function, Args: []ast.Expr{limitConcat(expr.Lhs), limitConcat(expr.Rhs)}, AdjustRet: true}
+		call.SetLine(expr.Line())
+		call.SetLastLine(expr.LastLine())
+		return call
+	case *ast.AttrGetExpr:
+		expr.Object = limitConcat(expr.Object)
+		expr.Key = limitConcat(expr.Key)
+	case *ast.TableExpr:
+		for _, field := range expr.Fields {
+			field.Key = limitConcat(field.Key)
+			field.Value = limitConcat(field.Value)
+		}
+	case *ast.FuncCallExpr:
+		expr.Func = limitConcat(expr.Func)
+		expr.Receiver = limitConcat(expr.Receiver)
+		limitConcatExprs(expr.Args)
+	case *ast.LogicalOpExpr:
+		expr.Lhs = limitConcat(expr.Lhs)
+		expr.Rhs = limitConcat(expr.Rhs)
+	case *ast.RelationalOpExpr:
+		expr.Lhs = limitConcat(expr.Lhs)
+		expr.Rhs = limitConcat(expr.Rhs)
+	case *ast.ArithmeticOpExpr:
+		expr.Lhs = limitConcat(expr.Lhs)
+		expr.Rhs = limitConcat(expr.Rhs)
+	case *ast.UnaryMinusOpExpr:
+		expr.Expr = limitConcat(expr.Expr)
+	case *ast.UnaryNotOpExpr:
+		expr.Expr = limitConcat(expr.Expr)
+	case *ast.UnaryLenOpExpr:
+		expr.Expr = limitConcat(expr.Expr)
+	case *ast.FunctionExpr:
+		limitScriptConcat(expr.Stmts)
+	}
+	return expr
+}
+
+// Returns whether every width and precision in a string.format format has at most 2 digits, as in standard Lua
+func validLuaFormat(format string) bool {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		if i < len(format) && format[i] == '%' {
+			continue
+		}
+		for i < len(format) && strings.IndexByte("-+ #0", format[i]) != -1 {
+			i++
+		}
+		digits := 0
+		for ; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+			digits++
+		}
+		if digits > 2 {
+			return false
+		}
+		if i < len(format) && format[i] == '.' {
+			digits = 0
+			for i++; i < len(format) && format[i] >= '0' && format[i] <= '9'; i++ {
+				digits++
+			}
+			if digits > 2 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Sets the globals scripts use to read the message and respond
+func setScriptAPI(state *lua.LState, invocation string, message ChatMessage, say func(text string)) {
+	sender := state.NewTable()
+	sender.RawSetString("name", lua.LString(message.User.Name))
+	sender.RawSetString("display_name", lua.LString(message.User.DisplayName))
+	sender.RawSetString("is_mod", lua.LBool(isModerator(message)))
+	badges := state.NewTable()
+	for badge, version := range message.User.Badges {
+		badges.RawSetString(badge, lua.LNumber(version))
+	}
+	sender.RawSetString("badges", badges)
+	state.SetGlobal("sender", sender)
+
+	args := state.NewTable()
+	for _, argument := range strings.Fields(getArgumentTextFromMessage(message)) {
+		args.Append(lua.LString(argument))
+	}
+	state.SetGlobal("args", args)
+	state.SetGlobal("channel", lua.LString(message.Channel))
+
+	state.SetGlobal("say", state.NewFunction(func(state *lua.LState) int {
+		say(state.CheckString(1))
+		return 0
+	}))
+	state.SetGlobal("reply", state.NewFunction(func(state *lua.LState) int {
+		say("@" + message.User.DisplayName + " " + state.CheckString(1))
+		return 0
+	}))
+	state.SetGlobal("random", state.NewFunction(luaRandom))
+
+	storage := state.NewTable()
+	storage.RawSetString("get", state.NewFunction(func(state *lua.LState) int {
+		value, ok := commandStorage.Get(message.Channel, invocation, state.CheckString(1))
+		if !ok {
+			state.Push(lua.LNil)
+			return 1
+		}
+		state.Push(goToLua(value))
+		return 1
+	}))
+	storage.RawSetString("set", state.NewFunction(func(state *lua.LState) int {
+		key := state.CheckString(1)
+		if len(key) > scriptMaxKeyLen {
+			state.ArgError(1, fmt.Sprintf("storage keys must be at most %d characters", scriptMaxKeyLen))
+		}
+		value, ok := luaToGo(state.Get(2))
+		if !ok {
+			state.ArgError(2, "storage values must be strings, numbers, booleans or nil")
+		}
+		if text, isString := value.(string); isString && len(text) > scriptMaxStringLen {
+			state.ArgError(2, fmt.Sprintf("storage values must be at most %d characters", scriptMaxStringLen))
+		}
+		if err := commandStorage.Set(message.Channel, invocation, key, value); err != nil {
+			state.RaiseError("%s", err.Error())
+		}
+		return 0
+	}))
+	state.SetGlobal("storage", storage)
+}
+
+// random(m, n) returns a whole number from m to n, random(n) from 1 to n and random() a number from 0 to 1, like
+// math.random
+func luaRandom(state *lua.LState) int {
+	scriptRandomMutex.Lock()
+	defer scriptRandomMutex.Unlock()
+
+	switch state.GetTop() {
+	case 0:
+		state.Push(lua.LNumber(scriptRandom.Float64()))
+	case 1:
+		upper := state.CheckInt(1)
+		if upper < 1 {
+			state.ArgError(1, "interval is empty")
+		}
+		state.Push(lua.LNumber(scriptRandom.Intn(upper) + 1))
+	default:
+		lower, upper := state.CheckInt(1), state.CheckInt(2)
+		if upper < lower {
+			state.ArgError(2, "interval is empty")
+		}
+		state.Push(lua.LNumber(lower + scriptRandom.Intn(upper-lower+1)))
+	}
+	return 1
+}
+
+func goToLua(value interface{}) lua.LValue {
+	switch converted := value.(type) {
+	case string:
+		return lua.LString(converted)
+	case float64:
+		return lua.LNumber(converted)
+	case bool:
+		return lua.LBool(converted)
+	}
+	return lua.LNil
+}
+
+func luaToGo(value lua.LValue) (interface{}, bool) {
+	switch converted := value.(type) {
+	case lua.LString:
+		return string(converted), true
+	case lua.LNumber:
+		return float64(converted), true
+	case lua.LBool:
+		return bool(converted), true
+	}
+	return nil, value == lua.LNil
+}
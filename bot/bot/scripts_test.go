@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sets up empty commands and data folders
+func setUpScripts(t *testing.T) func() {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commandsDirectory = directory
+	dataDirectory = directory
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "goatbot"
+	IntervalMessageList = nil
+	InvokableCommandList = nil
+	ChatTriggerList = nil
+	builtInCommands = nil
+	messageListeners = nil
+	commandStorage = NewCommandStorage()
+	channelPrefixes = NewPrefixStore()
+	additionalPrefixes = nil
+	return func() {
+		InvokableCommandList = nil
+		ChatTriggerList = nil
+		commandsDirectory = "commands/"
+		dataDirectory = "data/"
+		_ = os.RemoveAll(directory)
+	}
+}
+
+// Writes a script command file and loads it
+func loadTestScript(t *testing.T, name string, script string) error {
+	filePath := filepath.Join(commandsDirectory, name+".command.lua")
+	err := ioutil.WriteFile(filePath, []byte(script), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loadCommandDataFromFile(filePath)
+}
+
+func TestScriptCommand_API(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	scriptRandom = rand.New(rand.NewSource(1))
+
+	err := loadTestScript(t, "echo", `-- mod_only: false
+-- aliases: repeat, say
+local count = (storage.get("count") or 0) + 1
+storage.set("count", count)
+reply(table.concat(args, " ") .. " #" .. count)
+if sender.badges.subscriber then
+	say(sender.display_name .. " is a subscriber")
+end
+local roll = random(1, 6)
+if roll < 1 or roll > 6 then
+	say("bad roll")
+end`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command, _ := findCommand("echo")
+	if len(command.Aliases) != 2 || command.Aliases[1] != "say" || command.ModOnly {
+		t.Errorf("Test Failed: Expected the header settings to be loaded but was %+v", command)
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!echo Hello World"},
+		testMessage{user: "Subscriber", badges: map[string]int{"subscriber": 1}, text: "!repeat Case Kept"},
+	)
+	expectMessages(t, []string{
+		"@viewer Hello World #1",
+		"@Subscriber Case Kept #2",
+		"Subscriber is a subscriber",
+	}, client.messages)
+
+	if count, _ := NewCommandStorage().Get("testchannel", "echo", "count"); count != float64(2) {
+		t.Errorf("Test Failed: Expected the stored count to be saved but was %v", count)
+	}
+}
+
+func TestScriptCommand_ModOnly(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+
+	err := loadTestScript(t, "secret", "-- mod_only: true\nsay(\"secret\")")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: "!secret"}, modMessage("!secret"))
+	expectMessages(t, []string{"secret"}, client.messages)
+}
+
+func TestScriptCommand_SyntaxError(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+
+	if loadTestScript(t, "broken", "say(") == nil {
+		t.Error("Test Failed: Expected a syntax error when loading the script")
+	}
+	if _, exists := findCommand("broken"); exists {
+		t.Error("Test Failed: Expected the broken script not to be loaded")
+	}
+}
+
+func TestScriptCommand_Sandbox(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+
+	for _, name := range []string{"os", "io", "require", "dofile", "loadstring", "debug", "print"} {
+		err := loadTestScript(t, "check", "say(type("+name+"))")
+		if err != nil {
+			t.Fatal(err)
+		}
+		command, _ := findCommand("check")
+		messages, err := runScript(command.script, "check", newChannelMessage("viewer", nil, "!check", "1"))
+		if err != nil || len(messages) != 1 || messages[0] != "nil" {
+			t.Errorf("Test Failed: Expected %s to be unavailable but was %v, %v", name, messages, err)
+		}
+		unloadFile(command.filePath)
+	}
+}
+
+func TestScriptCommand_Limits(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+
+	cases := map[string]string{
+		"loop":      "while true do end",
+		"memory":    "local t = {} local i = 0 while true do i = i + 1 t[i] = tostring(i) .. \"padding to use memory faster\" end",
+		"rep":       "say(string.rep(\"x\", 1000000000))",
+		"overflow":  "say(string.rep(\"xx\", 4611686018427387904))",
+		"width":     "say(string.format(\"%99999999s\", \"x\"))",
+		"precision": "say(string.format(\"%.99999999f\", 1))",
+		"storage":   "for i = 1, 200 do storage.set(\"key\" .. i, i) end",
+		"concat":    "local t = {} local s = string.rep(\"x\", 10000) for i = 1, 2000 do t[i] = s end say(table.concat(t))",
+		"doubling":  "local s = \"x\" while true do s = s .. s end",
+		"nested":    "local function grow(s) return {s .. s .. s} end local s = \"x\" while true do s = grow(s)[1] end",
+		"recursion": "local function f() return 1 + f() end f()",
+		"messages":  "for i = 1, 10 do say(\"spam\") end",
+	}
+	for name, script := range cases {
+		err := loadTestScript(t, name, script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		command, _ := findCommand(name)
+
+		start := time.Now()
+		messages, err := runScript(command.script, name, newChannelMessage("viewer", nil, "!"+name, "1"))
+		if err == nil {
+			t.Errorf("Test Failed: Expected the %s script to be stopped", name)
+		}
+		if elapsed := time.Since(start); elapsed > 2*scriptTimeout {
+			t.Errorf("Test Failed: Expected the %s script to be stopped within the time limit but took %s", name, elapsed)
+		}
+		if len(messages) > scriptMaxMessages {
+			t.Errorf("Test Failed: Expected at most %d messages from the %s script but was %d", scriptMaxMessages, name, len(messages))
+		}
+	}
+
+	command, _ := findCommand("loop")
+	_, err := runScript(command.script, "loop", newChannelMessage("viewer", nil, "!loop", "1"))
+	if err == nil || !strings.Contains(err.Error(), "longer than") {
+		t.Errorf("Test Failed: Expected a time limit error but was %v", err)
+	}
+	for _, name := range []string{"concat", "doubling", "nested"} {
+		command, _ = findCommand(name)
+		_, err = runScript(command.script, name, newChannelMessage("viewer", nil, "!"+name, "1"))
+		if err == nil || !strings.Contains(err.Error(), "longer than 10000 characters") {
+			t.Errorf("Test Failed: Expected the %s script to be stopped before building the string but was %v", name, err)
+		}
+	}
+
+	err = loadTestScript(t, "format", "say(string.format(\"%5.2f%% %-3s|\", 12.345, \"a\"))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	command, _ = findCommand("format")
+	messages, err := runScript(command.script, "format", newChannelMessage("viewer", nil, "!format", "1"))
+	if err != nil || len(messages) != 1 || messages[0] != "12.35% a  |" {
+		t.Errorf("Test Failed: Expected short widths and precisions to be allowed but was %v, %v", messages, err)
+	}
+
+	err = loadTestScript(t, "join", `local meta = setmetatable({}, {__concat = function(a, b) return "meta" end})
+say("a" .. 1 .. "b" .. table.concat({1, "x"}, ",") .. (meta .. "c"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	command, _ = findCommand("join")
+	messages, err = runScript(command.script, "join", newChannelMessage("viewer", nil, "!join", "1"))
+	if err != nil || len(messages) != 1 || messages[0] != "a1b1,xmeta" {
+		t.Errorf("Test Failed: Expected short concatenations to be allowed but was %v, %v", messages, err)
+	}
+}
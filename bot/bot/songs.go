@@ -0,0 +1,330 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSongRequestLimit = 3
+	queueMessageSongs       = 5
+	maximumSongTextLength   = 100
+)
+
+// Song is a song requested by a user
+type Song struct {
+	Title       string    `json:"title"`
+	URL         string    `json:"url,omitempty"`
+	User        string    `json:"user"`
+	Cost        int64     `json:"cost,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// SongValidator checks what a user asked for in a song request and returns the song to add to the queue
+type SongValidator interface {
+	Validate(request string) (Song, error)
+}
+
+// LinkSongValidator accepts links to the allowed hosts and, if AllowSearch is set, plain text for the streamer to
+// search for. It does not look the songs up, so it works offline
+type LinkSongValidator struct {
+	AllowedHosts []string
+	AllowSearch  bool
+}
+
+// NewLinkSongValidator creates a LinkSongValidator that allows YouTube, Spotify and SoundCloud links and plain text
+func NewLinkSongValidator() *LinkSongValidator {
+	return &LinkSongValidator{
+		AllowedHosts: []string{"youtube.com", "youtu.be", "music.youtube.com", "open.spotify.com", "soundcloud.com"},
+		AllowSearch:  true,
+	}
+}
+
+// Validate returns the song for the link or text, or an error if it is not allowed
+func (v *LinkSongValidator) Validate(request string) (Song, error) {
+	if !strings.HasPrefix(request, "http://") && !strings.HasPrefix(request, "https://") {
+		if !v.AllowSearch {
+			return Song{}, errors.New("song requests must be a link")
+		}
+		if len(request) > maximumSongTextLength {
+			return Song{}, errors.New("song request is too long")
+		}
+		return Song{Title: request}, nil
+	}
+
+	link, err := url.Parse(request)
+	if err != nil || link.Host == "" {
+		return Song{}, errors.New("that isn't a valid link")
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(link.Hostname()), "www."), "m.")
+	for _, allowed := range v.AllowedHosts {
+		if host == allowed {
+			return Song{Title: link.String(), URL: link.String()}, nil
+		}
+	}
+	return Song{}, errors.New("links from " + host + " aren't allowed")
+}
+
+// SongQueue keeps the song requests for every channel, stored in a file per channel
+type SongQueue struct {
+	mutex       sync.Mutex
+	channels    map[string][]Song
+	subscribers map[string][]chan []Song
+}
+
+var songQueue *SongQueue
+var songValidator SongValidator = NewLinkSongValidator()
+var songRequestLimit = defaultSongRequestLimit
+var songRequestCost int64
+
+// NewSongQueue creates a SongQueue that loads and saves the queue of each channel in the data folder
+func NewSongQueue() *SongQueue {
+	return &SongQueue{
+		channels:    map[string][]Song{},
+		subscribers: map[string][]chan []Song{},
+	}
+}
+
+// Sets up the song request queue and commands, with each user allowed limit songs in the queue at once, each costing
+// cost points
+func initSongRequests(limit string, cost string) error {
+	if limit != "" {
+		var err error
+		songRequestLimit, err = strconv.Atoi(limit)
+		if err != nil || songRequestLimit < 1 {
+			return errors.New("SONG_REQUEST_LIMIT must be a positive number")
+		}
+	}
+	if cost != "" {
+		var err error
+		songRequestCost, err = strconv.ParseInt(cost, 10, 64)
+		if err != nil || songRequestCost < 0 {
+			return errors.New("SONG_REQUEST_COST must be a number of points")
+		}
+	}
+
+	songQueue = NewSongQueue()
+	registerBuiltInCommand(builtInCommand{invocation: "sr", handler: songRequestCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "queue", handler: queueCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "wrongsong", handler: wrongSongCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "skip", modOnly: true, handler: skipCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "clearqueue", modOnly: true, handler: clearQueueCommand})
+	return nil
+}
+
+// Returns the queue of a channel, loading it from disk the first time the channel is used
+func (q *SongQueue) channelQueue(channelName string) []Song {
+	channelName = strings.ToLower(channelName)
+	songs, ok := q.channels[channelName]
+	if !ok {
+		err := readJSONFile(channelDataFile("songs", channelName), &songs)
+		if err != nil {
+			logger.Error("Error loading song queue", "channel", channelName, "error", err)
+		}
+		q.channels[channelName] = songs
+	}
+	return songs
+}
+
+// Saves the channel's queue and sends it to anything subscribed to it
+func (q *SongQueue) update(channelName string, songs []Song) {
+	channelName = strings.ToLower(channelName)
+	q.channels[channelName] = songs
+	err := writeJSONFile(channelDataFile("songs", channelName), songs)
+	if err != nil {
+		logger.Error("Error saving song queue", "channel", channelName, "error", err)
+	}
+
+	for _, subscriber := range q.subscribers[channelName] {
+		// Only the latest queue matters, so replace any queue the subscriber hasn't received yet
+		select {
+		case <-subscriber:
+		default:
+		}
+		subscriber <- append([]Song(nil), songs...)
+	}
+}
+
+// Songs returns the songs in the channel's queue, next song first
+func (q *SongQueue) Songs(channelName string) []Song {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return append([]Song(nil), q.channelQueue(channelName)...)
+}
+
+// Add adds the song to the end of the channel's queue unless the user already has the maximum number of songs in it,
+// returning its position in the queue
+func (q *SongQueue) Add(channelName string, song Song, limit int) (int, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	songs := q.channelQueue(channelName)
+	requested := 0
+	for _, queued := range songs {
+		if strings.EqualFold(queued.User, song.User) {
+			requested++
+		}
+	}
+	if requested >= limit {
+		return 0, fmt.Errorf("you already have %s in the queue", pluralise(requested, "song"))
+	}
+
+	q.update(channelName, append(songs, song))
+	return len(songs) + 1, nil
+}
+
+// RemoveLatest removes the user's most recent request from the channel's queue
+func (q *SongQueue) RemoveLatest(channelName string, user string) (Song, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	songs := q.channelQueue(channelName)
+	for i := len(songs) - 1; i >= 0; i-- {
+		if strings.EqualFold(songs[i].User, user) {
+			removed := songs[i]
+			q.update(channelName, append(append([]Song(nil), songs[:i]...), songs[i+1:]...))
+			return removed, true
+		}
+	}
+	return Song{}, false
+}
+
+// Skip removes the song at the front of the channel's queue
+func (q *SongQueue) Skip(channelName string) (Song, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	songs := q.channelQueue(channelName)
+	if len(songs) == 0 {
+		return Song{}, false
+	}
+	q.update(channelName, append([]Song(nil), songs[1:]...))
+	return songs[0], true
+}
+
+// Clear removes every song from the channel's queue
+func (q *SongQueue) Clear(channelName string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.update(channelName, nil)
+}
+
+// Subscribe returns a channel that receives the channel's queue now and whenever it changes, and a function to call to
+// stop receiving it
+func (q *SongQueue) Subscribe(channelName string) (<-chan []Song, func()) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	channelName = strings.ToLower(channelName)
+	subscriber := make(chan []Song, 1)
+	subscriber <- append([]Song(nil), q.channelQueue(channelName)...)
+	q.subscribers[channelName] = append(q.subscribers[channelName], subscriber)
+
+	return subscriber, func() {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		var remaining []chan []Song
+		for _, other := range q.subscribers[channelName] {
+			if other != subscriber {
+				remaining = append(remaining, other)
+			}
+		}
+		q.subscribers[channelName] = remaining
+	}
+}
+
+// !sr <link or text> adds a song to the queue
+func songRequestCommand(client ChatClient, message ChatMessage, arguments []string) {
+	request := getArgumentTextFromMessage(message)
+	if request == "" {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"sr <link or song name>")
+		return
+	}
+
+	song, err := songValidator.Validate(request)
+	if err != nil {
+		client.Say(message.Channel, fmt.Sprintf("@%s %s", message.User.DisplayName, err))
+		return
+	}
+	song.User = message.User.Name
+	song.RequestedAt = time.Now()
+
+	if songRequestCost > 0 && pointsStore != nil {
+		if pointsStore.Spend(message.Channel, message.User.Name, songRequestCost) != nil {
+			client.Say(message.Channel, fmt.Sprintf("@%s song requests cost %d points", message.User.DisplayName, songRequestCost))
+			return
+		}
+		song.Cost = songRequestCost
+	}
+
+	position, err := songQueue.Add(message.Channel, song, songRequestLimit)
+	if err != nil {
+		if song.Cost > 0 {
+			pointsStore.Add(message.Channel, message.User.Name, song.Cost)
+		}
+		client.Say(message.Channel, fmt.Sprintf("@%s %s", message.User.DisplayName, err))
+		return
+	}
+	client.Say(message.Channel, fmt.Sprintf("@%s added %s to the queue at position %d", message.User.DisplayName, song.Title, position))
+}
+
+// !queue sends the next songs in the queue
+func queueCommand(client ChatClient, message ChatMessage, arguments []string) {
+	songs := songQueue.Songs(message.Channel)
+	if len(songs) == 0 {
+		client.Say(message.Channel, "The song queue is empty")
+		return
+	}
+
+	var upNext []string
+	for i, song := range songs {
+		if i == queueMessageSongs {
+			break
+		}
+		upNext = append(upNext, fmt.Sprintf("%d) %s (%s)", i+1, song.Title, song.User))
+	}
+	queue := fmt.Sprintf("%s in the queue: %s", pluralise(len(songs), "song"), strings.Join(upNext, ", "))
+	if len(songs) > queueMessageSongs {
+		queue += fmt.Sprintf(" and %d more", len(songs)-queueMessageSongs)
+	}
+	client.Say(message.Channel, queue)
+}
+
+// !wrongsong removes the most recent song the user requested, refunding any points it cost
+func wrongSongCommand(client ChatClient, message ChatMessage, arguments []string) {
+	song, removed := songQueue.RemoveLatest(message.Channel, message.User.Name)
+	if !removed {
+		client.Say(message.Channel, fmt.Sprintf("@%s you don't have any songs in the queue", message.User.DisplayName))
+		return
+	}
+	if song.Cost > 0 && pointsStore != nil {
+		pointsStore.Add(message.Channel, message.User.Name, song.Cost)
+	}
+	client.Say(message.Channel, fmt.Sprintf("@%s removed %s from the queue", message.User.DisplayName, song.Title))
+}
+
+// !skip removes the current song from the queue
+func skipCommand(client ChatClient, message ChatMessage, arguments []string) {
+	song, skipped := songQueue.Skip(message.Channel)
+	if !skipped {
+		client.Say(message.Channel, "The song queue is empty")
+		return
+	}
+
+	skippedMessage := "Skipped " + song.Title
+	if songs := songQueue.Songs(message.Channel); len(songs) > 0 {
+		skippedMessage += fmt.Sprintf(", up next: %s (%s)", songs[0].Title, songs[0].User)
+	}
+	client.Say(message.Channel, skippedMessage)
+}
+
+// !clearqueue removes every song from the queue
+func clearQueueCommand(client ChatClient, message ChatMessage, arguments []string) {
+	songQueue.Clear(message.Channel)
+	client.Say(message.Channel, "Cleared the song queue")
+}
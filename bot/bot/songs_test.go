@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Accepts any request except ones containing "banned", naming the song after the request
+type fakeSongValidator struct{}
+
+func (v fakeSongValidator) Validate(request string) (Song, error) {
+	if strings.Contains(request, "banned") {
+		return Song{}, errors.New("that song is banned")
+	}
+	return Song{Title: request}, nil
+}
+
+// Sets up an empty data folder and song queue with the song request commands registered
+func setUpSongRequests(t *testing.T, cost string) func() {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDirectory = directory
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "goatbot"
+	IntervalMessageList = nil
+	InvokableCommandList = nil
+	builtInCommands = nil
+	messageListeners = nil
+	err = initSongRequests("2", cost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	songValidator = fakeSongValidator{}
+	return func() {
+		songQueue = nil
+		songValidator = NewLinkSongValidator()
+		songRequestLimit = defaultSongRequestLimit
+		songRequestCost = 0
+		builtInCommands = nil
+		messageListeners = nil
+		dataDirectory = "data/"
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func expectMessages(t *testing.T, expected []string, actual []string) {
+	if len(actual) != len(expected) {
+		t.Fatalf("Test Failed: Expected %v but was %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("Test Failed: Expected '%s' but was '%s'", expected[i], actual[i])
+		}
+	}
+}
+
+func TestSongRequests_QueueAndLimits(t *testing.T) {
+	cleanUp := setUpSongRequests(t, "")
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!sr Never Gonna Give You Up"},
+		testMessage{user: "viewer", text: "!sr banned song"},
+		testMessage{user: "other", text: "!sr Darude - Sandstorm"},
+		testMessage{user: "viewer", text: "!sr All Star"},
+		testMessage{user: "viewer", text: "!sr One Too Many"},
+		testMessage{user: "viewer", text: "!queue"},
+		testMessage{user: "viewer", text: "!wrongsong"},
+		testMessage{user: "viewer", text: "!skip"},
+		modMessage("!skip"),
+		modMessage("!clearqueue"),
+		testMessage{user: "viewer", text: "!queue"},
+	)
+
+	expectMessages(t, []string{
+		"@viewer added Never Gonna Give You Up to the queue at position 1",
+		"@viewer that song is banned",
+		"@other added Darude - Sandstorm to the queue at position 2",
+		"@viewer added All Star to the queue at position 3",
+		"@viewer you already have 2 songs in the queue",
+		"3 songs in the queue: 1) Never Gonna Give You Up (viewer), 2) Darude - Sandstorm (other), 3) All Star (viewer)",
+		"@viewer removed All Star from the queue",
+		"Skipped Never Gonna Give You Up, up next: Darude - Sandstorm (other)",
+		"Cleared the song queue",
+		"The song queue is empty",
+	}, client.messages)
+}
+
+func TestSongRequests_PointCost(t *testing.T) {
+	cleanUp := setUpSongRequests(t, "10")
+	defer cleanUp()
+	pointsStore = NewPointsStore()
+	defer func() {
+		pointsStore = nil
+	}()
+	pointsStore.Add("testchannel", "viewer", 15)
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!sr First"},
+		testMessage{user: "viewer", text: "!sr Second"},
+		testMessage{user: "viewer", text: "!wrongsong"},
+	)
+
+	expectMessages(t, []string{
+		"@viewer added First to the queue at position 1",
+		"@viewer song requests cost 10 points",
+		"@viewer removed First from the queue",
+	}, client.messages)
+	if balance := pointsStore.Balance("testchannel", "viewer"); balance != 15 {
+		t.Errorf("Test Failed: Expected the points to be refunded but balance was %d", balance)
+	}
+}
+
+func TestSongQueue_SaveAndLoad(t *testing.T) {
+	cleanUp := setUpSongRequests(t, "")
+	defer cleanUp()
+
+	_, _ = songQueue.Add("TestChannel", Song{Title: "Saved", User: "viewer"}, 1)
+	loaded := NewSongQueue()
+	songs := loaded.Songs("testchannel")
+	if len(songs) != 1 || songs[0].Title != "Saved" {
+		t.Errorf("Test Failed: Expected the saved song to be loaded but was %v", songs)
+	}
+}
+
+func TestSongQueue_Subscribe(t *testing.T) {
+	cleanUp := setUpSongRequests(t, "")
+	defer cleanUp()
+
+	updates, unsubscribe := songQueue.Subscribe("testchannel")
+	if songs := <-updates; len(songs) != 0 {
+		t.Errorf("Test Failed: Expected the empty queue first but was %v", songs)
+	}
+	_, _ = songQueue.Add("testchannel", Song{Title: "First", User: "viewer"}, 5)
+	_, _ = songQueue.Add("testchannel", Song{Title: "Second", User: "viewer"}, 5)
+	if songs := <-updates; len(songs) != 2 {
+		t.Errorf("Test Failed: Expected only the latest queue to be waiting but was %v", songs)
+	}
+
+	unsubscribe()
+	songQueue.Clear("testchannel")
+	select {
+	case songs := <-updates:
+		t.Errorf("Test Failed: Expected no updates after unsubscribing but got %v", songs)
+	default:
+	}
+}
+
+func TestLinkSongValidator(t *testing.T) {
+	validator := NewLinkSongValidator()
+
+	song, err := validator.Validate("https://www.youtube.com/watch?v=dQw4w9WgXcQ")
+	if err != nil || song.URL != "https://www.youtube.com/watch?v=dQw4w9WgXcQ" {
+		t.Errorf("Test Failed: Expected YouTube links to be allowed but was %v, %v", song, err)
+	}
+	_, err = validator.Validate("https://example.com/song.mp3")
+	if err == nil {
+		t.Error("Test Failed: Expected links to other sites to be rejected")
+	}
+	song, err = validator.Validate("Darude - Sandstorm")
+	if err != nil || song.Title != "Darude - Sandstorm" || song.URL != "" {
+		t.Errorf("Test Failed: Expected plain text to be allowed but was %v, %v", song, err)
+	}
+
+	validator.AllowSearch = false
+	_, err = validator.Validate("Darude - Sandstorm")
+	if err == nil {
+		t.Error("Test Failed: Expected plain text to be rejected when search is not allowed")
+	}
+}
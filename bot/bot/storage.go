@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The folder the bot stores its data in, e.g. user stats
+var dataDirectory = "data/"
+
+// How often the data that isn't written on every change, such as user stats, points and poll votes, is saved while the
+// bot runs
+const dataSaveInterval = 10 * time.Second
+
+// Saves the data that isn't written on every change, so none of it is lost when the bot stops
+func saveData() {
+	if userTracker != nil {
+		userTracker.Save()
+	}
+	if pointsStore != nil {
+		pointsStore.Save()
+	}
+	if polls != nil {
+		polls.Save()
+	}
+}
+
+// Saves the data every interval until the returned function is called, so quiet periods in chat are still saved
+func startSavingData(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				saveData()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// Returns the path of the file used to store a channel's data for a feature, e.g. data/users/mychannel.json
+func channelDataFile(feature string, channelName string) string {
+	return filepath.Join(dataDirectory, feature, strings.ToLower(channelName)+".json")
+}
+
+// Reads a JSON file into value, leaving value unchanged if the file does not exist
+func readJSONFile(filePath string, value interface{}) error {
+	fileData, err := ioutil.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fileData, value)
+}
+
+// Writes value to a JSON file, replacing the file in one step so it is never left half written
+func writeJSONFile(filePath string, value interface{}) error {
+	fileData, err := json.MarshalIndent(value, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), 0755)
+	if err != nil {
+		return err
+	}
+
+	temporaryFile := filePath + ".tmp"
+	err = ioutil.WriteFile(temporaryFile, fileData, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporaryFile, filePath)
+}
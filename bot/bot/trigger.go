@@ -0,0 +1,203 @@
+package bot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// TriggerToken lets an external tool, such as CI or a donation page, make the bot speak through the /trigger endpoint of
+// the admin API without being able to use the rest of it
+type TriggerToken struct {
+	// Used as the username of the messages the tool triggers
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// The channels the token can send to, or every channel the bot has joined if it is empty
+	Channels []string `json:"channels,omitempty"`
+	// The commands the token can invoke
+	Commands []string `json:"commands,omitempty"`
+	// Whether the token can send any message rather than only invoking commands
+	Messages bool `json:"messages,omitempty"`
+}
+
+type triggerRequest struct {
+	Channel string   `json:"channel"`
+	Message string   `json:"message,omitempty"`
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+}
+
+var triggerTokens []TriggerToken
+
+// Counts triggered messages so each one has its own message ID
+var triggerCount uint64
+
+// Loads the trigger tokens from the file, if one is given
+func initTriggerTokens(filePath string) error {
+	if filePath == "" {
+		return nil
+	}
+	fileData, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	var tokens []TriggerToken
+	err = json.Unmarshal(fileData, &tokens)
+	if err != nil {
+		return fmt.Errorf("error loading trigger tokens from %s: %w", filePath, err)
+	}
+	names := map[string]bool{}
+	for _, token := range tokens {
+		if token.Name == "" || strings.ContainsAny(token.Name, " \t") {
+			return fmt.Errorf("error loading trigger tokens from %s: every token needs a name without spaces", filePath)
+		}
+		if len(token.Token) < 16 {
+			return fmt.Errorf("error loading trigger tokens from %s: the token for %s must be at least 16 characters", filePath, token.Name)
+		}
+		if names[token.Name] {
+			return fmt.Errorf("error loading trigger tokens from %s: there is more than one token called %s", filePath, token.Name)
+		}
+		names[token.Name] = true
+	}
+	triggerTokens = tokens
+	logger.Info("Trigger tokens loaded", "file", filePath, "tokens", len(tokens))
+	return nil
+}
+
+// Returns the trigger token used by the request, if there is one
+func (s *AdminServer) findTriggerToken(request *http.Request) (TriggerToken, bool) {
+	token := strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer ")
+	for _, triggerToken := range s.triggerTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(triggerToken.Token)) == 1 {
+			return triggerToken, true
+		}
+	}
+	return TriggerToken{}, false
+}
+
+// Returns whether the token can send to the channel
+func (t TriggerToken) allowsChannel(channelName string) bool {
+	if len(t.Channels) == 0 {
+		return true
+	}
+	for _, allowed := range t.Channels {
+		if strings.EqualFold(allowed, channelName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the token can invoke the command
+func (t TriggerToken) allowsCommand(invocation string) bool {
+	for _, allowed := range t.Commands {
+		if strings.EqualFold(allowed, invocation) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handles /trigger, which sends a message or invokes a command as though the caller had typed it in chat. The admin
+// token can trigger anything, trigger tokens only what their scopes allow
+func (s *AdminServer) handleTrigger(writer http.ResponseWriter, request *http.Request, token *TriggerToken) {
+	if request.Method != http.MethodPost {
+		writeJSON(writer, http.StatusMethodNotAllowed, errorResponse{Error: "method not allowed"})
+		return
+	}
+
+	var trigger triggerRequest
+	if !decodeJSON(writer, request, &trigger) {
+		return
+	}
+	if (trigger.Message == "") == (trigger.Command == "") {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "either a message or a command is required"})
+		return
+	}
+	if trigger.Channel == "" {
+		trigger.Channel = channel
+	}
+	if token != nil && !token.allowsChannel(trigger.Channel) {
+		writeJSON(writer, http.StatusForbidden, errorResponse{Error: "this token cannot send to " + trigger.Channel})
+		return
+	}
+	if !strings.EqualFold(trigger.Channel, channel) {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "the bot has not joined " + trigger.Channel})
+		return
+	}
+
+	userName := "admin"
+	if token != nil {
+		userName = token.Name
+	}
+
+	if trigger.Message != "" {
+		if token != nil && !token.Messages {
+			writeJSON(writer, http.StatusForbidden, errorResponse{Error: "this token can only invoke commands"})
+			return
+		}
+		if strings.ContainsAny(trigger.Message, "\r\n") {
+			writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "message cannot contain new lines"})
+			return
+		}
+		logger.Info("Message triggered", "channel", trigger.Channel, "trigger", userName)
+		s.chatClient.Say(trigger.Channel, trigger.Message)
+		writer.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	invocation := trigger.Command
+	longest := ""
+	for _, value := range channelPrefixes.Prefixes(trigger.Channel) {
+		if strings.HasPrefix(invocation, value) && len(value) > len(longest) {
+			longest = value
+		}
+	}
+	invocation = strings.TrimPrefix(invocation, longest)
+	if invocation == "" || strings.ContainsAny(invocation, " \t\r\n") {
+		writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "invalid command"})
+		return
+	}
+	if token != nil && !token.allowsCommand(invocation) {
+		writeJSON(writer, http.StatusForbidden, errorResponse{Error: "this token cannot invoke " + invocation})
+		return
+	}
+	for _, arg := range trigger.Args {
+		if strings.ContainsAny(arg, "\r\n") {
+			writeJSON(writer, http.StatusBadRequest, errorResponse{Error: "args cannot contain new lines"})
+			return
+		}
+	}
+
+	id := "trigger-" + strconv.FormatUint(atomic.AddUint64(&triggerCount, 1), 10)
+	// Sent as the broadcaster, since the token's scopes have already decided what it can invoke
+	message := newChannelMessage(strings.ToLower(userName), map[string]int{"broadcaster": 1}, strings.TrimSpace(commandPrefix(trigger.Channel)+invocation+" "+strings.Join(trigger.Args, " ")), id)
+	handler := &CommandHandler{}
+	if !commandExists(handler, invocation) {
+		writeJSON(writer, http.StatusNotFound, errorResponse{Error: "command not found"})
+		return
+	}
+	logger.Info("Command triggered", "channel", trigger.Channel, "trigger", userName, "command", invocation)
+	if !handleBuiltInCommand(handler, s.chatClient, message, invocation) {
+		runFileCommands(handler, s.chatClient, message, invocation)
+	}
+	writer.WriteHeader(http.StatusAccepted)
+}
+
+// Returns whether a built-in or loaded command is invoked by the command string
+func commandExists(handler CommandProcessor, commandString string) bool {
+	if hasBuiltInCommand(strings.ToLower(commandString)) {
+		return true
+	}
+	for _, command := range invokableCommands() {
+		if !command.Disabled && handler.HasCommandBeenInvoked(command, commandString) {
+			return true
+		}
+	}
+	return false
+}
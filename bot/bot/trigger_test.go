@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Sets up an admin server with a trigger token for CI, which can invoke !deploy, and a donation page, which can send any
+// message to testchannel
+func setUpTrigger(t *testing.T) (*AdminServer, *RecordingChatClient, func()) {
+	server, recorder, cleanUp := setUpAdminServer(t)
+	prefix = "!"
+	builtInCommands = nil
+	cooldowns = NewCooldownTracker()
+	server.triggerTokens = []TriggerToken{
+		{Name: "CI", Token: "ci-token-0123456789", Commands: []string{"deploy"}},
+		{Name: "donations", Token: "donation-token-0123456789", Channels: []string{"testchannel"}, Messages: true},
+	}
+	InvokableCommandList = []InvokableCommand{{
+		Invocation: "deploy",
+		Parameters: []CommandParameter{{Name: "version"}},
+		Message:    "$username deployed $version",
+		ModOnly:    true,
+	}, {
+		Invocation: "hello",
+		Message:    "Hello!",
+	}}
+	return server, recorder, func() {
+		builtInCommands = nil
+		cleanUp()
+	}
+}
+
+func postTrigger(server *AdminServer, token string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/trigger", strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer "+token)
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	return response
+}
+
+func TestTrigger_Command(t *testing.T) {
+	server, recorder, cleanUp := setUpTrigger(t)
+	defer cleanUp()
+
+	response := postTrigger(server, "ci-token-0123456789", `{"channel": "testchannel", "command": "deploy", "args": ["v1.2"]}`)
+	if response.Code != http.StatusAccepted {
+		t.Errorf("Test Failed: Expected 202 but was %d: %s", response.Code, response.Body.String())
+	}
+	expectMessages(t, []string{"ci deployed v1.2"}, recorder.Messages)
+
+	for body, status := range map[string]int{
+		`{"command": "hello"}`:                             http.StatusForbidden,
+		`{"message": "hi"}`:                                http.StatusForbidden,
+		`{"command": "deploy"}`:                            http.StatusAccepted,
+		`{"command": "deploy", "message": "hi"}`:           http.StatusBadRequest,
+		`{"channel": "otherchannel", "command": "deploy"}`: http.StatusBadRequest,
+	} {
+		response = postTrigger(server, "ci-token-0123456789", body)
+		if response.Code != status {
+			t.Errorf("Test Failed: Expected %d for %s but was %d", status, body, response.Code)
+		}
+	}
+	expectMessages(t, []string{"ci deployed v1.2", "Invalid usage of command"}, recorder.Messages)
+}
+
+func TestTrigger_Message(t *testing.T) {
+	server, recorder, cleanUp := setUpTrigger(t)
+	defer cleanUp()
+
+	response := postTrigger(server, "donation-token-0123456789", `{"message": "Thanks for the $5 donation!"}`)
+	if response.Code != http.StatusAccepted {
+		t.Errorf("Test Failed: Expected 202 but was %d: %s", response.Code, response.Body.String())
+	}
+	if response = postTrigger(server, "donation-token-0123456789", `{"command": "hello"}`); response.Code != http.StatusForbidden {
+		t.Errorf("Test Failed: Expected the donation token not to invoke commands but got %d", response.Code)
+	}
+	response = postTrigger(server, "donation-token-0123456789", `{"message": "hi\r\nJOIN #other\r\nPRIVMSG #other :spam"}`)
+	if response.Code != http.StatusBadRequest {
+		t.Errorf("Test Failed: Expected a message with new lines to be rejected but got %d", response.Code)
+	}
+	expectMessages(t, []string{"Thanks for the $5 donation!"}, recorder.Messages)
+}
+
+func TestTrigger_ChannelPrefixes(t *testing.T) {
+	server, recorder, cleanUp := setUpTrigger(t)
+	defer cleanUp()
+	dataDirectory = commandsDirectory
+	channelPrefixes = NewPrefixStore()
+	defer func() {
+		dataDirectory = "data/"
+		channelPrefixes = NewPrefixStore()
+	}()
+	err := channelPrefixes.Set("testchannel", []string{"?"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := postTrigger(server, "ci-token-0123456789", `{"command": "?deploy", "args": ["v2"]}`)
+	if response.Code != http.StatusAccepted {
+		t.Errorf("Test Failed: Expected 202 but was %d: %s", response.Code, response.Body.String())
+	}
+	expectMessages(t, []string{"ci deployed v2"}, recorder.Messages)
+}
+
+func TestTrigger_Tokens(t *testing.T) {
+	server, recorder, cleanUp := setUpTrigger(t)
+	defer cleanUp()
+	RegisterCommand("ping", func(context *CommandContext) {
+		context.Reply("pong")
+	})
+
+	if response := adminRequest(server, http.MethodPost, "/trigger", `{"command": "ping"}`); response.Code != http.StatusAccepted {
+		t.Errorf("Test Failed: Expected the admin token to trigger any command but got %d", response.Code)
+	}
+	if response := adminRequest(server, http.MethodPost, "/trigger", `{"command": "missing"}`); response.Code != http.StatusNotFound {
+		t.Errorf("Test Failed: Expected 404 for a missing command but got %d", response.Code)
+	}
+	expectMessages(t, []string{"@admin pong"}, recorder.Messages)
+
+	request := httptest.NewRequest(http.MethodGet, "/commands", nil)
+	request.Header.Set("Authorization", "Bearer ci-token-0123456789")
+	response := httptest.NewRecorder()
+	server.ServeHTTP(response, request)
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Test Failed: Expected trigger tokens not to be able to use the rest of the admin API but got %d", response.Code)
+	}
+
+	server.token = ""
+	if response := postTrigger(server, "", `{"message": "hi"}`); response.Code != http.StatusUnauthorized {
+		t.Errorf("Test Failed: Expected an empty token to be rejected but got %d", response.Code)
+	}
+}
+
+func TestInitTriggerTokens(t *testing.T) {
+	cleanUp := setUpScripts(t)
+	defer cleanUp()
+	defer func() { triggerTokens = nil }()
+
+	filePath := filepath.Join(dataDirectory, "tokens.json")
+	for _, invalid := range []string{
+		`[{"name": "ci", "token": "short"}]`,
+		`[{"token": "ci-token-0123456789"}]`,
+		`[{"name": "ci", "token": "ci-token-0123456789"}, {"name": "ci", "token": "ci-token-9876543210"}]`,
+	} {
+		_ = ioutil.WriteFile(filePath, []byte(invalid), 0644)
+		if initTriggerTokens(filePath) == nil {
+			t.Errorf("Test Failed: Expected an error loading %s", invalid)
+		}
+	}
+
+	_ = ioutil.WriteFile(filePath, []byte(`[{"name": "ci", "token": "ci-token-0123456789", "commands": ["deploy"]}]`), 0644)
+	if err := initTriggerTokens(filePath); err != nil || len(triggerTokens) != 1 || !triggerTokens[0].allowsCommand("Deploy") {
+		t.Errorf("Test Failed: Expected the trigger token to load but got %v", err)
+	}
+}
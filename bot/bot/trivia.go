@@ -0,0 +1,458 @@
+package bot
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultTriviaDirectory    = "trivia/"
+	defaultTriviaQuestionTime = 60 * time.Second
+	triviaHints               = 2
+	triviaTopScores           = 5
+)
+
+// Points awarded for a correct answer to a question of each difficulty
+var triviaDifficultyPoints = map[string]int64{"easy": 10, "medium": 20, "hard": 30}
+
+// TriviaQuestion is a question from a question bank file in the trivia folder
+type TriviaQuestion struct {
+	Category   string   `json:"category"`
+	Question   string   `json:"question"`
+	Answer     string   `json:"answer"`
+	Alternates []string `json:"alternates,omitempty"`
+	Difficulty string   `json:"difficulty,omitempty"`
+}
+
+// Points returns the number of points a correct answer to the question is worth
+func (q TriviaQuestion) Points() int64 {
+	if points, ok := triviaDifficultyPoints[q.Difficulty]; ok {
+		return points
+	}
+	return triviaDifficultyPoints["medium"]
+}
+
+// TriviaScore is the number of questions a user has answered correctly and the points they have won from trivia
+type TriviaScore struct {
+	Correct int   `json:"correct"`
+	Points  int64 `json:"points"`
+}
+
+// A question waiting to be answered in a channel
+type triviaRound struct {
+	question TriviaQuestion
+	hints    int
+	timers   []*time.Timer
+}
+
+// TriviaGame asks questions from the question banks and watches chat for the answers, at most one question per channel
+// at a time
+type TriviaGame struct {
+	mutex        sync.Mutex
+	questions    []TriviaQuestion
+	questionTime time.Duration
+	random       *rand.Rand
+	rounds       map[string]*triviaRound
+	scores       map[string]map[string]TriviaScore
+}
+
+var trivia *TriviaGame
+
+// NewTriviaGame creates a TriviaGame that gives users questionTime to answer each question
+func NewTriviaGame(questions []TriviaQuestion, questionTime time.Duration, random *rand.Rand) *TriviaGame {
+	return &TriviaGame{
+		questions:    questions,
+		questionTime: questionTime,
+		random:       random,
+		rounds:       map[string]*triviaRound{},
+		scores:       map[string]map[string]TriviaScore{},
+	}
+}
+
+// Sets up trivia with the question banks in the directory, giving users questionTime seconds to answer each question
+func initTrivia(directory string, questionTime string) error {
+	if directory == "" {
+		directory = defaultTriviaDirectory
+	}
+	questionDuration := defaultTriviaQuestionTime
+	if questionTime != "" {
+		seconds, err := strconv.Atoi(questionTime)
+		if err != nil || seconds < 1 {
+			return errors.New("TRIVIA_QUESTION_SECONDS must be a positive number of seconds")
+		}
+		questionDuration = time.Duration(seconds) * time.Second
+	}
+
+	questions, err := LoadTriviaQuestions(directory)
+	if err != nil {
+		return err
+	}
+	logger.Info("Trivia questions loaded", "directory", directory, "questions", len(questions))
+
+	trivia = NewTriviaGame(questions, questionDuration, rand.New(rand.NewSource(time.Now().UnixNano())))
+	registerMessageListener(trivia.handleMessage)
+	registerBuiltInCommand(builtInCommand{invocation: "trivia", handler: trivia.triviaCommand})
+	return nil
+}
+
+// LoadTriviaQuestions loads every question from the JSON and CSV files in the directory, returning no questions if the
+// directory does not exist
+func LoadTriviaQuestions(directory string) ([]TriviaQuestion, error) {
+	files, err := ioutil.ReadDir(directory)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var questions []TriviaQuestion
+	for _, file := range files {
+		filePath := filepath.Join(directory, file.Name())
+		var loaded []TriviaQuestion
+		switch strings.ToLower(filepath.Ext(file.Name())) {
+		case ".json":
+			loaded, err = loadTriviaJSON(filePath)
+		case ".csv":
+			loaded, err = loadTriviaCSV(filePath)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error loading trivia file %s: %w", filePath, err)
+		}
+
+		defaultCategory := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		for _, question := range loaded {
+			if question.Question == "" || question.Answer == "" {
+				return nil, fmt.Errorf("error loading trivia file %s: every question needs a question and an answer", filePath)
+			}
+			if question.Category == "" {
+				question.Category = defaultCategory
+			}
+			question.Category = strings.ToLower(question.Category)
+			question.Difficulty = strings.ToLower(question.Difficulty)
+			questions = append(questions, question)
+		}
+	}
+	return questions, nil
+}
+
+func loadTriviaJSON(filePath string) ([]TriviaQuestion, error) {
+	fileData, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var questions []TriviaQuestion
+	err = json.Unmarshal(fileData, &questions)
+	return questions, err
+}
+
+// Loads a CSV file with the header category,question,answer,alternates,difficulty where alternates are separated by |
+func loadTriviaCSV(filePath string) ([]TriviaQuestion, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var questions []TriviaQuestion
+	for _, record := range records[1:] {
+		question := TriviaQuestion{
+			Category:   field(record, "category"),
+			Question:   field(record, "question"),
+			Answer:     field(record, "answer"),
+			Difficulty: field(record, "difficulty"),
+		}
+		for _, alternate := range strings.Split(field(record, "alternates"), "|") {
+			if alternate = strings.TrimSpace(alternate); alternate != "" {
+				question.Alternates = append(question.Alternates, alternate)
+			}
+		}
+		questions = append(questions, question)
+	}
+	return questions, nil
+}
+
+// !trivia [category], !trivia categories, !trivia scores, !trivia stop
+func (g *TriviaGame) triviaCommand(client ChatClient, message ChatMessage, arguments []string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	category := ""
+	if len(arguments) > 0 {
+		category = arguments[0]
+	}
+
+	switch category {
+	case "categories":
+		client.Say(message.Channel, "Trivia categories: "+strings.Join(g.categories(), ", "))
+	case "scores", "top":
+		client.Say(message.Channel, g.topScores(message.Channel))
+	case "stop", "skip":
+		round, running := g.rounds[strings.ToLower(message.Channel)]
+		if !running || !isModerator(message) {
+			return
+		}
+		g.endRound(message.Channel, round)
+		client.Say(message.Channel, "Trivia stopped, the answer was "+round.question.Answer)
+	default:
+		g.ask(client, message.Channel, category)
+	}
+}
+
+// Returns the categories of the loaded questions in alphabetical order
+func (g *TriviaGame) categories() []string {
+	found := map[string]bool{}
+	var categories []string
+	for _, question := range g.questions {
+		if !found[question.Category] {
+			found[question.Category] = true
+			categories = append(categories, question.Category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// Asks a random question from the category, or from any category if it is empty
+func (g *TriviaGame) ask(client ChatClient, channelName string, category string) {
+	key := strings.ToLower(channelName)
+	if round, running := g.rounds[key]; running {
+		client.Say(channelName, "Trivia: "+round.question.Question)
+		return
+	}
+
+	var candidates []TriviaQuestion
+	for _, question := range g.questions {
+		if category == "" || question.Category == category {
+			candidates = append(candidates, question)
+		}
+	}
+	if len(candidates) == 0 {
+		if category == "" {
+			client.Say(channelName, "There are no trivia questions")
+		} else {
+			client.Say(channelName, "There are no trivia questions in the category "+category)
+		}
+		return
+	}
+
+	round := &triviaRound{question: candidates[g.random.Intn(len(candidates))]}
+	g.rounds[key] = round
+
+	// Hints are given evenly through the time allowed to answer, then the answer is revealed
+	step := g.questionTime / (triviaHints + 1)
+	for i := 1; i <= triviaHints; i++ {
+		round.timers = append(round.timers, time.AfterFunc(time.Duration(i)*step, func() {
+			g.giveHint(client, channelName, round)
+		}))
+	}
+	round.timers = append(round.timers, time.AfterFunc(g.questionTime, func() {
+		g.mutex.Lock()
+		defer g.mutex.Unlock()
+		if g.rounds[key] == round {
+			g.endRound(channelName, round)
+			client.Say(channelName, "Time's up! The answer was "+round.question.Answer)
+		}
+	}))
+
+	client.Say(channelName, fmt.Sprintf("Trivia (%s, %d points): %s", round.question.Category, round.question.Points(), round.question.Question))
+}
+
+// Sends the next hint for the question if it has not been answered yet
+func (g *TriviaGame) giveHint(client ChatClient, channelName string, round *triviaRound) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.rounds[strings.ToLower(channelName)] != round {
+		return
+	}
+	round.hints++
+	client.Say(channelName, "Hint: "+triviaHint(round.question.Answer, round.hints))
+}
+
+// Stops the round's timers and removes it from the channel
+func (g *TriviaGame) endRound(channelName string, round *triviaRound) {
+	for _, timer := range round.timers {
+		timer.Stop()
+	}
+	delete(g.rounds, strings.ToLower(channelName))
+}
+
+// Checks every message in a channel with a question waiting to be answered for the answer
+func (g *TriviaGame) handleMessage(client ChatClient, message ChatMessage) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	round, running := g.rounds[strings.ToLower(message.Channel)]
+	if !running || message.User.Name == nickname || !isTriviaAnswer(round.question, message.Message) {
+		return
+	}
+
+	g.endRound(message.Channel, round)
+	points := round.question.Points()
+	if pointsStore != nil {
+		pointsStore.Add(message.Channel, message.User.Name, points)
+	}
+	score := g.addScore(message.Channel, message.User.Name, points)
+	client.Say(message.Channel, fmt.Sprintf("%s got it! The answer was %s. +%d points (%d correct)", message.User.DisplayName, round.question.Answer, points, score.Correct))
+}
+
+// Returns the trivia scores of a channel, loading them from disk the first time the channel is used
+func (g *TriviaGame) channelScores(channelName string) map[string]TriviaScore {
+	channelName = strings.ToLower(channelName)
+	scores, ok := g.scores[channelName]
+	if !ok {
+		scores = map[string]TriviaScore{}
+		err := readJSONFile(channelDataFile("trivia", channelName), &scores)
+		if err != nil {
+			logger.Error("Error loading trivia scores", "channel", channelName, "error", err)
+		}
+		g.scores[channelName] = scores
+	}
+	return scores
+}
+
+// Adds a correct answer to the user's score and saves the channel's scores
+func (g *TriviaGame) addScore(channelName string, user string, points int64) TriviaScore {
+	scores := g.channelScores(channelName)
+	user = strings.ToLower(user)
+	score := scores[user]
+	score.Correct++
+	score.Points += points
+	scores[user] = score
+
+	err := writeJSONFile(channelDataFile("trivia", channelName), scores)
+	if err != nil {
+		logger.Error("Error saving trivia scores", "channel", channelName, "error", err)
+	}
+	return score
+}
+
+// Formats the users with the most correct answers in the channel
+func (g *TriviaGame) topScores(channelName string) string {
+	scores := g.channelScores(channelName)
+	if len(scores) == 0 {
+		return "Nobody has answered a trivia question yet"
+	}
+
+	users := make([]string, 0, len(scores))
+	for user := range scores {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if scores[users[i]].Correct != scores[users[j]].Correct {
+			return scores[users[i]].Correct > scores[users[j]].Correct
+		}
+		return users[i] < users[j]
+	})
+	if len(users) > triviaTopScores {
+		users = users[:triviaTopScores]
+	}
+
+	top := make([]string, len(users))
+	for i, user := range users {
+		top[i] = fmt.Sprintf("%d) %s: %d", i+1, user, scores[user].Correct)
+	}
+	return "Trivia top scores: " + strings.Join(top, ", ")
+}
+
+// Returns whether the guess is close enough to the answer or one of its alternates
+func isTriviaAnswer(question TriviaQuestion, guess string) bool {
+	guess = normaliseTriviaText(guess)
+	if guess == "" {
+		return false
+	}
+	for _, answer := range append([]string{question.Answer}, question.Alternates...) {
+		answer = normaliseTriviaText(answer)
+		// Short answers must be exact, longer answers can have a typo for every 5 characters
+		allowedTypos := len([]rune(answer)) / 5
+		if levenshteinDistance(guess, answer) <= allowedTypos {
+			return true
+		}
+	}
+	return false
+}
+
+// Lowercases the text and removes punctuation, extra spaces and leading articles
+func normaliseTriviaText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsSpace(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, text)
+	words := strings.Fields(text)
+	if len(words) > 1 && (words[0] == "the" || words[0] == "a" || words[0] == "an") {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// Returns the number of single character insertions, deletions or substitutions needed to turn one string into another
+func levenshteinDistance(first string, second string) int {
+	a, b := []rune(first), []rune(second)
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Hides the letters of the answer, revealing more of them for each hint, e.g. "G___" then "G_a_"
+func triviaHint(answer string, hint int) string {
+	runes := []rune(answer)
+	letter := 0
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) {
+			continue
+		}
+		if letter > 0 && (hint < 2 || letter%3 != 2) {
+			runes[i] = '_'
+		}
+		letter++
+	}
+	return string(runes)
+}
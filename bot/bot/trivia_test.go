@@ -0,0 +1,160 @@
+package bot
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testTriviaQuestions = []TriviaQuestion{
+	{Category: "goats", Question: "What is a baby goat called?", Answer: "Kid", Difficulty: "easy"},
+	{Category: "music", Question: "Which band released the album Abbey Road?", Answer: "The Beatles", Alternates: []string{"Fab Four"}, Difficulty: "hard"},
+}
+
+// Sets up an empty data folder and a trivia game with the given questions
+func setUpTrivia(t *testing.T, questions []TriviaQuestion, questionTime time.Duration) func() {
+	cleanUpPoints := setUpPoints(t)
+	pointsPerMessage = 0
+	trivia = NewTriviaGame(questions, questionTime, rand.New(rand.NewSource(1)))
+	registerMessageListener(trivia.handleMessage)
+	registerBuiltInCommand(builtInCommand{invocation: "trivia", handler: trivia.triviaCommand})
+	return func() {
+		trivia = nil
+		pointsPerMessage = 1
+		cleanUpPoints()
+	}
+}
+
+func TestLoadTriviaQuestions(t *testing.T) {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(directory)
+
+	_ = ioutil.WriteFile(filepath.Join(directory, "goats.json"), []byte(`[{"question": "Baby goat?", "answer": "Kid"}]`), 0644)
+	_ = ioutil.WriteFile(filepath.Join(directory, "general.csv"), []byte("category,question,answer,alternates,difficulty\nMusic,Abbey Road?,The Beatles,Beatles|Fab Four,Hard\n"), 0644)
+	_ = ioutil.WriteFile(filepath.Join(directory, "notes.txt"), []byte("not a question bank"), 0644)
+
+	questions, err := LoadTriviaQuestions(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(questions) != 2 {
+		t.Fatalf("Test Failed: Expected 2 questions but was %v", questions)
+	}
+	music := questions[0]
+	if music.Category != "music" || music.Answer != "The Beatles" || len(music.Alternates) != 2 || music.Difficulty != "hard" {
+		t.Errorf("Test Failed: Expected the CSV question to be loaded but was %+v", music)
+	}
+	if questions[1].Category != "goats" {
+		t.Errorf("Test Failed: Expected the category to default to the file name but was '%s'", questions[1].Category)
+	}
+
+	_ = ioutil.WriteFile(filepath.Join(directory, "broken.json"), []byte(`[{"question": "No answer?"}]`), 0644)
+	if _, err := LoadTriviaQuestions(directory); err == nil {
+		t.Error("Test Failed: Expected an error for a question without an answer")
+	}
+	if questions, err := LoadTriviaQuestions(filepath.Join(directory, "missing")); err != nil || questions != nil {
+		t.Errorf("Test Failed: Expected no questions and no error for a missing folder but was %v, %v", questions, err)
+	}
+}
+
+func TestIsTriviaAnswer(t *testing.T) {
+	question := testTriviaQuestions[1]
+	cases := map[string]bool{
+		"the beatles":        true,
+		"Beatles!":           true,
+		"beetles":            true,
+		"fab four":           true,
+		"the rolling stones": false,
+		"":                   false,
+	}
+	for guess, expected := range cases {
+		if isTriviaAnswer(question, guess) != expected {
+			t.Errorf("Test Failed: Expected '%s' to be %v", guess, expected)
+		}
+	}
+	if isTriviaAnswer(testTriviaQuestions[0], "kit") {
+		t.Error("Test Failed: Expected short answers to need to be exact")
+	}
+}
+
+func TestTriviaHint(t *testing.T) {
+	if hint := triviaHint("The Beatles", 1); hint != "T__ _______" {
+		t.Errorf("Test Failed: Expected the first hint to only show the first letter but was '%s'", hint)
+	}
+	if hint := triviaHint("The Beatles", 2); hint != "T_e __a__e_" {
+		t.Errorf("Test Failed: Expected the second hint to show more letters but was '%s'", hint)
+	}
+}
+
+func TestTrivia_AnswerAndScores(t *testing.T) {
+	cleanUp := setUpTrivia(t, testTriviaQuestions, time.Hour)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!trivia music"},
+		testMessage{user: "viewer", text: "the rolling stones"},
+		testMessage{user: "other", text: "beatles"},
+		testMessage{user: "viewer", text: "beatles"},
+		testMessage{user: "viewer", text: "!trivia scores"},
+		testMessage{user: "viewer", text: "!trivia history"},
+	)
+
+	expectMessages(t, []string{
+		"Trivia (music, 30 points): Which band released the album Abbey Road?",
+		"other got it! The answer was The Beatles. +30 points (1 correct)",
+		"Trivia top scores: 1) other: 1",
+		"There are no trivia questions in the category history",
+	}, client.messages)
+	if balance := pointsStore.Balance("testchannel", "other"); balance != 30 {
+		t.Errorf("Test Failed: Expected other to win 30 points but balance was %d", balance)
+	}
+
+	loaded := NewTriviaGame(nil, time.Hour, rand.New(rand.NewSource(1)))
+	if score := loaded.channelScores("testchannel")["other"]; score.Correct != 1 || score.Points != 30 {
+		t.Errorf("Test Failed: Expected the score to be saved but was %+v", score)
+	}
+}
+
+func TestTrivia_HintsAndTimeout(t *testing.T) {
+	cleanUp := setUpTrivia(t, testTriviaQuestions[1:], 30*time.Millisecond)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client, testMessage{user: "viewer", text: "!trivia"})
+	deadline := time.Now().Add(time.Second)
+	for client.count() < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	expectMessages(t, []string{
+		"Trivia (music, 30 points): Which band released the album Abbey Road?",
+		"Hint: T__ _______",
+		"Hint: T_e __a__e_",
+		"Time's up! The answer was The Beatles",
+	}, client.messages)
+}
+
+func TestTrivia_Stop(t *testing.T) {
+	cleanUp := setUpTrivia(t, testTriviaQuestions[:1], time.Hour)
+	defer cleanUp()
+
+	client := &syncRecordingChatClient{}
+	sendMessages(client,
+		testMessage{user: "viewer", text: "!trivia"},
+		testMessage{user: "viewer", text: "!trivia stop"},
+		modMessage("!trivia stop"),
+		testMessage{user: "viewer", text: "kid"},
+	)
+
+	expectMessages(t, []string{
+		"Trivia (goats, 10 points): What is a baby goat called?",
+		"Trivia stopped, the answer was Kid",
+	}, client.messages)
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"github.com/gempir/go-twitch-irc/v2"
+)
+
+// TwitchBackend connects the bot to Twitch chat
+type TwitchBackend struct {
+	client *twitch.Client
+}
+
+// NewTwitchBackend creates a TwitchBackend that logs in with the OAuth token, connecting without TLS to IRC_ADDRESS
+// instead of Twitch if it is set
+func NewTwitchBackend(oauth string) *TwitchBackend {
+	client := twitch.NewClient(nickname, oauth)
+	if ircAddress != "" {
+		client.IrcAddress = ircAddress
+		client.TLS = false
+	}
+	return &TwitchBackend{client: client}
+}
+
+// Say sends a message to the channel
+func (b *TwitchBackend) Say(channelName string, text string) {
+	b.client.Say(channelName, stripNewLines(text))
+}
+
+// Connect joins the channel and handles its messages and events, blocking until the client disconnects
+func (b *TwitchBackend) Connect(channelName string, handler func(message ChatMessage)) error {
+	b.client.OnConnect(func() {
+		metrics.Connected()
+		logger.Info("Connected", "channel", channelName)
+	})
+
+	b.client.OnReconnectMessage(func(message twitch.ReconnectMessage) {
+		metrics.Disconnected()
+		logger.Warn("Twitch requested a reconnect, reconnecting...")
+		sendEvent(WebhookDisconnected, channelName, map[string]interface{}{"reason": "reconnect requested"})
+	})
+
+	b.client.OnClearChatMessage(onClearChat)
+	b.client.OnClearMessage(onClearMessage)
+	b.client.OnUserNoticeMessage(onUserNotice)
+
+	b.client.OnPrivateMessage(func(message twitch.PrivateMessage) {
+		handler(fromTwitchMessage(message))
+	})
+
+	b.client.Join(channelName)
+	return b.client.Connect()
+}
+
+// Disconnect closes the connection to Twitch
+func (b *TwitchBackend) Disconnect() error {
+	return b.client.Disconnect()
+}
+
+func fromTwitchMessage(message twitch.PrivateMessage) ChatMessage {
+	return ChatMessage{
+		ID:      message.ID,
+		Channel: message.Channel,
+		User: ChatUser{
+			Name:        message.User.Name,
+			DisplayName: message.User.DisplayName,
+			Badges:      message.User.Badges,
+		},
+		Message: message.Message,
+		Time:    message.Time,
+		ReplyTo: message.Tags["reply-parent-user-login"],
+	}
+}
@@ -2,13 +2,36 @@ package bot
 
 import (
 	"errors"
-	"github.com/gempir/go-twitch-irc/v2"
-	"log"
 	"os"
-	"strings"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-var prefix, channel, nickname string
+const (
+	defaultRateLimit  = 20
+	rateLimitPeriod   = 30 * time.Second
+	outgoingQueueSize = 50
+)
+
+var prefix, channel, nickname, ircAddress string
+var rateLimit = defaultRateLimit
+
+// The http and exec commands running in the background, which tests and `goatbot test` wait for
+var backgroundCommands sync.WaitGroup
+
+// The most http and exec commands that can run in the background at once, each. Commands invoked while every slot is
+// taken are dropped, so chat can't start any number of requests or processes
+var backgroundCommandSlots = map[string]chan struct{}{
+	commandTypeHTTP: make(chan struct{}, 8),
+	commandTypeExec: make(chan struct{}, 4),
+}
+
+// How long the bot waits for http and exec commands to reply when it stops, which is as long as an exec command can run
+const backgroundCommandsStopTimeout = maximumExecTimeout
 
 type ChatClient interface {
 	Say(channel, text string)
@@ -16,87 +39,285 @@ type ChatClient interface {
 
 // Init initializes variables for the bot and loads the commands
 func Init() {
-	log.Println("Setting up bot...")
-	prefix = os.Getenv("PREFIX")
+	logger.Info("Setting up bot...")
+	err := initSettings()
+	if err != nil {
+		panic(err)
+	}
+	if directory := os.Getenv("DATA_DIRECTORY"); directory != "" {
+		dataDirectory = directory
+	}
+	err = initBuiltInCommands()
+	if err != nil {
+		panic(err)
+	}
+
+	err = initChatArchive(os.Getenv("CHAT_LOG_DIRECTORY"), os.Getenv("CHAT_LOG_RETENTION_DAYS"))
+	if err != nil {
+		panic(err)
+	}
+	err = initWebhooks(os.Getenv("WEBHOOKS_FILE"))
+	if err != nil {
+		panic(err)
+	}
+	err = initTriggerTokens(os.Getenv("TRIGGER_TOKENS_FILE"))
+	if err != nil {
+		panic(err)
+	}
+	err = initDiscordBridge(os.Getenv("DISCORD_WEBHOOK_URL"), os.Getenv("DISCORD_BOT_TOKEN"), os.Getenv("DISCORD_CHANNEL_ID"),
+		os.Getenv("DISCORD_RELAY"), os.Getenv("DISCORD_RELAY_PREFIX"))
+	if err != nil {
+		panic(err)
+	}
+
+	LoadCommands()
+}
+
+// Reads the prefix, channel, name and rate limit the bot needs to handle messages
+func initSettings() error {
+	setPrefixes(os.Getenv("PREFIX"))
 	channel = os.Getenv("CHANNEL")
 	nickname = os.Getenv("NAME")
 
 	if prefix == "" {
-		panic(errors.New("no PREFIX defined"))
+		return errors.New("no PREFIX defined")
 	}
 	if channel == "" {
-		panic(errors.New("no CHANNEL defined"))
+		return errors.New("no CHANNEL defined")
 	}
 	if nickname == "" {
-		panic(errors.New("no NAME defined"))
+		return errors.New("no NAME defined")
 	}
 
-	LoadCommands()
+	// Optional, used to connect to a local IRC server instead of Twitch
+	ircAddress = os.Getenv("IRC_ADDRESS")
+
+	if limit := os.Getenv("RATE_LIMIT"); limit != "" {
+		var err error
+		rateLimit, err = strconv.Atoi(limit)
+		if err != nil || rateLimit < 1 {
+			return errors.New("RATE_LIMIT must be a positive number")
+		}
+	}
+	return nil
+}
+
+// Sets up user stats, the features turned on with FEATURES and exec commands, which only keep their data in the data
+// folder
+func initBuiltInCommands() error {
+	features, err := parseFeatures(os.Getenv("FEATURES"))
+	if err != nil {
+		return err
+	}
+
+	userTracker = NewUserTracker()
+	if features["seen"] {
+		registerBuiltInCommand(builtInCommand{invocation: "seen", handler: seenCommand})
+		registerBuiltInCommand(builtInCommand{invocation: "lastseen", handler: lastSeenCommand})
+	}
+	registerBuiltInCommand(builtInCommand{invocation: "prefix", modOnly: true, handler: prefixCommand})
+
+	if features["points"] {
+		err = initPoints(os.Getenv("POINTS_PER_MESSAGE"))
+		if err != nil {
+			return err
+		}
+	}
+	if features["giveaways"] {
+		err = initGiveaways(os.Getenv("GIVEAWAY_CLAIM_SECONDS"))
+		if err != nil {
+			return err
+		}
+	}
+	if features["polls"] {
+		initPolls()
+	}
+	if features["games"] {
+		initGames()
+	}
+	if features["trivia"] {
+		err = initTrivia(os.Getenv("TRIVIA_DIRECTORY"), os.Getenv("TRIVIA_QUESTION_SECONDS"))
+		if err != nil {
+			return err
+		}
+	}
+	if features["songs"] {
+		err = initSongRequests(os.Getenv("SONG_REQUEST_LIMIT"), os.Getenv("SONG_REQUEST_COST"))
+		if err != nil {
+			return err
+		}
+		if songRequestCost > 0 && pointsStore == nil {
+			return errors.New("SONG_REQUEST_COST needs the points feature to be turned on")
+		}
+	}
+	return initExecCommands(os.Getenv("EXEC_DIRECTORY"))
 }
 
 // Start starts the bot
 func Start() {
-	log.Println("Starting bot...")
-	oauth := os.Getenv("SECRET")
+	logger.Info("Starting bot...")
+	backend, err := newBackend(os.Getenv("BACKEND"), os.Getenv("SECRET"))
+	if err != nil {
+		panic(err)
+	}
 
-	if oauth == "" {
-		panic(errors.New("no SECRET given in .env"))
+	chatClient := NewRateLimitedChatClient(backend, rateLimit, rateLimitPeriod, outgoingQueueSize)
+	go chatClient.Run()
+	startAdminServer(os.Getenv("ADMIN_ADDRESS"), os.Getenv("ADMIN_TOKEN"), chatClient)
+	startMetricsServer(os.Getenv("METRICS_ADDRESS"), chatClient)
+	if polls != nil {
+		polls.Resume(chatClient, channel)
+	}
+	if discordBridge != nil {
+		discordBridge.Start(chatClient, channel)
 	}
 
-	client := twitch.NewClient(nickname, oauth)
-	commandHandler := CommandHandler{}
+	stopSaving := startSavingData(dataSaveInterval)
+	var stopping atomic.Bool
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		logger.Info("Stopping bot...")
+		stopping.Store(true)
+		_ = backend.Disconnect()
+	}()
 
-	client.OnConnect(func() {
-		log.Println("Connected to " + channel)
-	})
+	logger.Info("Connecting...", "channel", channel)
+	err = connect(backend, chatClient)
+	waitForBackgroundCommands(backgroundCommandsStopTimeout)
+	stopSaving()
+	saveData()
+	if webhooks != nil {
+		webhooks.WaitTimeout(webhookStopTimeout)
+	}
+	if err != nil && !stopping.Load() {
+		panic(err)
+	}
+}
 
-	client.OnPrivateMessage(func(message twitch.PrivateMessage) {
-		onMessage(&commandHandler, client, message)
+// Connects the backend to the channel, handling each message with the command handler and responding through the chat
+// client, and blocks until it disconnects
+func connect(backend Backend, chatClient ChatClient) error {
+	commandHandler := CommandHandler{}
+	err := backend.Connect(channel, func(message ChatMessage) {
+		onMessage(&commandHandler, chatClient, message)
 	})
 
-	client.Join(channel)
-
-	log.Printf("Connecting to #%s...\n", channel)
-	err := client.Connect()
+	metrics.Disconnected()
+	reason := "disconnected"
 	if err != nil {
-		panic(err)
+		reason = err.Error()
 	}
+	sendEvent(WebhookDisconnected, channel, map[string]interface{}{"reason": reason})
+	return err
 }
 
-// TODO test
 // Handle message event
-func onMessage(handler CommandProcessor, client ChatClient, message twitch.PrivateMessage) {
-	handler.IncrementMessageCount(message)
-	handler.HandleIntervalMessage(client)
+func onMessage(handler CommandProcessor, client ChatClient, message ChatMessage) {
+	middlewareMutex.RLock()
+	chain := append([]namedMiddleware(nil), middlewareChain...)
+	middlewareMutex.RUnlock()
 
-	if prefix == "" {
-		log.Fatalf("No prefix defined")
+	runMiddleware(chain, &MessageContext{Message: message, Client: client, Handler: handler})
+}
+
+// Waits for the http and exec commands running in the background to reply, giving up after the timeout
+func waitForBackgroundCommands(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		backgroundCommands.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		logger.Warn("Stopped waiting for http and exec commands to finish", "timeout", timeout.String())
 	}
+}
 
-	if strings.HasPrefix(message.Message, prefix) {
-		err, commandString := handler.GetCommandStringFromMessage(message)
-		if err != nil {
-			log.Println("Error parsing command from message: " + err.Error())
-		} else {
-			for _, command := range InvokableCommandList {
-				if handler.HasCommandBeenInvoked(command, commandString) {
-					if handler.HasPermissionToInvoke(command, message) {
-						formattedMessage := handler.ReplaceReservedKeywordsWithValues(command.Message, message)
-						if len(command.Parameters) != 0 {
-							err, messageParameters := handler.GetParametersFromMessage(message, command)
-							if err != nil {
-								client.Say(channel, "Invalid usage of command")
-								log.Println(err.Error())
-							} else {
-								formattedMessage = handler.ReplaceCommandPlaceholdersWithValues(formattedMessage, command.Parameters, messageParameters)
-								client.Say(channel, formattedMessage)
-							}
-						} else {
-							client.Say(channel, formattedMessage)
-						}
-					}
+// Runs the commands loaded from files that the command string invokes
+func runFileCommands(handler CommandProcessor, client ChatClient, message ChatMessage, commandString string) {
+	messageLog := messageLogger(message)
+	_, addressed := commandText(message)
+	for _, command := range invokableCommands() {
+		if command.Disabled || (!addressed && !command.Keyword) || !handler.HasCommandBeenInvoked(command, commandString) ||
+			!canInvoke(handler, command, message) {
+			continue
+		}
+		if command.script != nil {
+			recordCommandInvoked(message, command.Invocation)
+			err := runScriptCommand(client, message, command)
+			if err != nil {
+				messageLog.Warn("Error running script command", "command", command.Invocation, "error", err)
+			}
+			continue
+		}
+		if command.Type == commandTypeHTTP || command.Type == commandTypeExec {
+			err, messageParameters := handler.GetParametersFromMessage(message, command)
+			if err != nil {
+				metrics.ParseError()
+				client.Say(channel, "Invalid usage of command")
+				messageLog.Info("Invalid usage of command", "command", command.Invocation, "error", err)
+				continue
+			}
+			slots := backgroundCommandSlots[command.Type]
+			select {
+			case slots <- struct{}{}:
+			default:
+				messageLog.Warn("Too many commands running in the background, dropping command", "command", command.Invocation)
+				continue
+			}
+			recordCommandInvoked(message, command.Invocation)
+			// Run in the background since they can take seconds, which would hold up every other message and could
+			// miss the server's pings
+			backgroundCommands.Add(1)
+			go func() {
+				defer backgroundCommands.Done()
+				defer func() {
+					<-slots
+				}()
+				var reply string
+				if command.Type == commandTypeHTTP {
+					reply = runHTTPCommand(handler, message, command, messageParameters)
+				} else {
+					reply = runExecCommand(handler, message, command, messageParameters)
 				}
+				if reply != "" {
+					client.Say(channel, reply)
+				}
+			}()
+			continue
+		}
+		formattedMessage := handler.ReplaceReservedKeywordsWithValues(command.Message, message)
+		if len(command.Parameters) != 0 {
+			err, messageParameters := handler.GetParametersFromMessage(message, command)
+			if err != nil {
+				metrics.ParseError()
+				client.Say(channel, "Invalid usage of command")
+				messageLog.Info("Invalid usage of command", "command", command.Invocation, "error", err)
+			} else {
+				recordCommandInvoked(message, command.Invocation)
+				formattedMessage = handler.ReplaceCommandPlaceholdersWithValues(formattedMessage, command.Parameters, messageParameters)
+				client.Say(channel, formattedMessage)
 			}
+		} else {
+			recordCommandInvoked(message, command.Invocation)
+			client.Say(channel, formattedMessage)
 		}
 	}
 }
+
+// Records a command being successfully invoked by the sender of the message
+func recordCommandInvoked(message ChatMessage, invocation string) {
+	metrics.CommandInvoked(invocation)
+	messageLogger(message).Info("Command invoked", "command", invocation)
+	sendEvent(WebhookCommandInvoked, message.Channel, map[string]interface{}{
+		"command": invocation,
+		"user":    message.User.Name,
+		"message": message.Message,
+	})
+	if userTracker != nil {
+		userTracker.CommandUsed(message.Channel, message.User.Name)
+	}
+}
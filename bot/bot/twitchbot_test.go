@@ -1,3 +1,174 @@
 package bot
 
-// TODO
+import (
+	"bytes"
+	"github.com/gempir/go-twitch-irc/v2"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testBot struct {
+	client     *TwitchBackend
+	chatClient *RateLimitedChatClient
+	done       chan error
+}
+
+// Connects the bot to the fake server, returning once it has joined the channel
+func startTestBot(t *testing.T, server *fakeTmiServer, limit int, period time.Duration) *testBot {
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "goatbot"
+	ircAddress = server.address()
+	metrics = NewMetrics()
+	IntervalMessageList = nil
+	InvokableCommandList = []InvokableCommand{
+		{Invocation: "hello", Message: "Hi, $username!"},
+		{Invocation: "ping", Message: "Pong!", ModOnly: true},
+	}
+
+	bot := &testBot{
+		client: NewTwitchBackend("oauth:test"),
+		done:   make(chan error, 1),
+	}
+	bot.client.client.SendPings = false
+	bot.chatClient = NewRateLimitedChatClient(bot.client, limit, period, outgoingQueueSize)
+	go bot.chatClient.Run()
+	go func() {
+		bot.done <- connect(bot.client, bot.chatClient)
+	}()
+
+	server.expect(server.connects, "the bot to connect")
+	server.expect(server.joins, "the bot to join the channel")
+	return bot
+}
+
+func (b *testBot) stop(t *testing.T) {
+	b.chatClient.Close()
+	_ = b.client.Disconnect()
+	select {
+	case err := <-b.done:
+		if err != twitch.ErrClientDisconnected {
+			t.Error("Test Failed: Expected the client to be disconnected but was: " + err.Error())
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Test Failed: Timed out waiting for the bot to disconnect")
+	}
+}
+
+func TestConnect_RequestsCapabilitiesAndJoinsChannel(t *testing.T) {
+	server := newFakeTmiServer(t)
+	defer server.close()
+	bot := startTestBot(t, server, defaultRateLimit, rateLimitPeriod)
+	defer bot.stop(t)
+
+	capabilities := server.expect(server.capability, "the bot to request capabilities")
+	if capabilities != "twitch.tv/tags twitch.tv/commands twitch.tv/membership" {
+		t.Error("Test Failed: Expected the bot to request tags, commands and membership but requested: " + capabilities)
+	}
+}
+
+func TestConnect_RespondsToCommand(t *testing.T) {
+	server := newFakeTmiServer(t)
+	defer server.close()
+	bot := startTestBot(t, server, defaultRateLimit, rateLimitPeriod)
+	defer bot.stop(t)
+
+	server.sendPrivateMessage("testchannel", "viewer", "", "!hello")
+
+	response := server.expect(server.privmsgs, "the bot to respond")
+	if response != "Hi, viewer!" {
+		t.Error("Test Failed: Expected response to be 'Hi, viewer!' but was: " + response)
+	}
+}
+
+func TestConnect_ModOnlyCommandUsesBadgesFromTags(t *testing.T) {
+	server := newFakeTmiServer(t)
+	defer server.close()
+	bot := startTestBot(t, server, defaultRateLimit, rateLimitPeriod)
+	defer bot.stop(t)
+
+	server.sendPrivateMessage("testchannel", "viewer", "", "!ping")
+	server.expectNothing(server.privmsgs, 100*time.Millisecond, "response to a non mod")
+
+	server.sendPrivateMessage("testchannel", "moderator", "moderator/1", "!ping")
+	response := server.expect(server.privmsgs, "the bot to respond to a mod")
+	if response != "Pong!" {
+		t.Error("Test Failed: Expected response to be 'Pong!' but was: " + response)
+	}
+}
+
+func TestConnect_SayReplacesNewLines(t *testing.T) {
+	server := newFakeTmiServer(t)
+	defer server.close()
+	bot := startTestBot(t, server, defaultRateLimit, rateLimitPeriod)
+	defer bot.stop(t)
+
+	bot.client.Say("testchannel", "hi\r\nJOIN #other\r\nPRIVMSG #other :spam")
+	response := server.expect(server.privmsgs, "the bot to send the message")
+	if response != "hi  JOIN #other  PRIVMSG #other :spam" {
+		t.Error("Test Failed: Expected the new lines to be replaced with spaces but was: " + response)
+	}
+	server.expectNothing(server.joins, 100*time.Millisecond, "join sent through a new line")
+}
+
+func TestConnect_IgnoresUserNotice(t *testing.T) {
+	server := newFakeTmiServer(t)
+	defer server.close()
+	bot := startTestBot(t, server, defaultRateLimit, rateLimitPeriod)
+	defer bot.stop(t)
+
+	server.sendUserNotice("testchannel", "raider", "raid", "msg-param-viewerCount=10")
+	server.expectNothing(server.privmsgs, 100*time.Millisecond, "response to a user notice")
+
+	server.sendPrivateMessage("testchannel", "viewer", "", "!hello")
+	server.expect(server.privmsgs, "the bot to respond after a user notice")
+}
+
+func TestConnect_RejoinsAfterReconnect(t *testing.T) {
+	server := newFakeTmiServer(t)
+	defer server.close()
+	bot := startTestBot(t, server, defaultRateLimit, rateLimitPeriod)
+	defer bot.stop(t)
+
+	server.sendReconnect()
+
+	server.expect(server.connects, "the bot to reconnect")
+	joined := server.expect(server.joins, "the bot to rejoin the channel")
+	if joined != "testchannel" {
+		t.Error("Test Failed: Expected the bot to rejoin 'testchannel' but joined: " + joined)
+	}
+
+	server.sendPrivateMessage("testchannel", "viewer", "", "!hello")
+	response := server.expect(server.privmsgs, "the bot to respond after reconnecting")
+	if response != "Hi, viewer!" {
+		t.Error("Test Failed: Expected response to be 'Hi, viewer!' but was: " + response)
+	}
+
+	var out bytes.Buffer
+	metrics.WritePrometheus(&out, bot.chatClient)
+	if !strings.Contains(out.String(), "goatbot_reconnects_total 1") {
+		t.Error("Test Failed: Expected 1 reconnect to be recorded but was:\n" + out.String())
+	}
+}
+
+func TestConnect_RateLimitsResponses(t *testing.T) {
+	server := newFakeTmiServer(t)
+	defer server.close()
+	bot := startTestBot(t, server, 2, 300*time.Millisecond)
+	defer bot.stop(t)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		server.sendPrivateMessage("testchannel", "viewer", "", "!hello")
+	}
+
+	server.expect(server.privmsgs, "the first response")
+	server.expect(server.privmsgs, "the second response")
+	server.expectNothing(server.privmsgs, 100*time.Millisecond, "third response within the rate limit period")
+	server.expect(server.privmsgs, "the third response after the rate limit period")
+
+	if time.Since(start) < 300*time.Millisecond {
+		t.Error("Test Failed: Expected the third response to wait for the rate limit period")
+	}
+}
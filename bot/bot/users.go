@@ -0,0 +1,215 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the user stats are written to disk while messages are being received
+const userStatsSaveInterval = 10 * time.Second
+
+// UserStats is what the bot knows about a user in a channel
+type UserStats struct {
+	Name         string    `json:"name"`
+	DisplayName  string    `json:"display_name"`
+	FirstSeen    time.Time `json:"first_seen"`
+	LastSeen     time.Time `json:"last_seen"`
+	LastMessage  string    `json:"last_message"`
+	Messages     uint64    `json:"messages"`
+	CommandsUsed uint64    `json:"commands_used"`
+}
+
+// UserTracker keeps track of the stats of every user that sends a message, stored in a file per channel
+type UserTracker struct {
+	mutex    sync.Mutex
+	channels map[string]map[string]*UserStats
+	previous map[string]map[string]UserStats
+	changed  map[string]bool
+	lastSave time.Time
+}
+
+var userTracker *UserTracker
+
+// NewUserTracker creates a UserTracker that loads and saves the stats of each channel in the data folder
+func NewUserTracker() *UserTracker {
+	return &UserTracker{
+		channels: map[string]map[string]*UserStats{},
+		previous: map[string]map[string]UserStats{},
+		changed:  map[string]bool{},
+		lastSave: time.Now(),
+	}
+}
+
+// Returns the users of a channel, loading them from disk the first time the channel is used
+func (u *UserTracker) channelUsers(channelName string) map[string]*UserStats {
+	channelName = strings.ToLower(channelName)
+	users, ok := u.channels[channelName]
+	if !ok {
+		users = map[string]*UserStats{}
+		err := readJSONFile(channelDataFile("users", channelName), &users)
+		if err != nil {
+			logger.Error("Error loading user stats", "channel", channelName, "error", err)
+		}
+		u.channels[channelName] = users
+		u.previous[channelName] = map[string]UserStats{}
+	}
+	return users
+}
+
+// RecordMessage updates the stats of the sender of the message
+func (u *UserTracker) RecordMessage(message ChatMessage) {
+	sent := message.Time
+	if sent.IsZero() {
+		sent = time.Now()
+	}
+	name := strings.ToLower(message.User.Name)
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	users := u.channelUsers(message.Channel)
+	stats, ok := users[name]
+	if ok {
+		u.previous[strings.ToLower(message.Channel)][name] = *stats
+	} else {
+		stats = &UserStats{Name: name, FirstSeen: sent}
+		users[name] = stats
+	}
+	stats.DisplayName = message.User.DisplayName
+	stats.LastSeen = sent
+	stats.LastMessage = message.Message
+	stats.Messages++
+	u.changed[strings.ToLower(message.Channel)] = true
+
+	if time.Since(u.lastSave) > userStatsSaveInterval {
+		u.save()
+	}
+}
+
+// CommandUsed increments the number of commands used by the user
+func (u *UserTracker) CommandUsed(channelName string, user string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	stats, ok := u.channelUsers(channelName)[strings.ToLower(user)]
+	if ok {
+		stats.CommandsUsed++
+		u.changed[strings.ToLower(channelName)] = true
+	}
+}
+
+// Get returns the current stats of a user in a channel
+func (u *UserTracker) Get(channelName string, user string) (UserStats, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	stats, ok := u.channelUsers(channelName)[strings.ToLower(user)]
+	if !ok {
+		return UserStats{}, false
+	}
+	return *stats, true
+}
+
+// Previous returns the stats of a user in a channel from before their most recent message
+func (u *UserTracker) Previous(channelName string, user string) (UserStats, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.channelUsers(channelName)
+	stats, ok := u.previous[strings.ToLower(channelName)][strings.ToLower(user)]
+	return stats, ok
+}
+
+// Save writes the stats of every channel that has changed to disk
+func (u *UserTracker) Save() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.save()
+}
+
+func (u *UserTracker) save() {
+	for channelName := range u.changed {
+		err := writeJSONFile(channelDataFile("users", channelName), u.channels[channelName])
+		if err != nil {
+			logger.Error("Error saving user stats", "channel", channelName, "error", err)
+			continue
+		}
+		delete(u.changed, channelName)
+	}
+	u.lastSave = time.Now()
+}
+
+// Returns the message with the $user.* template variables replaced with the stats of the sender of the message
+func replaceUserStatsKeywords(commandMessage string, message ChatMessage) string {
+	if userTracker == nil || !strings.Contains(commandMessage, "$user.") {
+		return commandMessage
+	}
+
+	stats, _ := userTracker.Get(message.Channel, message.User.Name)
+	lastSeen := "never"
+	if previous, ok := userTracker.Previous(message.Channel, message.User.Name); ok {
+		lastSeen = formatTimeAgo(previous.LastSeen)
+	}
+
+	return strings.NewReplacer(
+		"$user.messages", strconv.FormatUint(stats.Messages, 10),
+		"$user.commands", strconv.FormatUint(stats.CommandsUsed, 10),
+		"$user.firstseen", stats.FirstSeen.Format("2 January 2006"),
+		"$user.lastseen", lastSeen,
+	).Replace(commandMessage)
+}
+
+// Formats how long ago a time was, e.g. "5 minutes ago"
+func formatTimeAgo(at time.Time) string {
+	elapsed := time.Since(at)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return pluralise(int(elapsed/time.Minute), "minute") + " ago"
+	case elapsed < 24*time.Hour:
+		return pluralise(int(elapsed/time.Hour), "hour") + " ago"
+	default:
+		return pluralise(int(elapsed/(24*time.Hour)), "day") + " ago"
+	}
+}
+
+func pluralise(count int, unit string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, unit)
+	}
+	return fmt.Sprintf("%d %ss", count, unit)
+}
+
+// !seen <user> sends when the user was last seen and what they said
+func seenCommand(client ChatClient, message ChatMessage, arguments []string) {
+	if len(arguments) == 0 {
+		client.Say(message.Channel, "Usage: "+commandPrefix(message.Channel)+"seen <user>")
+		return
+	}
+
+	user := strings.TrimPrefix(arguments[0], "@")
+	stats, ok := userTracker.Get(message.Channel, user)
+	if !ok {
+		client.Say(message.Channel, "I haven't seen "+user+" in chat")
+		return
+	}
+	if strings.EqualFold(user, message.User.Name) {
+		client.Say(message.Channel, message.User.DisplayName+", you're right here!")
+		return
+	}
+	client.Say(message.Channel, fmt.Sprintf("%s was last seen %s saying: %s", stats.DisplayName, formatTimeAgo(stats.LastSeen), stats.LastMessage))
+}
+
+// !lastseen sends when the user invoking it was last seen before this message
+func lastSeenCommand(client ChatClient, message ChatMessage, arguments []string) {
+	stats, ok := userTracker.Previous(message.Channel, message.User.Name)
+	if !ok {
+		client.Say(message.Channel, "Welcome "+message.User.DisplayName+", this is the first time I've seen you!")
+		return
+	}
+	client.Say(message.Channel, fmt.Sprintf("%s, you were last seen %s saying: %s", message.User.DisplayName, formatTimeAgo(stats.LastSeen), stats.LastMessage))
+}
@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sets up an empty data folder and user tracker with the user commands registered
+func setUpUserTracker(t *testing.T) func() {
+	directory, err := ioutil.TempDir("", "goatbot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataDirectory = directory
+	prefix = "!"
+	channel = "testchannel"
+	nickname = "goatbot"
+	IntervalMessageList = nil
+	InvokableCommandList = nil
+	builtInCommands = nil
+	userTracker = NewUserTracker()
+	registerBuiltInCommand(builtInCommand{invocation: "seen", handler: seenCommand})
+	registerBuiltInCommand(builtInCommand{invocation: "lastseen", handler: lastSeenCommand})
+	return func() {
+		userTracker = nil
+		builtInCommands = nil
+		dataDirectory = "data/"
+		_ = os.RemoveAll(directory)
+	}
+}
+
+func TestUserTracker_RecordMessage(t *testing.T) {
+	cleanUp := setUpUserTracker(t)
+	defer cleanUp()
+
+	first := time.Now().Add(-time.Hour)
+	userTracker.RecordMessage(chatMessage("Viewer", "hello", "1", first))
+	userTracker.RecordMessage(chatMessage("viewer", "goodbye", "2", time.Now()))
+	userTracker.CommandUsed("testchannel", "VIEWER")
+
+	stats, ok := userTracker.Get("testchannel", "viewer")
+	if !ok {
+		t.Fatal("Test Failed: Expected stats for viewer")
+	}
+	if stats.Messages != 2 || stats.CommandsUsed != 1 || stats.LastMessage != "goodbye" || !stats.FirstSeen.Equal(first) {
+		t.Errorf("Test Failed: Expected 2 messages, 1 command, last message 'goodbye' and first seen an hour ago but was %+v", stats)
+	}
+
+	previous, _ := userTracker.Previous("testchannel", "viewer")
+	if previous.LastMessage != "hello" || previous.Messages != 1 {
+		t.Errorf("Test Failed: Expected previous stats to be from the first message but was %+v", previous)
+	}
+}
+
+func TestUserTracker_SaveAndLoad(t *testing.T) {
+	cleanUp := setUpUserTracker(t)
+	defer cleanUp()
+
+	userTracker.RecordMessage(chatMessage("viewer", "hello", "1", time.Now()))
+	userTracker.Save()
+
+	loaded := NewUserTracker()
+	stats, ok := loaded.Get("testchannel", "viewer")
+	if !ok || stats.Messages != 1 || stats.LastMessage != "hello" {
+		t.Errorf("Test Failed: Expected saved stats to be loaded but was %+v", stats)
+	}
+
+	_, ok = loaded.Get("otherchannel", "viewer")
+	if ok {
+		t.Error("Test Failed: Expected stats to be kept per channel")
+	}
+}
+
+func TestUserTracker_SavedPeriodically(t *testing.T) {
+	cleanUp := setUpUserTracker(t)
+	defer cleanUp()
+
+	userTracker.RecordMessage(chatMessage("viewer", "hello", "1", time.Now()))
+	userTracker.RecordMessage(chatMessage("viewer", "goodbye", "2", time.Now()))
+	if stats, ok := NewUserTracker().Get("testchannel", "viewer"); ok {
+		t.Fatalf("Test Failed: Expected the messages not to be saved yet but was %+v", stats)
+	}
+
+	stopSaving := startSavingData(10 * time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	stopSaving()
+
+	stats, _ := NewUserTracker().Get("testchannel", "viewer")
+	if stats.Messages != 2 || stats.LastMessage != "goodbye" {
+		t.Errorf("Test Failed: Expected the stats to be saved without another message but was %+v", stats)
+	}
+}
+
+func TestSeenCommand(t *testing.T) {
+	cleanUp := setUpUserTracker(t)
+	defer cleanUp()
+
+	client := RecordingChatClient{}
+	handler := CommandHandler{}
+	onMessage(&handler, &client, chatMessage("viewer", "brb", "1", time.Now().Add(-2*time.Hour)))
+	onMessage(&handler, &client, chatMessage("other", "!seen @Viewer", "2", time.Now()))
+	onMessage(&handler, &client, chatMessage("other", "!seen nobody", "3", time.Now()))
+
+	if len(client.Messages) != 2 {
+		t.Fatalf("Test Failed: Expected 2 responses but was %v", client.Messages)
+	}
+	if client.Messages[0] != "viewer was last seen 2 hours ago saying: brb" {
+		t.Error("Test Failed: Expected viewer to have been seen 2 hours ago but was: " + client.Messages[0])
+	}
+	if client.Messages[1] != "I haven't seen nobody in chat" {
+		t.Error("Test Failed: Expected nobody to not have been seen but was: " + client.Messages[1])
+	}
+}
+
+func TestLastSeenCommand(t *testing.T) {
+	cleanUp := setUpUserTracker(t)
+	defer cleanUp()
+
+	client := RecordingChatClient{}
+	handler := CommandHandler{}
+	onMessage(&handler, &client, chatMessage("viewer", "!lastseen", "1", time.Now()))
+	onMessage(&handler, &client, chatMessage("viewer", "!lastseen", "2", time.Now()))
+
+	if len(client.Messages) != 2 || !strings.HasPrefix(client.Messages[0], "Welcome viewer") || client.Messages[1] != "viewer, you were last seen just now saying: !lastseen" {
+		t.Errorf("Test Failed: Expected a welcome and then the previous message but was %v", client.Messages)
+	}
+}
+
+func TestUserStatsTemplateVariables(t *testing.T) {
+	cleanUp := setUpUserTracker(t)
+	defer cleanUp()
+	InvokableCommandList = []InvokableCommand{{Invocation: "stats", Message: "$username has sent $user.messages messages and used $user.commands commands"}}
+
+	client := RecordingChatClient{}
+	handler := CommandHandler{}
+	onMessage(&handler, &client, chatMessage("viewer", "!stats", "1", time.Now()))
+	onMessage(&handler, &client, chatMessage("viewer", "hi", "2", time.Now()))
+	onMessage(&handler, &client, chatMessage("viewer", "!stats", "3", time.Now()))
+
+	if len(client.Messages) != 2 || client.Messages[1] != "viewer has sent 3 messages and used 1 commands" {
+		t.Errorf("Test Failed: Expected the user's stats but was %v", client.Messages)
+	}
+}
+
+func TestFormatTimeAgo(t *testing.T) {
+	cases := map[time.Duration]string{
+		10 * time.Second:   "just now",
+		time.Minute:        "1 minute ago",
+		5 * time.Hour:      "5 hours ago",
+		3 * 24 * time.Hour: "3 days ago",
+	}
+	for elapsed, expected := range cases {
+		result := formatTimeAgo(time.Now().Add(-elapsed))
+		if result != expected {
+			t.Error("Test Failed: Expected '" + expected + "' but was '" + result + "'")
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gempir/go-twitch-irc/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Events that can be sent to webhooks
+const (
+	WebhookCommandInvoked = "command_invoked"
+	WebhookModAction      = "mod_action"
+	WebhookGiveawayWinner = "giveaway_winner"
+	WebhookRaid           = "raid"
+	WebhookDisconnected   = "disconnected"
+)
+
+var webhookEvents = []string{WebhookCommandInvoked, WebhookModAction, WebhookGiveawayWinner, WebhookRaid, WebhookDisconnected}
+
+// How many times a webhook is retried after a failed delivery, and how long to wait before the first retry. The wait
+// doubles after each retry
+var (
+	webhookRetries    = 3
+	webhookRetryDelay = time.Second
+	webhookTimeout    = 5 * time.Second
+	// The most events waiting to be delivered to each webhook, after which new events are dropped
+	webhookQueueSize = 100
+	// How long the bot waits for events to be delivered when it stops, after which the rest are dropped
+	webhookStopTimeout = 10 * time.Second
+)
+
+// Webhook is a URL that is sent events as JSON
+type Webhook struct {
+	URL string `json:"url"`
+	// Used to sign each request so the receiver can check it came from the bot
+	Secret string `json:"secret,omitempty"`
+	// The events to send, or every event if it is empty
+	Events []string `json:"events,omitempty"`
+}
+
+// Returns whether the webhook should be sent the event
+func (w Webhook) wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, wanted := range w.Events {
+		if wanted == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEvent is the JSON body sent to webhooks
+type WebhookEvent struct {
+	Event   string                 `json:"event"`
+	Channel string                 `json:"channel,omitempty"`
+	Time    time.Time              `json:"time"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+// WebhookDispatcher sends events to webhooks in the background, retrying failed deliveries
+type WebhookDispatcher struct {
+	webhooks []Webhook
+	// An event queue for each webhook, delivered in order by one goroutine per webhook
+	queues  []chan webhookDelivery
+	client  *http.Client
+	pending sync.WaitGroup
+	workers sync.WaitGroup
+	// Cancelled when the bot gives up waiting for deliveries, dropping the events that are still waiting
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type webhookDelivery struct {
+	event      string
+	deliveryID string
+	body       []byte
+}
+
+var webhooks *WebhookDispatcher
+
+// NewWebhookDispatcher creates a WebhookDispatcher that sends events to the given webhooks, starting a goroutine for each
+// webhook that delivers its events
+func NewWebhookDispatcher(hooks []Webhook) *WebhookDispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	dispatcher := &WebhookDispatcher{webhooks: hooks, client: &http.Client{}, ctx: ctx, cancel: cancel}
+	for _, hook := range hooks {
+		queue := make(chan webhookDelivery, webhookQueueSize)
+		dispatcher.queues = append(dispatcher.queues, queue)
+		dispatcher.workers.Add(1)
+		go dispatcher.run(hook, queue)
+	}
+	return dispatcher
+}
+
+// Delivers the events queued for the webhook until the queue is closed
+func (d *WebhookDispatcher) run(hook Webhook, queue chan webhookDelivery) {
+	defer d.workers.Done()
+	for delivery := range queue {
+		d.deliver(hook, delivery.event, delivery.deliveryID, delivery.body)
+		d.pending.Done()
+	}
+}
+
+// Loads the webhooks from the file, if one is given
+func initWebhooks(filePath string) error {
+	if filePath == "" {
+		return nil
+	}
+	fileData, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	var hooks []Webhook
+	err = json.Unmarshal(fileData, &hooks)
+	if err != nil {
+		return fmt.Errorf("error loading webhooks from %s: %w", filePath, err)
+	}
+	for _, hook := range hooks {
+		err = validateWebhook(hook)
+		if err != nil {
+			return fmt.Errorf("error loading webhooks from %s: %w", filePath, err)
+		}
+	}
+
+	webhooks = NewWebhookDispatcher(hooks)
+	logger.Info("Webhooks loaded", "file", filePath, "webhooks", len(hooks))
+	return nil
+}
+
+func validateWebhook(hook Webhook) error {
+	if !strings.HasPrefix(hook.URL, "http://") && !strings.HasPrefix(hook.URL, "https://") {
+		return errors.New("webhook url must start with http:// or https://")
+	}
+	for _, event := range hook.Events {
+		if !isWebhookEvent(event) {
+			return fmt.Errorf("unknown webhook event '%s'", event)
+		}
+	}
+	return nil
+}
+
+// Returns whether the event is one of the events the bot sends
+func isWebhookEvent(event string) bool {
+	for _, webhookEvent := range webhookEvents {
+		if event == webhookEvent {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends the event to every webhook that wants it and to the Discord bridge, if they are set up
+func sendEvent(event string, channelName string, data map[string]interface{}) {
+	if webhooks != nil {
+		webhooks.Send(event, channelName, data)
+	}
+	if discordBridge != nil {
+		discordBridge.handleEvent(event, channelName, data)
+	}
+}
+
+// Send queues the event for every webhook that wants it, dropping it for webhooks whose queue is full
+func (d *WebhookDispatcher) Send(event string, channelName string, data map[string]interface{}) {
+	body, err := json.Marshal(WebhookEvent{Event: event, Channel: channelName, Time: time.Now().UTC(), Data: data})
+	if err != nil {
+		logger.Error("Error encoding webhook event", "event", event, "error", err)
+		return
+	}
+	deliveryID := newDeliveryID()
+
+	for i, hook := range d.webhooks {
+		if !hook.wants(event) {
+			continue
+		}
+		d.pending.Add(1)
+		select {
+		case d.queues[i] <- webhookDelivery{event: event, deliveryID: deliveryID, body: body}:
+		default:
+			d.pending.Done()
+			logger.Warn("Webhook queue is full, dropping event", "url", hook.URL, "event", event)
+		}
+	}
+}
+
+// Wait blocks until every event that has been sent has been delivered or has run out of retries
+func (d *WebhookDispatcher) Wait() {
+	d.pending.Wait()
+}
+
+// WaitTimeout blocks until every event that has been sent has been delivered or has run out of retries, or the timeout
+// passes. Events that haven't been delivered by then are dropped, and it returns whether every event was delivered
+func (d *WebhookDispatcher) WaitTimeout(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		logger.Warn("Timed out waiting for webhooks to be delivered, dropping the rest", "timeout", timeout.String())
+		d.cancel()
+		<-done
+		return false
+	}
+}
+
+// Close delivers the events already queued and stops the webhooks' goroutines. No events can be sent afterwards
+func (d *WebhookDispatcher) Close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.workers.Wait()
+	d.cancel()
+}
+
+// Posts the body to the webhook, retrying with backoff until it is accepted or it runs out of retries
+func (d *WebhookDispatcher) deliver(hook Webhook, event string, deliveryID string, body []byte) {
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		if d.ctx.Err() != nil {
+			logger.Warn("Dropped webhook event", "url", hook.URL, "event", event, "attempts", attempt)
+			return
+		}
+		retry, err := d.post(hook, event, deliveryID, body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= webhookRetries {
+			logger.Warn("Error delivering webhook", "url", hook.URL, "event", event, "attempts", attempt+1, "error", err)
+			return
+		}
+		logger.Debug("Retrying webhook", "url", hook.URL, "event", event, "error", err, "delay", delay.String())
+		select {
+		case <-time.After(delay):
+		case <-d.ctx.Done():
+		}
+		delay *= 2
+	}
+}
+
+// Posts the body to the webhook once, returning an error and whether it is worth retrying if it is not accepted
+func (d *WebhookDispatcher) post(hook Webhook, event string, deliveryID string, body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(d.ctx, webhookTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "GoatBot")
+	request.Header.Set("X-GoatBot-Event", event)
+	request.Header.Set("X-GoatBot-Delivery", deliveryID)
+	if hook.Secret != "" {
+		request.Header.Set("X-GoatBot-Signature", signWebhookBody(hook.Secret, body))
+	}
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+	_ = response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode <= 299 {
+		return false, nil
+	}
+	retry := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("response status was %s", response.Status)
+}
+
+// Returns the signature of the body in the form `sha256=<hex HMAC-SHA256 of the body>`
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns a random ID that is the same for every retry of a delivery, so receivers can ignore duplicates
+func newDeliveryID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Sends a mod_action event when a user is timed out or banned, or the chat is cleared
+func onClearChat(message twitch.ClearChatMessage) {
+	data := map[string]interface{}{"action": "clear"}
+	if message.TargetUsername != "" {
+		data["user"] = message.TargetUsername
+		if message.BanDuration > 0 {
+			data["action"] = "timeout"
+			data["duration_seconds"] = message.BanDuration
+		} else {
+			data["action"] = "ban"
+		}
+	}
+	logger.Info("Mod action", "channel", message.Channel, "action", data["action"], "user", message.TargetUsername)
+	sendEvent(WebhookModAction, message.Channel, data)
+}
+
+// Sends a mod_action event when a mod deletes a message
+func onClearMessage(message twitch.ClearMessage) {
+	sendEvent(WebhookModAction, message.Channel, map[string]interface{}{
+		"action":  "delete",
+		"user":    message.Login,
+		"message": message.Message,
+	})
+}
+
+// Sends a raid event when the channel is raided
+func onUserNotice(message twitch.UserNoticeMessage) {
+	if message.MsgID != "raid" {
+		return
+	}
+	viewers := 0
+	_, _ = fmt.Sscan(message.MsgParams["msg-param-viewerCount"], &viewers)
+	logger.Info("Raid received", "channel", message.Channel, "user", message.User.Name, "viewers", viewers)
+	sendEvent(WebhookRaid, message.Channel, map[string]interface{}{
+		"user":         message.User.Name,
+		"display_name": message.User.DisplayName,
+		"viewers":      viewers,
+	})
+}
@@ -0,0 +1,227 @@
+package bot
+
+import (
+	"encoding/json"
+	"github.com/gempir/go-twitch-irc/v2"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A local webhook receiver that records the requests it receives, failing the first failures requests
+type webhookReceiver struct {
+	mutex    sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	failures int
+	status   int
+}
+
+func (r *webhookReceiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	body, _ := io.ReadAll(request.Body)
+	r.requests = append(r.requests, request)
+	r.bodies = append(r.bodies, body)
+	if r.failures > 0 {
+		r.failures--
+		writer.WriteHeader(r.status)
+	}
+}
+
+func (r *webhookReceiver) events(t *testing.T) []WebhookEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var events []WebhookEvent
+	for _, body := range r.bodies {
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// Sets up empty commands and data folders and webhooks sending to the given receivers
+func setUpWebhooks(t *testing.T, hooks ...Webhook) func() {
+	cleanUp := setUpScripts(t)
+	cooldowns = NewCooldownTracker()
+	webhookRetryDelay = time.Millisecond
+	webhooks = NewWebhookDispatcher(hooks)
+	return func() {
+		webhooks.Close()
+		webhooks = nil
+		webhookRetryDelay = time.Second
+		cleanUp()
+	}
+}
+
+func TestWebhooks_SignedAndFiltered(t *testing.T) {
+	all := &webhookReceiver{}
+	allServer := httptest.NewServer(all)
+	defer allServer.Close()
+	raids := &webhookReceiver{}
+	raidsServer := httptest.NewServer(raids)
+	defer raidsServer.Close()
+
+	cleanUp := setUpWebhooks(t,
+		Webhook{URL: allServer.URL, Secret: "secret"},
+		Webhook{URL: raidsServer.URL, Events: []string{WebhookRaid}},
+	)
+	defer cleanUp()
+	InvokableCommandList = []InvokableCommand{{Invocation: "hello", Message: "Hello!"}}
+
+	sendMessages(&syncRecordingChatClient{}, testMessage{user: "viewer", text: "!hello"})
+	onUserNotice(twitch.UserNoticeMessage{
+		User:      twitch.User{Name: "raider", DisplayName: "Raider"},
+		Channel:   "testchannel",
+		MsgID:     "raid",
+		MsgParams: map[string]string{"msg-param-viewerCount": "42"},
+	})
+	onUserNotice(twitch.UserNoticeMessage{Channel: "testchannel", MsgID: "sub"})
+	webhooks.Wait()
+
+	// Put in a fixed order, since the order the events arrive in isn't what is being tested
+	events := all.events(t)
+	requests := append([]*http.Request(nil), all.requests...)
+	bodies := append([][]byte(nil), all.bodies...)
+	if len(events) == 2 && events[0].Event != WebhookCommandInvoked {
+		events[0], events[1] = events[1], events[0]
+		requests[0], requests[1] = requests[1], requests[0]
+		bodies[0], bodies[1] = bodies[1], bodies[0]
+	}
+	if len(events) != 2 || events[0].Event != WebhookCommandInvoked || events[1].Event != WebhookRaid {
+		t.Fatalf("Test Failed: Expected a command_invoked and a raid event but was %+v", events)
+	}
+	if events[0].Data["command"] != "hello" || events[0].Data["user"] != "viewer" || events[0].Channel != "testchannel" {
+		t.Errorf("Test Failed: Expected the command event to describe the command but was %+v", events[0])
+	}
+	for i, request := range requests {
+		if request.Header.Get("X-GoatBot-Signature") != signWebhookBody("secret", bodies[i]) {
+			t.Errorf("Test Failed: Expected request %d to be signed but was %s", i, request.Header.Get("X-GoatBot-Signature"))
+		}
+		if request.Header.Get("X-GoatBot-Event") != events[i].Event {
+			t.Errorf("Test Failed: Expected the event header to be %s but was %s", events[i].Event, request.Header.Get("X-GoatBot-Event"))
+		}
+	}
+
+	raidEvents := raids.events(t)
+	if len(raidEvents) != 1 || raidEvents[0].Data["viewers"] != float64(42) || raidEvents[0].Data["user"] != "raider" {
+		t.Errorf("Test Failed: Expected only the raid event to be sent but was %+v", raidEvents)
+	}
+	if raids.requests[0].Header.Get("X-GoatBot-Signature") != "" {
+		t.Error("Test Failed: Expected requests to webhooks without a secret not to be signed")
+	}
+}
+
+func TestWebhooks_Retries(t *testing.T) {
+	flaky := &webhookReceiver{failures: 2, status: http.StatusBadGateway}
+	flakyServer := httptest.NewServer(flaky)
+	defer flakyServer.Close()
+	rejecting := &webhookReceiver{failures: 5, status: http.StatusBadRequest}
+	rejectingServer := httptest.NewServer(rejecting)
+	defer rejectingServer.Close()
+	down := &webhookReceiver{failures: 10, status: http.StatusServiceUnavailable}
+	downServer := httptest.NewServer(down)
+	defer downServer.Close()
+
+	cleanUp := setUpWebhooks(t, Webhook{URL: flakyServer.URL}, Webhook{URL: rejectingServer.URL}, Webhook{URL: downServer.URL})
+	defer cleanUp()
+
+	onClearChat(twitch.ClearChatMessage{Channel: "testchannel", TargetUsername: "spammer", BanDuration: 600})
+	webhooks.Wait()
+
+	if len(flaky.requests) != 3 {
+		t.Errorf("Test Failed: Expected the flaky webhook to be retried until it succeeded but got %d requests", len(flaky.requests))
+	}
+	if flaky.requests[0].Header.Get("X-GoatBot-Delivery") != flaky.requests[2].Header.Get("X-GoatBot-Delivery") {
+		t.Error("Test Failed: Expected retries to have the same delivery ID")
+	}
+	if len(rejecting.requests) != 1 {
+		t.Errorf("Test Failed: Expected client errors not to be retried but got %d requests", len(rejecting.requests))
+	}
+	if len(down.requests) != webhookRetries+1 {
+		t.Errorf("Test Failed: Expected %d attempts but got %d", webhookRetries+1, len(down.requests))
+	}
+
+	event := flaky.events(t)[2]
+	if event.Event != WebhookModAction || event.Data["action"] != "timeout" || event.Data["user"] != "spammer" || event.Data["duration_seconds"] != float64(600) {
+		t.Errorf("Test Failed: Expected a timeout mod action but was %+v", event)
+	}
+}
+
+func TestWebhooks_GiveawayWinner(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	cleanUp := setUpWebhooks(t, Webhook{URL: server.URL, Events: []string{WebhookGiveawayWinner}})
+	defer cleanUp()
+	cleanUpGiveaways := setUpGiveaways(t, time.Hour)
+	defer cleanUpGiveaways()
+
+	sendMessages(&syncRecordingChatClient{},
+		modMessage("!giveaway start !enter"),
+		testMessage{user: "viewer", text: "!enter"},
+		modMessage("!giveaway draw"),
+	)
+	webhooks.Wait()
+
+	events := receiver.events(t)
+	if len(events) != 1 || events[0].Data["user"] != "viewer" || events[0].Data["draw"] != float64(1) {
+		t.Errorf("Test Failed: Expected a giveaway_winner event for viewer but was %+v", events)
+	}
+}
+
+func TestInitWebhooks(t *testing.T) {
+	cleanUp := setUpWebhooks(t)
+	defer cleanUp()
+
+	filePath := filepath.Join(dataDirectory, "webhooks.json")
+	for _, invalid := range []string{
+		`[{"url": "ftp://example.com"}]`,
+		`[{"url": "https://example.com", "events": ["unknown"]}]`,
+		`{"url": "https://example.com"}`,
+	} {
+		_ = ioutil.WriteFile(filePath, []byte(invalid), 0644)
+		if initWebhooks(filePath) == nil {
+			t.Errorf("Test Failed: Expected an error loading %s", invalid)
+		}
+	}
+
+	_ = ioutil.WriteFile(filePath, []byte(`[{"url": "https://example.com", "secret": "s", "events": ["raid", "mod_action"]}]`), 0644)
+	if err := initWebhooks(filePath); err != nil || len(webhooks.webhooks) != 1 || !webhooks.webhooks[0].wants(WebhookRaid) || webhooks.webhooks[0].wants(WebhookDisconnected) {
+		t.Errorf("Test Failed: Expected the webhook to load but got %v", err)
+	}
+}
+
+func TestWebhooks_WaitTimeoutDropsUndelivered(t *testing.T) {
+	down := &webhookReceiver{failures: 100, status: http.StatusServiceUnavailable}
+	downServer := httptest.NewServer(down)
+	defer downServer.Close()
+
+	cleanUp := setUpWebhooks(t, Webhook{URL: downServer.URL})
+	defer cleanUp()
+	webhookRetryDelay = time.Hour
+
+	onClearChat(twitch.ClearChatMessage{Channel: "testchannel", TargetUsername: "spammer"})
+	onClearChat(twitch.ClearChatMessage{Channel: "testchannel", TargetUsername: "troll"})
+	start := time.Now()
+	if webhooks.WaitTimeout(50 * time.Millisecond) {
+		t.Error("Test Failed: Expected the deliveries not to finish before the timeout")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Test Failed: Expected the undelivered events to be dropped at the timeout but took %s", elapsed)
+	}
+	down.mutex.Lock()
+	defer down.mutex.Unlock()
+	if len(down.requests) > 1 {
+		t.Errorf("Test Failed: Expected the queued event to be dropped without being sent but got %d requests", len(down.requests))
+	}
+}
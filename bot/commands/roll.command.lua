@@ -0,0 +1,16 @@
+-- aliases: dice
+-- Rolls a die with the given number of sides, e.g. !roll 20, and remembers the highest roll
+local sides = tonumber(args[1]) or 6
+if sides < 2 then
+	reply("a die needs at least 2 sides")
+	return
+end
+
+local roll = random(sides)
+local best = storage.get("best") or 0
+if roll > best then
+	storage.set("best", roll)
+	reply("rolled a " .. roll .. " on a d" .. sides .. ", the highest roll yet!")
+else
+	reply("rolled a " .. roll .. " on a d" .. sides)
+end
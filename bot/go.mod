@@ -1,8 +1,9 @@
 module goatbot
 
-go 1.16
+go 1.23
 
 require (
 	github.com/gempir/go-twitch-irc/v2 v2.5.0
 	github.com/joho/godotenv v1.3.0
+	github.com/yuin/gopher-lua v1.1.2
 )
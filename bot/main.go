@@ -1,18 +1,108 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/joho/godotenv"
 	"goatbot/bot"
-	"log"
+	"log/slog"
+	"os"
+	"regexp"
 )
 
 func main() {
-	log.Println("Loading environment config...")
+	console := flag.Bool("console", false, "read messages from stdin instead of connecting to Twitch")
+	user := flag.String("user", "console", "the username to send messages as in console mode")
+	moderator := flag.Bool("mod", false, "give the console user the moderator badge")
+	broadcaster := flag.Bool("broadcaster", false, "give the console user the broadcaster badge")
+	flag.Parse()
+
+	slog.Info("Loading environment config...")
 	err := godotenv.Load()
+	if err != nil && flag.Arg(0) != "logs" {
+		slog.Error("Error loading .env file", "error", err)
+		os.Exit(1)
+	}
+
+	logger, err := bot.NewLogger(os.Stderr, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"))
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		slog.Error("Error configuring logging", "error", err)
+		os.Exit(1)
+	}
+	bot.SetLogger(logger)
+
+	if flag.Arg(0) == "logs" {
+		os.Exit(runLogsCommand(flag.Args()[1:]))
+	}
+
+	if flag.Arg(0) == "test" {
+		// Fixtures are run against the commands in the same folder
+		directory := "commands/"
+		if flag.NArg() > 1 {
+			directory = flag.Arg(1)
+		}
+		os.Exit(runCommandTests(directory))
 	}
 
 	bot.Init()
-	bot.Start()
+	if *console {
+		bot.StartConsole(bot.ConsoleUser{
+			Name:        *user,
+			Moderator:   *moderator,
+			Broadcaster: *broadcaster,
+		})
+	} else {
+		bot.Start()
+	}
+}
+
+// Runs `goatbot test [directory]` and returns the exit code
+func runCommandTests(directory string) int {
+	cleanUp, err := bot.InitCommandTests(directory)
+	if err != nil {
+		slog.Error("Error setting up command tests", "error", err)
+		return 1
+	}
+	defer cleanUp()
+	if bot.RunCommandTests(directory, os.Stdout) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Runs `goatbot logs grep [-channel name] [-user name] [-dir directory] <pattern>` and returns the exit code
+func runLogsCommand(arguments []string) int {
+	if len(arguments) == 0 || arguments[0] != "grep" {
+		fmt.Fprintln(os.Stderr, "Usage: goatbot logs grep [-channel name] [-user name] [-dir directory] <pattern>")
+		return 2
+	}
+
+	defaultDirectory := os.Getenv("CHAT_LOG_DIRECTORY")
+	if defaultDirectory == "" {
+		defaultDirectory = "logs/"
+	}
+
+	flags := flag.NewFlagSet("logs grep", flag.ExitOnError)
+	channel := flags.String("channel", "", "only search the logs of this channel")
+	user := flags.String("user", "", "only include messages from this user")
+	directory := flags.String("dir", defaultDirectory, "the chat log directory")
+	_ = flags.Parse(arguments[1:])
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: goatbot logs grep [-channel name] [-user name] [-dir directory] <pattern>")
+		return 2
+	}
+
+	pattern, err := regexp.Compile("(?i)" + flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid pattern: "+err.Error())
+		return 2
+	}
+
+	err = bot.GrepChatLogs(*directory, *channel, *user, pattern, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error searching chat logs: "+err.Error())
+		return 1
+	}
+	return 0
 }